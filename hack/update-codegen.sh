@@ -13,6 +13,17 @@ CODEGEN_PKG=${CODEGEN_PKG:-$(cd ${SCRIPT_ROOT}; ls -d -1 ./vendor/k8s.io/code-ge
 #                  instead of the $GOPATH directly. For normal projects this can be dropped.
 ${CODEGEN_PKG}/generate-groups.sh "deepcopy,client,informer,lister" \
   github.com/xmudrii/etcdproxy-controller/pkg/client github.com/xmudrii/etcdproxy-controller/pkg/apis \
-  etcd:v1alpha1 \
+  etcd:v1alpha1,v1beta1 \
   --output-base "$(dirname ${BASH_SOURCE})/../../../.." \
-  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.txt
\ No newline at end of file
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.txt
+
+# generate-groups.sh doesn't run defaulter-gen and conversion-gen, but it installs defaulter-gen,
+# so defaulters and conversions are generated separately.
+${GOPATH}/bin/defaulter-gen --input-dirs github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1,github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1 \
+  -O zz_generated.defaults \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.txt
+
+go install ./${CODEGEN_PKG}/cmd/conversion-gen
+${GOPATH}/bin/conversion-gen --input-dirs github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1 \
+  -O zz_generated.conversion \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.txt
@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/conversion"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// Convert_v1alpha1_EtdcStorageSpec_To_v1beta1_EtcdStorageSpec converts the misspelled v1alpha1 spec type to
+// the v1beta1 spec type. Conversion functions are not generated for types with different names.
+func Convert_v1alpha1_EtdcStorageSpec_To_v1beta1_EtcdStorageSpec(in *EtdcStorageSpec, out *v1beta1.EtcdStorageSpec, s conversion.Scope) error {
+	out.CACertConfigMaps = nil
+	for i := range in.CACertConfigMaps {
+		var dest v1beta1.CABundleDestination
+		if err := Convert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination(&in.CACertConfigMaps[i], &dest, s); err != nil {
+			return err
+		}
+		out.CACertConfigMaps = append(out.CACertConfigMaps, dest)
+	}
+	out.ClientCertSecrets = nil
+	for i := range in.ClientCertSecrets {
+		var dest v1beta1.ClientCertificateDestination
+		if err := Convert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination(&in.ClientCertSecrets[i], &dest, s); err != nil {
+			return err
+		}
+		out.ClientCertSecrets = append(out.ClientCertSecrets, dest)
+	}
+	out.SigningCertificateValidity = in.SigningCertificateValidity
+	out.ServingCertificateValidity = in.ServingCertificateValidity
+	out.ClientCertificateValidity = in.ClientCertificateValidity
+	out.CleanupPolicy = v1beta1.CleanupPolicy(in.CleanupPolicy)
+	out.DataRetentionPolicy = v1beta1.DataRetentionPolicy(in.DataRetentionPolicy)
+	out.Quota = nil
+	if in.Quota != nil {
+		out.Quota = &v1beta1.StorageQuota{}
+		if err := Convert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota(in.Quota, out.Quota, s); err != nil {
+			return err
+		}
+	}
+	out.ProxyTemplate = nil
+	if in.ProxyTemplate != nil {
+		out.ProxyTemplate = &v1beta1.ProxyTemplate{}
+		if err := Convert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate(in.ProxyTemplate, out.ProxyTemplate, s); err != nil {
+			return err
+		}
+	}
+	out.Issuer = nil
+	if in.Issuer != nil {
+		out.Issuer = &v1beta1.IssuerReference{}
+		if err := Convert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference(in.Issuer, out.Issuer, s); err != nil {
+			return err
+		}
+	}
+	out.KeyAlgorithm = v1beta1.KeyAlgorithm(in.KeyAlgorithm)
+	out.RevokedClientCertificates = nil
+	for i := range in.RevokedClientCertificates {
+		var revoked v1beta1.RevokedCertificate
+		if err := Convert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate(&in.RevokedClientCertificates[i], &revoked, s); err != nil {
+			return err
+		}
+		out.RevokedClientCertificates = append(out.RevokedClientCertificates, revoked)
+	}
+	return nil
+}
+
+// Convert_v1beta1_EtcdStorageSpec_To_v1alpha1_EtdcStorageSpec converts the v1beta1 spec type to the misspelled
+// v1alpha1 spec type. Conversion functions are not generated for types with different names.
+func Convert_v1beta1_EtcdStorageSpec_To_v1alpha1_EtdcStorageSpec(in *v1beta1.EtcdStorageSpec, out *EtdcStorageSpec, s conversion.Scope) error {
+	out.CACertConfigMaps = nil
+	for i := range in.CACertConfigMaps {
+		var dest CABundleDestination
+		if err := Convert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination(&in.CACertConfigMaps[i], &dest, s); err != nil {
+			return err
+		}
+		out.CACertConfigMaps = append(out.CACertConfigMaps, dest)
+	}
+	out.ClientCertSecrets = nil
+	for i := range in.ClientCertSecrets {
+		var dest ClientCertificateDestination
+		if err := Convert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination(&in.ClientCertSecrets[i], &dest, s); err != nil {
+			return err
+		}
+		out.ClientCertSecrets = append(out.ClientCertSecrets, dest)
+	}
+	out.SigningCertificateValidity = in.SigningCertificateValidity
+	out.ServingCertificateValidity = in.ServingCertificateValidity
+	out.ClientCertificateValidity = in.ClientCertificateValidity
+	out.CleanupPolicy = CleanupPolicy(in.CleanupPolicy)
+	out.DataRetentionPolicy = DataRetentionPolicy(in.DataRetentionPolicy)
+	out.Quota = nil
+	if in.Quota != nil {
+		out.Quota = &StorageQuota{}
+		if err := Convert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota(in.Quota, out.Quota, s); err != nil {
+			return err
+		}
+	}
+	out.ProxyTemplate = nil
+	if in.ProxyTemplate != nil {
+		out.ProxyTemplate = &ProxyTemplate{}
+		if err := Convert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate(in.ProxyTemplate, out.ProxyTemplate, s); err != nil {
+			return err
+		}
+	}
+	out.Issuer = nil
+	if in.Issuer != nil {
+		out.Issuer = &IssuerReference{}
+		if err := Convert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference(in.Issuer, out.Issuer, s); err != nil {
+			return err
+		}
+	}
+	out.KeyAlgorithm = KeyAlgorithm(in.KeyAlgorithm)
+	out.RevokedClientCertificates = nil
+	for i := range in.RevokedClientCertificates {
+		var revoked RevokedCertificate
+		if err := Convert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate(&in.RevokedClientCertificates[i], &revoked, s); err != nil {
+			return err
+		}
+		out.RevokedClientCertificates = append(out.RevokedClientCertificates, revoked)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestRoundTripConversion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	maxBytes := resource.MustParse("1Gi")
+	maxKeys := int64(1000)
+	replicas := int32(2)
+
+	tests := []struct {
+		name        string
+		etcdstorage *EtcdStorage
+	}{
+		{
+			name: "empty etcdstorage",
+			etcdstorage: &EtcdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+			},
+		},
+		{
+			name: "etcdstorage with all fields set",
+			etcdstorage: &EtcdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-2", Finalizers: []string{"etcd.xmudrii.com/cleanup"}},
+				Spec: EtdcStorageSpec{
+					CACertConfigMaps: []CABundleDestination{{Name: "etcd-ca", Namespace: "p1"}},
+					ClientCertSecrets: []ClientCertificateDestination{
+						{
+							Name:      "etcd-client",
+							Namespace: "p1",
+							Consumer:  &ConsumerReference{Kind: DeploymentConsumer, Name: "apiserver", Namespace: "p1"},
+						},
+					},
+					SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+					ServingCertificateValidity: metav1.Duration{Duration: 8 * time.Hour},
+					ClientCertificateValidity:  metav1.Duration{Duration: 8 * time.Hour},
+					CleanupPolicy:              CleanupPolicyRetain,
+					DataRetentionPolicy:        DataRetentionPolicySnapshot,
+					Quota:                      &StorageQuota{MaxBytes: &maxBytes, MaxKeys: &maxKeys, Enforcement: QuotaEnforcementScaleDown},
+					ProxyTemplate:              &ProxyTemplate{Replicas: &replicas, NodeSelector: map[string]string{"zone": "a"}},
+					Issuer:                     &IssuerReference{Name: "intermediate-ca", Namespace: "security"},
+					KeyAlgorithm:               KeyAlgorithmECDSAP256,
+					RevokedClientCertificates:  []RevokedCertificate{{SerialNumber: "3F2A9C"}},
+				},
+				Status: EtcdStorageStatus{
+					Conditions: []EtcdStorageCondition{
+						{Type: Deployed, Status: ConditionTrue, Reason: "Deployed", Message: "etcd-proxy deployed"},
+					},
+					Usage: &StorageUsage{Keys: 10, Bytes: 100},
+					ServerCertificates: &CertificateRotation{
+						Phase:          CertificateRotationLeafReissued,
+						Signer:         "etcd-test.kube-apiserver-storage.svc-server-signer-2",
+						PreviousSigner: "etcd-test.kube-apiserver-storage.svc-server-signer-1",
+					},
+					ClientCertificates: &CertificateRotation{
+						Signer:              "etcd-test.kube-apiserver-storage.svc-client-signer-1",
+						RevokedCertificates: []RevokedCertificate{{SerialNumber: "3F2A9C"}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			converted := &v1beta1.EtcdStorage{}
+			if err := scheme.Convert(tc.etcdstorage, converted, nil); err != nil {
+				t.Fatal(err)
+			}
+			if len(converted.Spec.CACertConfigMaps) != len(tc.etcdstorage.Spec.CACertConfigMaps) ||
+				len(converted.Spec.ClientCertSecrets) != len(tc.etcdstorage.Spec.ClientCertSecrets) {
+				t.Fatalf("expected destinations to be converted, but got %+v", converted.Spec)
+			}
+
+			roundTripped := &EtcdStorage{}
+			if err := scheme.Convert(converted, roundTripped, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.etcdstorage, roundTripped) {
+				t.Fatalf("expected etcdstorage %+v, but got %+v", tc.etcdstorage, roundTripped)
+			}
+		})
+	}
+}
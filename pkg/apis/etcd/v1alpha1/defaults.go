@@ -0,0 +1,25 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func addDefaultingFuncs(scheme *runtime.Scheme) error {
+	return RegisterDefaults(scheme)
+}
+
+// SetDefaults_EtdcStorageSpec sets default certificate validities for validities not set in the EtcdStorage spec.
+// Defaults are shared with the v1beta1 version.
+func SetDefaults_EtdcStorageSpec(obj *EtdcStorageSpec) {
+	if obj.SigningCertificateValidity.Duration == 0 {
+		obj.SigningCertificateValidity.Duration = v1beta1.DefaultSigningCertificateValidity
+	}
+	if obj.ServingCertificateValidity.Duration == 0 {
+		obj.ServingCertificateValidity.Duration = v1beta1.DefaultServingCertificateValidity
+	}
+	if obj.ClientCertificateValidity.Duration == 0 {
+		obj.ClientCertificateValidity.Duration = v1beta1.DefaultClientCertificateValidity
+	}
+}
@@ -1,4 +1,6 @@
 // +k8s:deepcopy-gen=package
+// +k8s:defaulter-gen=TypeMeta
+// +k8s:conversion-gen=github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1
 
 // Package v1alpha1 is the v1alpha1 version of the API.
 // +groupName=etcd.xmudrii.com
@@ -0,0 +1,402 @@
+// +build !ignore_autogenerated
+
+// Code generated by conversion-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	unsafe "unsafe"
+
+	v1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	conversion "k8s.io/apimachinery/pkg/conversion"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	localSchemeBuilder.Register(RegisterConversions)
+}
+
+// RegisterConversions adds conversion functions to the given scheme.
+// Public to allow building arbitrary schemes.
+func RegisterConversions(scheme *runtime.Scheme) error {
+	return scheme.AddGeneratedConversionFuncs(
+		Convert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination,
+		Convert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination,
+		Convert_v1alpha1_CertificateRotation_To_v1beta1_CertificateRotation,
+		Convert_v1beta1_CertificateRotation_To_v1alpha1_CertificateRotation,
+		Convert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination,
+		Convert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination,
+		Convert_v1alpha1_ConsumerReference_To_v1beta1_ConsumerReference,
+		Convert_v1beta1_ConsumerReference_To_v1alpha1_ConsumerReference,
+		Convert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage,
+		Convert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage,
+		Convert_v1alpha1_EtcdStorageCondition_To_v1beta1_EtcdStorageCondition,
+		Convert_v1beta1_EtcdStorageCondition_To_v1alpha1_EtcdStorageCondition,
+		Convert_v1alpha1_EtcdStorageList_To_v1beta1_EtcdStorageList,
+		Convert_v1beta1_EtcdStorageList_To_v1alpha1_EtcdStorageList,
+		Convert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus,
+		Convert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus,
+		Convert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference,
+		Convert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference,
+		Convert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate,
+		Convert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate,
+		Convert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate,
+		Convert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate,
+		Convert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota,
+		Convert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota,
+		Convert_v1alpha1_StorageUsage_To_v1beta1_StorageUsage,
+		Convert_v1beta1_StorageUsage_To_v1alpha1_StorageUsage,
+	)
+}
+
+func autoConvert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination(in *CABundleDestination, out *v1beta1.CABundleDestination, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination is an autogenerated conversion function.
+func Convert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination(in *CABundleDestination, out *v1beta1.CABundleDestination, s conversion.Scope) error {
+	return autoConvert_v1alpha1_CABundleDestination_To_v1beta1_CABundleDestination(in, out, s)
+}
+
+func autoConvert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination(in *v1beta1.CABundleDestination, out *CABundleDestination, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination is an autogenerated conversion function.
+func Convert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination(in *v1beta1.CABundleDestination, out *CABundleDestination, s conversion.Scope) error {
+	return autoConvert_v1beta1_CABundleDestination_To_v1alpha1_CABundleDestination(in, out, s)
+}
+
+func autoConvert_v1alpha1_CertificateRotation_To_v1beta1_CertificateRotation(in *CertificateRotation, out *v1beta1.CertificateRotation, s conversion.Scope) error {
+	out.Phase = v1beta1.CertificateRotationPhase(in.Phase)
+	out.Signer = in.Signer
+	out.PreviousSigner = in.PreviousSigner
+	out.LastTransitionTime = in.LastTransitionTime
+	out.RevokedCertificates = *(*[]v1beta1.RevokedCertificate)(unsafe.Pointer(&in.RevokedCertificates))
+	return nil
+}
+
+// Convert_v1alpha1_CertificateRotation_To_v1beta1_CertificateRotation is an autogenerated conversion function.
+func Convert_v1alpha1_CertificateRotation_To_v1beta1_CertificateRotation(in *CertificateRotation, out *v1beta1.CertificateRotation, s conversion.Scope) error {
+	return autoConvert_v1alpha1_CertificateRotation_To_v1beta1_CertificateRotation(in, out, s)
+}
+
+func autoConvert_v1beta1_CertificateRotation_To_v1alpha1_CertificateRotation(in *v1beta1.CertificateRotation, out *CertificateRotation, s conversion.Scope) error {
+	out.Phase = CertificateRotationPhase(in.Phase)
+	out.Signer = in.Signer
+	out.PreviousSigner = in.PreviousSigner
+	out.LastTransitionTime = in.LastTransitionTime
+	out.RevokedCertificates = *(*[]RevokedCertificate)(unsafe.Pointer(&in.RevokedCertificates))
+	return nil
+}
+
+// Convert_v1beta1_CertificateRotation_To_v1alpha1_CertificateRotation is an autogenerated conversion function.
+func Convert_v1beta1_CertificateRotation_To_v1alpha1_CertificateRotation(in *v1beta1.CertificateRotation, out *CertificateRotation, s conversion.Scope) error {
+	return autoConvert_v1beta1_CertificateRotation_To_v1alpha1_CertificateRotation(in, out, s)
+}
+
+func autoConvert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination(in *ClientCertificateDestination, out *v1beta1.ClientCertificateDestination, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Consumer = (*v1beta1.ConsumerReference)(unsafe.Pointer(in.Consumer))
+	return nil
+}
+
+// Convert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination is an autogenerated conversion function.
+func Convert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination(in *ClientCertificateDestination, out *v1beta1.ClientCertificateDestination, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ClientCertificateDestination_To_v1beta1_ClientCertificateDestination(in, out, s)
+}
+
+func autoConvert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination(in *v1beta1.ClientCertificateDestination, out *ClientCertificateDestination, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Consumer = (*ConsumerReference)(unsafe.Pointer(in.Consumer))
+	return nil
+}
+
+// Convert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination is an autogenerated conversion function.
+func Convert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination(in *v1beta1.ClientCertificateDestination, out *ClientCertificateDestination, s conversion.Scope) error {
+	return autoConvert_v1beta1_ClientCertificateDestination_To_v1alpha1_ClientCertificateDestination(in, out, s)
+}
+
+func autoConvert_v1alpha1_ConsumerReference_To_v1beta1_ConsumerReference(in *ConsumerReference, out *v1beta1.ConsumerReference, s conversion.Scope) error {
+	out.Kind = v1beta1.ConsumerKind(in.Kind)
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1alpha1_ConsumerReference_To_v1beta1_ConsumerReference is an autogenerated conversion function.
+func Convert_v1alpha1_ConsumerReference_To_v1beta1_ConsumerReference(in *ConsumerReference, out *v1beta1.ConsumerReference, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ConsumerReference_To_v1beta1_ConsumerReference(in, out, s)
+}
+
+func autoConvert_v1beta1_ConsumerReference_To_v1alpha1_ConsumerReference(in *v1beta1.ConsumerReference, out *ConsumerReference, s conversion.Scope) error {
+	out.Kind = ConsumerKind(in.Kind)
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1beta1_ConsumerReference_To_v1alpha1_ConsumerReference is an autogenerated conversion function.
+func Convert_v1beta1_ConsumerReference_To_v1alpha1_ConsumerReference(in *v1beta1.ConsumerReference, out *ConsumerReference, s conversion.Scope) error {
+	return autoConvert_v1beta1_ConsumerReference_To_v1alpha1_ConsumerReference(in, out, s)
+}
+
+func autoConvert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage(in *EtcdStorage, out *v1beta1.EtcdStorage, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	if err := Convert_v1alpha1_EtdcStorageSpec_To_v1beta1_EtcdStorageSpec(&in.Spec, &out.Spec, s); err != nil {
+		return err
+	}
+	if err := Convert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus(&in.Status, &out.Status, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage is an autogenerated conversion function.
+func Convert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage(in *EtcdStorage, out *v1beta1.EtcdStorage, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage(in, out, s)
+}
+
+func autoConvert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage(in *v1beta1.EtcdStorage, out *EtcdStorage, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	if err := Convert_v1beta1_EtcdStorageSpec_To_v1alpha1_EtdcStorageSpec(&in.Spec, &out.Spec, s); err != nil {
+		return err
+	}
+	if err := Convert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus(&in.Status, &out.Status, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage is an autogenerated conversion function.
+func Convert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage(in *v1beta1.EtcdStorage, out *EtcdStorage, s conversion.Scope) error {
+	return autoConvert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage(in, out, s)
+}
+
+func autoConvert_v1alpha1_EtcdStorageCondition_To_v1beta1_EtcdStorageCondition(in *EtcdStorageCondition, out *v1beta1.EtcdStorageCondition, s conversion.Scope) error {
+	out.Type = v1beta1.EtcdStorageConditionType(in.Type)
+	out.Status = v1beta1.ConditionStatus(in.Status)
+	out.LastTransitionTime = in.LastTransitionTime
+	out.Reason = in.Reason
+	out.Message = in.Message
+	return nil
+}
+
+// Convert_v1alpha1_EtcdStorageCondition_To_v1beta1_EtcdStorageCondition is an autogenerated conversion function.
+func Convert_v1alpha1_EtcdStorageCondition_To_v1beta1_EtcdStorageCondition(in *EtcdStorageCondition, out *v1beta1.EtcdStorageCondition, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EtcdStorageCondition_To_v1beta1_EtcdStorageCondition(in, out, s)
+}
+
+func autoConvert_v1beta1_EtcdStorageCondition_To_v1alpha1_EtcdStorageCondition(in *v1beta1.EtcdStorageCondition, out *EtcdStorageCondition, s conversion.Scope) error {
+	out.Type = EtcdStorageConditionType(in.Type)
+	out.Status = ConditionStatus(in.Status)
+	out.LastTransitionTime = in.LastTransitionTime
+	out.Reason = in.Reason
+	out.Message = in.Message
+	return nil
+}
+
+// Convert_v1beta1_EtcdStorageCondition_To_v1alpha1_EtcdStorageCondition is an autogenerated conversion function.
+func Convert_v1beta1_EtcdStorageCondition_To_v1alpha1_EtcdStorageCondition(in *v1beta1.EtcdStorageCondition, out *EtcdStorageCondition, s conversion.Scope) error {
+	return autoConvert_v1beta1_EtcdStorageCondition_To_v1alpha1_EtcdStorageCondition(in, out, s)
+}
+
+func autoConvert_v1alpha1_EtcdStorageList_To_v1beta1_EtcdStorageList(in *EtcdStorageList, out *v1beta1.EtcdStorageList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1beta1.EtcdStorage, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha1_EtcdStorage_To_v1beta1_EtcdStorage(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
+	return nil
+}
+
+// Convert_v1alpha1_EtcdStorageList_To_v1beta1_EtcdStorageList is an autogenerated conversion function.
+func Convert_v1alpha1_EtcdStorageList_To_v1beta1_EtcdStorageList(in *EtcdStorageList, out *v1beta1.EtcdStorageList, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EtcdStorageList_To_v1beta1_EtcdStorageList(in, out, s)
+}
+
+func autoConvert_v1beta1_EtcdStorageList_To_v1alpha1_EtcdStorageList(in *v1beta1.EtcdStorageList, out *EtcdStorageList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EtcdStorage, len(*in))
+		for i := range *in {
+			if err := Convert_v1beta1_EtcdStorage_To_v1alpha1_EtcdStorage(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
+	return nil
+}
+
+// Convert_v1beta1_EtcdStorageList_To_v1alpha1_EtcdStorageList is an autogenerated conversion function.
+func Convert_v1beta1_EtcdStorageList_To_v1alpha1_EtcdStorageList(in *v1beta1.EtcdStorageList, out *EtcdStorageList, s conversion.Scope) error {
+	return autoConvert_v1beta1_EtcdStorageList_To_v1alpha1_EtcdStorageList(in, out, s)
+}
+
+func autoConvert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus(in *EtcdStorageStatus, out *v1beta1.EtcdStorageStatus, s conversion.Scope) error {
+	out.Conditions = *(*[]v1beta1.EtcdStorageCondition)(unsafe.Pointer(&in.Conditions))
+	out.Usage = (*v1beta1.StorageUsage)(unsafe.Pointer(in.Usage))
+	out.ServerCertificates = (*v1beta1.CertificateRotation)(unsafe.Pointer(in.ServerCertificates))
+	out.ClientCertificates = (*v1beta1.CertificateRotation)(unsafe.Pointer(in.ClientCertificates))
+	return nil
+}
+
+// Convert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus is an autogenerated conversion function.
+func Convert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus(in *EtcdStorageStatus, out *v1beta1.EtcdStorageStatus, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EtcdStorageStatus_To_v1beta1_EtcdStorageStatus(in, out, s)
+}
+
+func autoConvert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus(in *v1beta1.EtcdStorageStatus, out *EtcdStorageStatus, s conversion.Scope) error {
+	out.Conditions = *(*[]EtcdStorageCondition)(unsafe.Pointer(&in.Conditions))
+	out.Usage = (*StorageUsage)(unsafe.Pointer(in.Usage))
+	out.ServerCertificates = (*CertificateRotation)(unsafe.Pointer(in.ServerCertificates))
+	out.ClientCertificates = (*CertificateRotation)(unsafe.Pointer(in.ClientCertificates))
+	return nil
+}
+
+// Convert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus is an autogenerated conversion function.
+func Convert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus(in *v1beta1.EtcdStorageStatus, out *EtcdStorageStatus, s conversion.Scope) error {
+	return autoConvert_v1beta1_EtcdStorageStatus_To_v1alpha1_EtcdStorageStatus(in, out, s)
+}
+
+func autoConvert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference(in *IssuerReference, out *v1beta1.IssuerReference, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference is an autogenerated conversion function.
+func Convert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference(in *IssuerReference, out *v1beta1.IssuerReference, s conversion.Scope) error {
+	return autoConvert_v1alpha1_IssuerReference_To_v1beta1_IssuerReference(in, out, s)
+}
+
+func autoConvert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference(in *v1beta1.IssuerReference, out *IssuerReference, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	return nil
+}
+
+// Convert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference is an autogenerated conversion function.
+func Convert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference(in *v1beta1.IssuerReference, out *IssuerReference, s conversion.Scope) error {
+	return autoConvert_v1beta1_IssuerReference_To_v1alpha1_IssuerReference(in, out, s)
+}
+
+func autoConvert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate(in *ProxyTemplate, out *v1beta1.ProxyTemplate, s conversion.Scope) error {
+	out.Replicas = (*int32)(unsafe.Pointer(in.Replicas))
+	out.Resources = in.Resources
+	out.NodeSelector = *(*map[string]string)(unsafe.Pointer(&in.NodeSelector))
+	out.Tolerations = *(*[]v1.Toleration)(unsafe.Pointer(&in.Tolerations))
+	out.Affinity = (*v1.Affinity)(unsafe.Pointer(in.Affinity))
+	out.PriorityClassName = in.PriorityClassName
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	return nil
+}
+
+// Convert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate is an autogenerated conversion function.
+func Convert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate(in *ProxyTemplate, out *v1beta1.ProxyTemplate, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ProxyTemplate_To_v1beta1_ProxyTemplate(in, out, s)
+}
+
+func autoConvert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate(in *v1beta1.ProxyTemplate, out *ProxyTemplate, s conversion.Scope) error {
+	out.Replicas = (*int32)(unsafe.Pointer(in.Replicas))
+	out.Resources = in.Resources
+	out.NodeSelector = *(*map[string]string)(unsafe.Pointer(&in.NodeSelector))
+	out.Tolerations = *(*[]v1.Toleration)(unsafe.Pointer(&in.Tolerations))
+	out.Affinity = (*v1.Affinity)(unsafe.Pointer(in.Affinity))
+	out.PriorityClassName = in.PriorityClassName
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	return nil
+}
+
+// Convert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate is an autogenerated conversion function.
+func Convert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate(in *v1beta1.ProxyTemplate, out *ProxyTemplate, s conversion.Scope) error {
+	return autoConvert_v1beta1_ProxyTemplate_To_v1alpha1_ProxyTemplate(in, out, s)
+}
+
+func autoConvert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate(in *RevokedCertificate, out *v1beta1.RevokedCertificate, s conversion.Scope) error {
+	out.SerialNumber = in.SerialNumber
+	return nil
+}
+
+// Convert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate is an autogenerated conversion function.
+func Convert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate(in *RevokedCertificate, out *v1beta1.RevokedCertificate, s conversion.Scope) error {
+	return autoConvert_v1alpha1_RevokedCertificate_To_v1beta1_RevokedCertificate(in, out, s)
+}
+
+func autoConvert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate(in *v1beta1.RevokedCertificate, out *RevokedCertificate, s conversion.Scope) error {
+	out.SerialNumber = in.SerialNumber
+	return nil
+}
+
+// Convert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate is an autogenerated conversion function.
+func Convert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate(in *v1beta1.RevokedCertificate, out *RevokedCertificate, s conversion.Scope) error {
+	return autoConvert_v1beta1_RevokedCertificate_To_v1alpha1_RevokedCertificate(in, out, s)
+}
+
+func autoConvert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota(in *StorageQuota, out *v1beta1.StorageQuota, s conversion.Scope) error {
+	out.MaxBytes = (*resource.Quantity)(unsafe.Pointer(in.MaxBytes))
+	out.MaxKeys = (*int64)(unsafe.Pointer(in.MaxKeys))
+	out.Enforcement = v1beta1.QuotaEnforcement(in.Enforcement)
+	return nil
+}
+
+// Convert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota is an autogenerated conversion function.
+func Convert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota(in *StorageQuota, out *v1beta1.StorageQuota, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StorageQuota_To_v1beta1_StorageQuota(in, out, s)
+}
+
+func autoConvert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota(in *v1beta1.StorageQuota, out *StorageQuota, s conversion.Scope) error {
+	out.MaxBytes = (*resource.Quantity)(unsafe.Pointer(in.MaxBytes))
+	out.MaxKeys = (*int64)(unsafe.Pointer(in.MaxKeys))
+	out.Enforcement = QuotaEnforcement(in.Enforcement)
+	return nil
+}
+
+// Convert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota is an autogenerated conversion function.
+func Convert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota(in *v1beta1.StorageQuota, out *StorageQuota, s conversion.Scope) error {
+	return autoConvert_v1beta1_StorageQuota_To_v1alpha1_StorageQuota(in, out, s)
+}
+
+func autoConvert_v1alpha1_StorageUsage_To_v1beta1_StorageUsage(in *StorageUsage, out *v1beta1.StorageUsage, s conversion.Scope) error {
+	out.Keys = in.Keys
+	out.Bytes = in.Bytes
+	out.LastMeasuredTime = in.LastMeasuredTime
+	return nil
+}
+
+// Convert_v1alpha1_StorageUsage_To_v1beta1_StorageUsage is an autogenerated conversion function.
+func Convert_v1alpha1_StorageUsage_To_v1beta1_StorageUsage(in *StorageUsage, out *v1beta1.StorageUsage, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StorageUsage_To_v1beta1_StorageUsage(in, out, s)
+}
+
+func autoConvert_v1beta1_StorageUsage_To_v1alpha1_StorageUsage(in *v1beta1.StorageUsage, out *StorageUsage, s conversion.Scope) error {
+	out.Keys = in.Keys
+	out.Bytes = in.Bytes
+	out.LastMeasuredTime = in.LastMeasuredTime
+	return nil
+}
+
+// Convert_v1beta1_StorageUsage_To_v1alpha1_StorageUsage is an autogenerated conversion function.
+func Convert_v1beta1_StorageUsage_To_v1alpha1_StorageUsage(in *v1beta1.StorageUsage, out *StorageUsage, s conversion.Scope) error {
+	return autoConvert_v1beta1_StorageUsage_To_v1alpha1_StorageUsage(in, out, s)
+}
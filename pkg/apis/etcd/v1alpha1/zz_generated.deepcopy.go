@@ -5,6 +5,7 @@
 package v1alpha1
 
 import (
+	v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -24,9 +25,36 @@ func (in *CABundleDestination) DeepCopy() *CABundleDestination {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateRotation) DeepCopyInto(out *CertificateRotation) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	if in.RevokedCertificates != nil {
+		in, out := &in.RevokedCertificates, &out.RevokedCertificates
+		*out = make([]RevokedCertificate, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateRotation.
+func (in *CertificateRotation) DeepCopy() *CertificateRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClientCertificateDestination) DeepCopyInto(out *ClientCertificateDestination) {
 	*out = *in
+	if in.Consumer != nil {
+		in, out := &in.Consumer, &out.Consumer
+		*out = new(ConsumerReference)
+		**out = **in
+	}
 	return
 }
 
@@ -40,6 +68,22 @@ func (in *ClientCertificateDestination) DeepCopy() *ClientCertificateDestination
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerReference) DeepCopyInto(out *ConsumerReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerReference.
+func (in *ConsumerReference) DeepCopy() *ConsumerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EtcdStorage) DeepCopyInto(out *EtcdStorage) {
 	*out = *in
@@ -128,6 +172,21 @@ func (in *EtcdStorageStatus) DeepCopyInto(out *EtcdStorageStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = new(StorageUsage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServerCertificates != nil {
+		in, out := &in.ServerCertificates, &out.ServerCertificates
+		*out = new(CertificateRotation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCertificates != nil {
+		in, out := &in.ClientCertificates, &out.ClientCertificates
+		*out = new(CertificateRotation)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -152,11 +211,33 @@ func (in *EtdcStorageSpec) DeepCopyInto(out *EtdcStorageSpec) {
 	if in.ClientCertSecrets != nil {
 		in, out := &in.ClientCertSecrets, &out.ClientCertSecrets
 		*out = make([]ClientCertificateDestination, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	out.SigningCertificateValidity = in.SigningCertificateValidity
 	out.ServingCertificateValidity = in.ServingCertificateValidity
 	out.ClientCertificateValidity = in.ClientCertificateValidity
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(StorageQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProxyTemplate != nil {
+		in, out := &in.ProxyTemplate, &out.ProxyTemplate
+		*out = new(ProxyTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Issuer != nil {
+		in, out := &in.Issuer, &out.Issuer
+		*out = new(IssuerReference)
+		**out = **in
+	}
+	if in.RevokedClientCertificates != nil {
+		in, out := &in.RevokedClientCertificates, &out.RevokedClientCertificates
+		*out = make([]RevokedCertificate, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -169,3 +250,133 @@ func (in *EtdcStorageSpec) DeepCopy() *EtdcStorageSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerReference) DeepCopyInto(out *IssuerReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerReference.
+func (in *IssuerReference) DeepCopy() *IssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyTemplate) DeepCopyInto(out *ProxyTemplate) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyTemplate.
+func (in *ProxyTemplate) DeepCopy() *ProxyTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevokedCertificate) DeepCopyInto(out *RevokedCertificate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevokedCertificate.
+func (in *RevokedCertificate) DeepCopy() *RevokedCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(RevokedCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageQuota) DeepCopyInto(out *StorageQuota) {
+	*out = *in
+	if in.MaxBytes != nil {
+		in, out := &in.MaxBytes, &out.MaxBytes
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxKeys != nil {
+		in, out := &in.MaxKeys, &out.MaxKeys
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageQuota.
+func (in *StorageQuota) DeepCopy() *StorageQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageUsage) DeepCopyInto(out *StorageUsage) {
+	*out = *in
+	in.LastMeasuredTime.DeepCopyInto(&out.LastMeasuredTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageUsage.
+func (in *StorageUsage) DeepCopy() *StorageUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageUsage)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,35 @@
+package v1beta1
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Default certificate validities, used if the validity is not set in the EtcdStorage spec.
+// The controller allows overriding them cluster-wide using flags.
+const (
+	// DefaultSigningCertificateValidity is the default validity of signing certificates.
+	DefaultSigningCertificateValidity = 365 * 24 * time.Hour
+	// DefaultServingCertificateValidity is the default validity of serving certificates.
+	DefaultServingCertificateValidity = 30 * 24 * time.Hour
+	// DefaultClientCertificateValidity is the default validity of client certificates.
+	DefaultClientCertificateValidity = 30 * 24 * time.Hour
+)
+
+func addDefaultingFuncs(scheme *runtime.Scheme) error {
+	return RegisterDefaults(scheme)
+}
+
+// SetDefaults_EtcdStorageSpec sets default certificate validities for validities not set in the EtcdStorage spec.
+func SetDefaults_EtcdStorageSpec(obj *EtcdStorageSpec) {
+	if obj.SigningCertificateValidity.Duration == 0 {
+		obj.SigningCertificateValidity.Duration = DefaultSigningCertificateValidity
+	}
+	if obj.ServingCertificateValidity.Duration == 0 {
+		obj.ServingCertificateValidity.Duration = DefaultServingCertificateValidity
+	}
+	if obj.ClientCertificateValidity.Duration == 0 {
+		obj.ClientCertificateValidity.Duration = DefaultClientCertificateValidity
+	}
+}
@@ -0,0 +1,68 @@
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSetDefaultsEtcdStorageSpec(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		spec         EtcdStorageSpec
+		expectedSpec EtcdStorageSpec
+	}{
+		{
+			name: "validities not set",
+			expectedSpec: EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{Duration: DefaultSigningCertificateValidity},
+				ServingCertificateValidity: metav1.Duration{Duration: DefaultServingCertificateValidity},
+				ClientCertificateValidity:  metav1.Duration{Duration: DefaultClientCertificateValidity},
+			},
+		},
+		{
+			name: "validities set",
+			spec: EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+				ServingCertificateValidity: metav1.Duration{Duration: time.Hour},
+				ClientCertificateValidity:  metav1.Duration{Duration: 2 * time.Hour},
+			},
+			expectedSpec: EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+				ServingCertificateValidity: metav1.Duration{Duration: time.Hour},
+				ClientCertificateValidity:  metav1.Duration{Duration: 2 * time.Hour},
+			},
+		},
+		{
+			name: "signing validity set",
+			spec: EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			expectedSpec: EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+				ServingCertificateValidity: metav1.Duration{Duration: DefaultServingCertificateValidity},
+				ClientCertificateValidity:  metav1.Duration{Duration: DefaultClientCertificateValidity},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es := &EtcdStorage{Spec: tc.spec}
+			scheme.Default(es)
+
+			if es.Spec.SigningCertificateValidity != tc.expectedSpec.SigningCertificateValidity ||
+				es.Spec.ServingCertificateValidity != tc.expectedSpec.ServingCertificateValidity ||
+				es.Spec.ClientCertificateValidity != tc.expectedSpec.ClientCertificateValidity {
+				t.Fatalf("expected spec %+v, but got %+v", tc.expectedSpec, es.Spec)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// +k8s:deepcopy-gen=package
+// +k8s:defaulter-gen=TypeMeta
+
+// Package v1beta1 is the v1beta1 version of the API.
+// +groupName=etcd.xmudrii.com
+package v1beta1
@@ -0,0 +1,346 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionStatus represents status of the EtcdStorage condition.
+type ConditionStatus string
+
+// These are valid condition statuses: ConditionTrue, ConditionFalse, ConditionUnknown.
+const (
+	// ConditionTrue means a resource is in the condition.
+	ConditionTrue ConditionStatus = "True"
+	// ConditionFalse means a resource is not in the condition.
+	ConditionFalse ConditionStatus = "False"
+	// ConditionUnknown means controller can't decide if a EtcdStorage resource is in the condition or not.
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// EtcdStorageConditionType represents condition of the EtcdStorage resource.
+type EtcdStorageConditionType string
+
+const (
+	// Deployed means EtcdProxy Deployment and Service for exposing EtcdProxy are created.
+	Deployed EtcdStorageConditionType = "Deployed"
+	// Available means at least one etcd-proxy pod is available and exposed by the etcd-proxy Service.
+	Available EtcdStorageConditionType = "Available"
+	// Progressing means the etcd-proxy Deployment is rolling out etcd-proxy pods.
+	Progressing EtcdStorageConditionType = "Progressing"
+	// CertificatesReady means certificates and CA bundles are generated and deployed.
+	CertificatesReady EtcdStorageConditionType = "CertificatesReady"
+	// QuotaExceeded means the data stored in the core etcd under the EtcdStorage prefix exceeds the EtcdStorage quota.
+	QuotaExceeded EtcdStorageConditionType = "QuotaExceeded"
+	// DataSnapshotFailed means the data stored in the core etcd under the EtcdStorage prefix can't be exported
+	// while enforcing the Snapshot data retention policy, so the EtcdStorage can't be deleted.
+	DataSnapshotFailed EtcdStorageConditionType = "DataSnapshotFailed"
+)
+
+// CABundleDestination contains name and namespace of configmap where CA bundle is stored.
+type CABundleDestination struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// ClientCertificateDestination contains name and namespace of secret where client certificate and key are stored.
+type ClientCertificateDestination struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+
+	// Consumer is an optional reference to the workload using the client certificate. When the client certificate
+	// is rotated, the controller updates the workload pod template, so pods are restarted and pick up the new certificate.
+	Consumer *ConsumerReference `json:"consumer,omitempty"`
+}
+
+// IssuerReference contains name and namespace of the Secret where the CA certificate and key used to sign
+// etcd-proxy certificates are stored.
+type IssuerReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// RevokedCertificate contains the serial number of the revoked Client certificate.
+type RevokedCertificate struct {
+	// SerialNumber is the hexadecimal serial number of the revoked certificate, as printed by
+	// 'openssl x509 -serial'. Bytes of the serial number can be separated by colons.
+	SerialNumber string `json:"serialNumber"`
+}
+
+// KeyAlgorithm represents the algorithm used to generate private keys of etcd-proxy certificates.
+type KeyAlgorithm string
+
+// These are valid key algorithms: KeyAlgorithmRSA2048, KeyAlgorithmRSA3072, KeyAlgorithmRSA4096,
+// KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384, KeyAlgorithmEd25519.
+const (
+	// KeyAlgorithmRSA2048 means 2048-bit RSA keys are generated.
+	KeyAlgorithmRSA2048 KeyAlgorithm = "RSA-2048"
+	// KeyAlgorithmRSA3072 means 3072-bit RSA keys are generated.
+	KeyAlgorithmRSA3072 KeyAlgorithm = "RSA-3072"
+	// KeyAlgorithmRSA4096 means 4096-bit RSA keys are generated.
+	KeyAlgorithmRSA4096 KeyAlgorithm = "RSA-4096"
+	// KeyAlgorithmECDSAP256 means ECDSA keys using the P-256 curve are generated.
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ECDSA-P256"
+	// KeyAlgorithmECDSAP384 means ECDSA keys using the P-384 curve are generated.
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ECDSA-P384"
+	// KeyAlgorithmEd25519 means Ed25519 keys are generated.
+	KeyAlgorithmEd25519 KeyAlgorithm = "Ed25519"
+)
+
+// ConsumerKind represents kind of the workload using the client certificate.
+type ConsumerKind string
+
+// These are valid consumer kinds: DeploymentConsumer, StatefulSetConsumer.
+const (
+	// DeploymentConsumer means the client certificate is used by a Deployment.
+	DeploymentConsumer ConsumerKind = "Deployment"
+	// StatefulSetConsumer means the client certificate is used by a StatefulSet.
+	StatefulSetConsumer ConsumerKind = "StatefulSet"
+)
+
+// ConsumerReference contains kind, name and namespace of the workload using the client certificate.
+type ConsumerReference struct {
+	Kind      ConsumerKind `json:"kind"`
+	Name      string       `json:"name"`
+	Namespace string       `json:"namespace"`
+}
+
+// CleanupPolicy describes what happens with Secrets and ConfigMaps managed by the controller when the EtcdStorage
+// resource is deleted.
+type CleanupPolicy string
+
+// These are valid cleanup policies: CleanupPolicyDelete, CleanupPolicyRetain, CleanupPolicyOrphan.
+const (
+	// CleanupPolicyDelete means Secrets and ConfigMaps managed by the controller are deleted. Secrets and ConfigMaps
+	// not created by the controller are kept, but certificates and controller annotations are removed from them.
+	CleanupPolicyDelete CleanupPolicy = "Delete"
+	// CleanupPolicyRetain means Secrets and ConfigMaps managed by the controller are kept unchanged.
+	CleanupPolicyRetain CleanupPolicy = "Retain"
+	// CleanupPolicyOrphan means Secrets and ConfigMaps are kept along with certificates, but the controller annotations
+	// are removed from them, so they're not considered managed by the controller anymore.
+	CleanupPolicyOrphan CleanupPolicy = "Orphan"
+)
+
+// DataRetentionPolicy describes what happens with the data stored in the core etcd under the EtcdStorage prefix
+// when the EtcdStorage resource is deleted.
+type DataRetentionPolicy string
+
+// These are valid data retention policies: DataRetentionPolicyRetain, DataRetentionPolicyDelete,
+// DataRetentionPolicySnapshot.
+const (
+	// DataRetentionPolicyRetain means the data is kept in the core etcd.
+	DataRetentionPolicyRetain DataRetentionPolicy = "Retain"
+	// DataRetentionPolicyDelete means all keys under the EtcdStorage prefix are deleted from the core etcd.
+	DataRetentionPolicyDelete DataRetentionPolicy = "Delete"
+	// DataRetentionPolicySnapshot means all keys under the EtcdStorage prefix are exported to a Secret in
+	// the controller namespace, and then deleted from the core etcd.
+	DataRetentionPolicySnapshot DataRetentionPolicy = "Snapshot"
+)
+
+// QuotaEnforcement describes what happens when the data stored in the core etcd under the EtcdStorage prefix
+// exceeds the EtcdStorage quota.
+type QuotaEnforcement string
+
+// These are valid quota enforcements: QuotaEnforcementReport, QuotaEnforcementScaleDown.
+const (
+	// QuotaEnforcementReport means the QuotaExceeded condition is set and Warning Events are recorded.
+	QuotaEnforcementReport QuotaEnforcement = "Report"
+	// QuotaEnforcementScaleDown means, in addition to reporting, the etcd-proxy Deployment is scaled to zero
+	// replicas until the usage is within the quota again.
+	QuotaEnforcementScaleDown QuotaEnforcement = "ScaleDown"
+)
+
+// StorageQuota limits the data stored in the core etcd under the EtcdStorage prefix.
+type StorageQuota struct {
+	// MaxBytes is the maximum approximate size of keys and values stored under the EtcdStorage prefix.
+	MaxBytes *resource.Quantity `json:"maxBytes,omitempty"`
+
+	// MaxKeys is the maximum number of keys stored under the EtcdStorage prefix.
+	MaxKeys *int64 `json:"maxKeys,omitempty"`
+
+	// Enforcement defines what happens when the quota is exceeded. Defaults to Report.
+	Enforcement QuotaEnforcement `json:"enforcement,omitempty"`
+}
+
+// CertificateRotationPhase is the phase of rotating the CA certificate signing etcd-proxy certificates.
+type CertificateRotationPhase string
+
+// These are valid certificate rotation phases, in the order they are reached.
+const (
+	// CertificateRotationCADistributed means the new CA certificate is distributed in CA bundles, while certificates
+	// signed by the previous CA certificate are still in use.
+	CertificateRotationCADistributed CertificateRotationPhase = "CADistributed"
+	// CertificateRotationLeafReissued means all certificates are reissued using the new CA certificate, while
+	// the previous CA certificate is still trusted.
+	CertificateRotationLeafReissued CertificateRotationPhase = "LeafReissued"
+	// CertificateRotationOldCARemoved means the previous CA certificate is removed from CA bundles.
+	CertificateRotationOldCARemoved CertificateRotationPhase = "OldCARemoved"
+)
+
+// CertificateRotation contains the state of rotating the CA certificate signing etcd-proxy certificates.
+type CertificateRotation struct {
+	// Phase is the phase of the latest rotation. Empty if the CA certificate has never been rotated.
+	Phase CertificateRotationPhase `json:"phase,omitempty"`
+
+	// Signer is the common name of the CA certificate signing current certificates.
+	Signer string `json:"signer,omitempty"`
+
+	// PreviousSigner is the common name of the CA certificate being rotated out.
+	PreviousSigner string `json:"previousSigner,omitempty"`
+
+	// LastTransitionTime is the time when the phase last changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// RevokedCertificates contains serial numbers of Client certificates revoked by the rotation. They are
+	// no longer trusted once the rotation is in the OldCARemoved phase, as all previous signers are removed from
+	// the Client CA bundle.
+	RevokedCertificates []RevokedCertificate `json:"revokedCertificates,omitempty"`
+}
+
+// StorageUsage contains the usage of the core etcd under the EtcdStorage prefix, as measured by the controller.
+type StorageUsage struct {
+	// Keys is the number of keys stored under the EtcdStorage prefix.
+	Keys int64 `json:"keys"`
+
+	// Bytes is the approximate size of keys and values stored under the EtcdStorage prefix.
+	Bytes int64 `json:"bytes"`
+
+	// LastMeasuredTime is the time when the usage was measured.
+	LastMeasuredTime metav1.Time `json:"lastMeasuredTime"`
+}
+
+// ProxyTemplate customizes the etcd-proxy Deployment and pods created for the EtcdStorage.
+type ProxyTemplate struct {
+	// Replicas is the number of etcd-proxy pods. Defaults to 3.
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Resources are compute resources required by the etcd-proxy container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector must match node labels for etcd-proxy pods to be scheduled on that node.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations are tolerations of etcd-proxy pods.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity are scheduling constraints of etcd-proxy pods, e.g. to spread them across zones.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName is the priority class of etcd-proxy pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Labels are additional labels set on etcd-proxy pods.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are additional annotations set on etcd-proxy pods.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EtcdStorage is a specification for a EtcdStorage resource
+type EtcdStorage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdStorageSpec   `json:"spec"`
+	Status EtcdStorageStatus `json:"status,omitempty"`
+}
+
+// EtcdStorageSpec is the spec for a EtcdStorage resource
+type EtcdStorageSpec struct {
+	// CACertConfigMaps contains names and namespaces of ConfigMaps where the CA serving certificate for etcd-proxy pods
+	// is supposed to be deployed. Usually they are in the aggregated API server namespace.
+	CACertConfigMaps []CABundleDestination `json:"caCertConfigMaps,omitempty"`
+
+	// ClientCertSecrets contains names and namespaces of Secrets where the client certificate and key for etcd-proxy
+	// pods are supposed to be deployed. Usually they are in the aggregated API server namespace.
+	ClientCertSecrets []ClientCertificateDestination `json:"clientCertSecrets,omitempty"`
+
+	// SigningCertificateValidity is how long the self-generated signing certificate is valid. Defaults to one year.
+	SigningCertificateValidity metav1.Duration `json:"signingCertificateValidity,omitempty"`
+
+	// ServingCertificateValidity is how long the serving certificate/key pair is valid. Defaults to 30 days.
+	ServingCertificateValidity metav1.Duration `json:"servingCertificateValidity,omitempty"`
+
+	// ClientCertificateValidity is how long the client certificate/key pair is valid. Defaults to 30 days.
+	ClientCertificateValidity metav1.Duration `json:"clientCertificateValidity,omitempty"`
+
+	// CleanupPolicy defines what happens with Secrets and ConfigMaps managed by the controller when the EtcdStorage
+	// is deleted. Defaults to Delete. Data snapshot Secrets are kept regardless of the policy.
+	CleanupPolicy CleanupPolicy `json:"cleanupPolicy,omitempty"`
+
+	// DataRetentionPolicy defines what happens with the data stored in the core etcd under the EtcdStorage prefix
+	// when the EtcdStorage is deleted. Defaults to Retain.
+	DataRetentionPolicy DataRetentionPolicy `json:"dataRetentionPolicy,omitempty"`
+
+	// Quota limits the data stored in the core etcd under the EtcdStorage prefix. The usage is measured
+	// periodically by the controller. If not set, the usage is not limited.
+	Quota *StorageQuota `json:"quota,omitempty"`
+
+	// ProxyTemplate customizes the etcd-proxy Deployment and pods, such as the number of replicas, compute
+	// resources and scheduling constraints.
+	ProxyTemplate *ProxyTemplate `json:"proxyTemplate,omitempty"`
+
+	// Issuer references the TLS Secret containing the intermediate CA certificate and key used to sign Server and
+	// Client certificates, instead of self-generated signing certificates. The tls.crt key may contain the rest of
+	// the certificate chain after the intermediate CA certificate. If not set, signing certificates are generated
+	// by the controller.
+	Issuer *IssuerReference `json:"issuer,omitempty"`
+
+	// KeyAlgorithm is the algorithm used to generate private keys of signing, Server and Client certificates.
+	// Certificates are signed using the signature algorithm matching the key of the signing certificate.
+	// Defaults to RSA-2048.
+	KeyAlgorithm KeyAlgorithm `json:"keyAlgorithm,omitempty"`
+
+	// RevokedClientCertificates contains serial numbers of revoked Client certificates. The controller revokes
+	// them by rotating the self-generated Client signer: all Client certificates are reissued by the new Client
+	// signer, and previous signers are removed from the Client CA bundle, so etcd-proxy pods reject connections
+	// using revoked certificates. Serial numbers of issued Client certificates are stored in the
+	// 'etcd.xmudrii.com/certificate-serial-number' annotation of Client certificate Secrets. Secrets holding
+	// a revoked certificate are not reissued, but they should be removed from ClientCertSecrets as well.
+	RevokedClientCertificates []RevokedCertificate `json:"revokedClientCertificates,omitempty"`
+}
+
+// EtcdStorageStatus is the status for a EtcdStorage resource
+type EtcdStorageStatus struct {
+	// Conditions indicates states of the EtcdStorage.
+	Conditions []EtcdStorageCondition `json:"conditions,omitempty"`
+
+	// Usage is the last measured usage of the core etcd under the EtcdStorage prefix.
+	Usage *StorageUsage `json:"usage,omitempty"`
+
+	// ServerCertificates is the state of rotating the CA certificate signing the etcd-proxy Server certificate.
+	ServerCertificates *CertificateRotation `json:"serverCertificates,omitempty"`
+
+	// ClientCertificates is the state of rotating the CA certificate signing etcd-proxy Client certificates.
+	ClientCertificates *CertificateRotation `json:"clientCertificates,omitempty"`
+}
+
+// EtcdStorageCondition contains details for the current condition of this EtcdStorage instance.
+type EtcdStorageCondition struct {
+	// Type is the type of the condition.
+	Type EtcdStorageConditionType `json:"type"`
+	// Status is the status of the condition (true, false, unknown).
+	Status ConditionStatus `json:"status"`
+	// Last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Unique, one-word, CamelCase reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+	// Human-readable message indicating details about last transition.
+	Message string `json:"message,omitempty"`
+}
+
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EtcdStorageList is a list of EtcdStorage resources
+type EtcdStorageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []EtcdStorage `json:"items"`
+}
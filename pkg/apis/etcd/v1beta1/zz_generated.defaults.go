@@ -0,0 +1,29 @@
+// +build !ignore_autogenerated
+
+// Code generated by defaulter-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// RegisterDefaults adds defaulters functions to the given scheme.
+// Public to allow building arbitrary schemes.
+// All generated defaulters are covering - they call all nested defaulters.
+func RegisterDefaults(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&EtcdStorage{}, func(obj interface{}) { SetObjectDefaults_EtcdStorage(obj.(*EtcdStorage)) })
+	scheme.AddTypeDefaultingFunc(&EtcdStorageList{}, func(obj interface{}) { SetObjectDefaults_EtcdStorageList(obj.(*EtcdStorageList)) })
+	return nil
+}
+
+func SetObjectDefaults_EtcdStorage(in *EtcdStorage) {
+	SetDefaults_EtcdStorageSpec(&in.Spec)
+}
+
+func SetObjectDefaults_EtcdStorageList(in *EtcdStorageList) {
+	for i := range in.Items {
+		a := &in.Items[i]
+		SetObjectDefaults_EtcdStorage(a)
+	}
+}
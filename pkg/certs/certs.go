@@ -4,18 +4,41 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net"
+	"strings"
 	"time"
 
 	"k8s.io/client-go/util/cert"
 )
 
+// KeyAlgorithm is the algorithm used to generate private keys.
+type KeyAlgorithm string
+
+// These are supported key algorithms. Empty key algorithm means RSA2048.
+const (
+	// RSA2048 generates 2048-bit RSA keys.
+	RSA2048 KeyAlgorithm = "RSA-2048"
+	// RSA3072 generates 3072-bit RSA keys.
+	RSA3072 KeyAlgorithm = "RSA-3072"
+	// RSA4096 generates 4096-bit RSA keys.
+	RSA4096 KeyAlgorithm = "RSA-4096"
+	// ECDSAP256 generates ECDSA keys using the P-256 curve.
+	ECDSAP256 KeyAlgorithm = "ECDSA-P256"
+	// ECDSAP384 generates ECDSA keys using the P-384 curve.
+	ECDSAP384 KeyAlgorithm = "ECDSA-P384"
+	// Ed25519 generates Ed25519 keys.
+	Ed25519 KeyAlgorithm = "Ed25519"
+)
+
 // Certificate contains slice of certificates and a key.
 type Certificate struct {
 	Certificates []*x509.Certificate
@@ -42,13 +65,29 @@ func ParseCertificateBytes(certBytes, keyBytes []byte) (*Certificate, error) {
 	return &Certificate{certs, key}, nil
 }
 
-// FilterExpiredCerts checks are all certificates in the bundle valid, i.e. they have not expired.
-// The function returns new bundle with only valid certificates or error if no valid certificate is found.
-func FilterExpiredCerts(certs ...*x509.Certificate) []*x509.Certificate {
-	currentTime := time.Now()
+// FormatSerialNumber formats the certificate serial number as uppercase hexadecimal string, the same way as
+// 'openssl x509 -serial' does.
+func FormatSerialNumber(serialNumber *big.Int) string {
+	return fmt.Sprintf("%X", serialNumber)
+}
+
+// ParseSerialNumber parses the hexadecimal certificate serial number. Bytes of the serial number can be separated
+// by colons.
+func ParseSerialNumber(serialNumber string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(strings.Replace(serialNumber, ":", "", -1), 16)
+	if !ok || n.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid serial number '%s'", serialNumber)
+	}
+	return n, nil
+}
+
+// FilterExpiredCerts checks are all certificates in the bundle valid at the current time, i.e. they have not expired.
+// The function returns new bundle with only valid certificates.
+func FilterExpiredCerts(currentTime func() time.Time, certs ...*x509.Certificate) []*x509.Certificate {
+	now := currentTime()
 	var validCerts []*x509.Certificate
 	for _, c := range certs {
-		if c.NotAfter.After(currentTime) {
+		if c.NotAfter.After(now) {
 			validCerts = append(validCerts, c)
 		}
 	}
@@ -75,18 +114,84 @@ func (c *Certificate) GetPEMBytes() ([]byte, []byte, error) {
 	return certs, key, nil
 }
 
-// newKeyPair generates new public and private key.
-func newKeyPair() (crypto.PublicKey, crypto.PrivateKey, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// newKeyPair generates new public and private key using the provided key algorithm.
+func newKeyPair(keyAlgorithm KeyAlgorithm) (crypto.PublicKey, crypto.PrivateKey, error) {
+	switch keyAlgorithm {
+	case "", RSA2048, RSA3072, RSA4096:
+		bits := 2048
+		if keyAlgorithm == RSA3072 {
+			bits = 3072
+		} else if keyAlgorithm == RSA4096 {
+			bits = 4096
+		}
+		privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &privateKey.PublicKey, privateKey, nil
+	case ECDSAP256, ECDSAP384:
+		curve := elliptic.P256()
+		if keyAlgorithm == ECDSAP384 {
+			curve = elliptic.P384()
+		}
+		privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &privateKey.PublicKey, privateKey, nil
+	case Ed25519:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publicKey, privateKey, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key algorithm '%s'", keyAlgorithm)
+	}
+}
+
+// serialNumberLimit is the upper bound of random values used for certificate serial numbers, so serial numbers
+// are at most 128-bit long.
+var serialNumberLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+// newSerialNumber generates new random 128-bit certificate serial number. Serial numbers must be unique for each
+// certificate issued by a CA, which is, with overwhelming probability, ensured by generating them randomly.
+func newSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("unable to generate serial number: %v", err)
+	}
+	// Serial numbers must be positive.
+	return serialNumber.Add(serialNumber, big.NewInt(1)), nil
+}
+
+// keyUsage returns the key usage of certificates for the provided public key. Key encipherment is used only by RSA keys.
+func keyUsage(publicKey crypto.PublicKey) x509.KeyUsage {
+	if _, ok := publicKey.(*rsa.PublicKey); ok {
+		return x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// signatureAlgorithm returns the algorithm used to sign certificates using the provided issuer key.
+func signatureAlgorithm(issuerKey crypto.PrivateKey) x509.SignatureAlgorithm {
+	switch key := issuerKey.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve == elliptic.P384() {
+			return x509.ECDSAWithSHA384
+		}
+		return x509.ECDSAWithSHA256
+	case ed25519.PrivateKey:
+		return x509.PureEd25519
+	default:
+		return x509.SHA256WithRSA
 	}
-	return &privateKey.PublicKey, privateKey, nil
 }
 
 // signCertificate signs provided certificate using issuer certificate and key.
 func signCertificate(cert *x509.Certificate, certPublicKey crypto.PublicKey, issuerCertificate *x509.Certificate,
 	issuerKey crypto.PrivateKey) (*x509.Certificate, error) {
+	cert.SignatureAlgorithm = signatureAlgorithm(issuerKey)
 	derBytes, err := x509.CreateCertificate(rand.Reader, cert, issuerCertificate, certPublicKey, issuerKey)
 	if err != nil {
 		return nil, err
@@ -159,6 +264,14 @@ func encodeKey(key crypto.PrivateKey) ([]byte, error) {
 		if err := pem.Encode(&b, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}); err != nil {
 			return []byte{}, err
 		}
+	case ed25519.PrivateKey:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return []byte{}, err
+		}
+		if err := pem.Encode(&b, &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}); err != nil {
+			return []byte{}, err
+		}
 	default:
 		return []byte{}, fmt.Errorf("unrecognized key type")
 
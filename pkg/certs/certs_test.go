@@ -1,6 +1,10 @@
 package certs
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
 	"crypto/x509/pkix"
 	"io/ioutil"
 	"testing"
@@ -10,7 +14,7 @@ import (
 )
 
 func TestValidateCertificates(t *testing.T) {
-	c, err := NewCACertificate(pkix.Name{CommonName: "test"}, int64(1), metav1.Duration{time.Hour * 24 * 60}, time.Now)
+	c, err := NewCACertificate(pkix.Name{CommonName: "test"}, metav1.Duration{time.Hour * 24 * 60}, "", time.Now)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,12 +23,149 @@ func TestValidateCertificates(t *testing.T) {
 		t.Fatalf("expected 1 certificate in the chain, but got %d", len(c.Certificates))
 	}
 
-	validCerts := FilterExpiredCerts(c.Certificates...)
+	validCerts := FilterExpiredCerts(time.Now, c.Certificates...)
 	if len(validCerts) != 1 {
 		t.Fatalf("expected 1 valid certificate in the chain, but got %d", len(validCerts))
 	}
 }
 
+func TestKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		keyAlgorithm       KeyAlgorithm
+		signatureAlgorithm x509.SignatureAlgorithm
+		keySize            int
+	}{
+		{"", x509.SHA256WithRSA, 2048},
+		{RSA2048, x509.SHA256WithRSA, 2048},
+		{RSA3072, x509.SHA256WithRSA, 3072},
+		{RSA4096, x509.SHA256WithRSA, 4096},
+		{ECDSAP256, x509.ECDSAWithSHA256, 256},
+		{ECDSAP384, x509.ECDSAWithSHA384, 384},
+		{Ed25519, x509.PureEd25519, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.keyAlgorithm), func(t *testing.T) {
+			validity := metav1.Duration{Duration: time.Hour * 24 * 60}
+			ca, err := NewCACertificate(pkix.Name{CommonName: "test-ca"}, validity, tc.keyAlgorithm, time.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server, err := ca.NewServerCertificate(pkix.Name{CommonName: "test-server"}, []string{"etcd.test.svc"}, validity, tc.keyAlgorithm, time.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := ca.NewClientCertificate(pkix.Name{CommonName: "test-client"}, validity, tc.keyAlgorithm, time.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.Certificates[0])
+			for _, c := range []*Certificate{ca, server, client} {
+				// Certificates and keys must survive encoding, as they're stored in Secrets.
+				certBytes, keyBytes, err := c.GetPEMBytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				parsed, err := ParseCertificateBytes(certBytes, keyBytes)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				cert := parsed.Certificates[0]
+				if cert.SignatureAlgorithm != tc.signatureAlgorithm {
+					t.Fatalf("expected signature algorithm %s, but got %s", tc.signatureAlgorithm, cert.SignatureAlgorithm)
+				}
+				switch key := cert.PublicKey.(type) {
+				case *rsa.PublicKey:
+					if key.N.BitLen() != tc.keySize {
+						t.Fatalf("expected %d-bit rsa key, but got %d-bit", tc.keySize, key.N.BitLen())
+					}
+				case *ecdsa.PublicKey:
+					if key.Curve.Params().BitSize != tc.keySize {
+						t.Fatalf("expected %d-bit ecdsa key, but got %d-bit", tc.keySize, key.Curve.Params().BitSize)
+					}
+				case ed25519.PublicKey:
+					if tc.keyAlgorithm != Ed25519 {
+						t.Fatalf("expected %s key, but got ed25519", tc.keyAlgorithm)
+					}
+				}
+				if _, isRSA := cert.PublicKey.(*rsa.PublicKey); isRSA != (cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0) {
+					t.Fatalf("expected key encipherment usage only for rsa keys, but got key usage %d", cert.KeyUsage)
+				}
+				if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+					t.Fatalf("expected certificate signed by the ca: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedKeyAlgorithm(t *testing.T) {
+	if _, err := NewCACertificate(pkix.Name{CommonName: "test"}, metav1.Duration{Duration: time.Hour}, "DSA-1024", time.Now); err == nil {
+		t.Fatal("expected error for unsupported key algorithm")
+	}
+}
+
+func TestSerialNumbersUnique(t *testing.T) {
+	validity := metav1.Duration{Duration: time.Hour}
+	ca, err := NewCACertificate(pkix.Name{CommonName: "test-ca"}, validity, ECDSAP256, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialNumbers := map[string]bool{ca.Certificates[0].SerialNumber.String(): true}
+	for i := 0; i < 5000; i++ {
+		var c *Certificate
+		if i%2 == 0 {
+			c, err = ca.NewServerCertificate(pkix.Name{CommonName: "test-server"}, []string{"etcd.test.svc"}, validity, ECDSAP256, time.Now)
+		} else {
+			c, err = ca.NewClientCertificate(pkix.Name{CommonName: "test-client"}, validity, ECDSAP256, time.Now)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serialNumber := c.Certificates[0].SerialNumber
+		if serialNumber.Sign() <= 0 {
+			t.Fatalf("expected positive serial number, but got %s", serialNumber)
+		}
+		if serialNumber.BitLen() > 128 {
+			t.Fatalf("expected serial number of at most 128 bits, but got %d bits", serialNumber.BitLen())
+		}
+		if serialNumbers[serialNumber.String()] {
+			t.Fatalf("expected unique serial numbers, but serial number %s is issued twice", serialNumber)
+		}
+		serialNumbers[serialNumber.String()] = true
+	}
+}
+
+func TestSerialNumbers(t *testing.T) {
+	validity := metav1.Duration{Duration: time.Hour}
+	ca, err := NewCACertificate(pkix.Name{CommonName: "test-ca"}, validity, ECDSAP256, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.NewClientCertificate(pkix.Name{CommonName: "test-client"}, validity, ECDSAP256, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Serial numbers are formatted as by openssl, and can be separated by colons.
+	serialNumber := FormatSerialNumber(client.Certificates[0].SerialNumber)
+	parsed, err := ParseSerialNumber(serialNumber[:2] + ":" + serialNumber[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Cmp(client.Certificates[0].SerialNumber) != 0 {
+		t.Fatalf("expected serial number %s, but got %s", client.Certificates[0].SerialNumber, parsed)
+	}
+	if _, err := ParseSerialNumber("0"); err == nil {
+		t.Fatal("expected error for non-positive serial number")
+	}
+}
+
 func TestValidateCertificatesExpired(t *testing.T) {
 	certBytes, err := ioutil.ReadFile("./testfiles/tls-expired.crt")
 	if err != nil {
@@ -38,7 +179,7 @@ func TestValidateCertificatesExpired(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	newCert, err := NewCACertificate(pkix.Name{CommonName: "etcdproxy-tests"}, int64(1), metav1.Duration{time.Hour * 24 * 60}, time.Now)
+	newCert, err := NewCACertificate(pkix.Name{CommonName: "etcdproxy-tests"}, metav1.Duration{Duration: time.Hour * 24 * 60}, "", time.Now)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +189,7 @@ func TestValidateCertificatesExpired(t *testing.T) {
 		t.Fatalf("expected 2 certificate in the chain, but got %d", len(certs.Certificates))
 	}
 
-	validCerts := FilterExpiredCerts(certs.Certificates...)
+	validCerts := FilterExpiredCerts(time.Now, certs.Certificates...)
 	if len(validCerts) != 1 {
 		t.Fatalf("expected 1 valid certificate in the chain, but got %d", len(validCerts))
 	}
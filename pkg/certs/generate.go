@@ -1,17 +1,23 @@
 package certs
 
 import (
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"math/big"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/cert"
 )
 
-// NewCACertificate generates and signs new CA certificate and key.
-func NewCACertificate(subject pkix.Name, serialNumber int64, validity metav1.Duration, currentTime func() time.Time) (*Certificate, error) {
-	caPublicKey, caPrivateKey, err := newKeyPair()
+// NewCACertificate generates and signs new CA certificate and key, using the provided key algorithm.
+// The serial number of the certificate is generated randomly.
+func NewCACertificate(subject pkix.Name, validity metav1.Duration, keyAlgorithm KeyAlgorithm, currentTime func() time.Time) (*Certificate, error) {
+	caPublicKey, caPrivateKey, err := newKeyPair(keyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
 	if err != nil {
 		return nil, err
 	}
@@ -19,13 +25,11 @@ func NewCACertificate(subject pkix.Name, serialNumber int64, validity metav1.Dur
 	caCert := &x509.Certificate{
 		Subject: subject,
 
-		SignatureAlgorithm: x509.SHA256WithRSA,
-
 		NotBefore:    currentTime().Add(-1 * time.Second),
 		NotAfter:     currentTime().Add(validity.Duration),
-		SerialNumber: big.NewInt(serialNumber),
+		SerialNumber: serialNumber,
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		KeyUsage:              keyUsage(caPublicKey) | x509.KeyUsageCertSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 	}
@@ -41,9 +45,13 @@ func NewCACertificate(subject pkix.Name, serialNumber int64, validity metav1.Dur
 	}, nil
 }
 
-// NewServerCertificate generates and signs new Server certificate and key from CA bundle.
-func (c *Certificate) NewServerCertificate(subject pkix.Name, hosts []string, serialNumber int64, validity metav1.Duration, currentTime func() time.Time) (*Certificate, error) {
-	serverPublicKey, serverPrivateKey, err := newKeyPair()
+// NewServerCertificate generates and signs new Server certificate and key from CA bundle, using the provided key algorithm.
+func (c *Certificate) NewServerCertificate(subject pkix.Name, hosts []string, validity metav1.Duration, keyAlgorithm KeyAlgorithm, currentTime func() time.Time) (*Certificate, error) {
+	serverPublicKey, serverPrivateKey, err := newKeyPair(keyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
 	if err != nil {
 		return nil, err
 	}
@@ -51,13 +59,11 @@ func (c *Certificate) NewServerCertificate(subject pkix.Name, hosts []string, se
 	serverCert := &x509.Certificate{
 		Subject: subject,
 
-		SignatureAlgorithm: x509.SHA256WithRSA,
-
 		NotBefore:    currentTime().Add(-1 * time.Second),
 		NotAfter:     currentTime().Add(validity.Duration),
-		SerialNumber: big.NewInt(serialNumber),
+		SerialNumber: serialNumber,
 
-		KeyUsage: x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage: keyUsage(serverPublicKey),
 		// etcd requires from server key to be able to auth both server and client.
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
@@ -75,9 +81,14 @@ func (c *Certificate) NewServerCertificate(subject pkix.Name, hosts []string, se
 	}, nil
 }
 
-// NewClientCertificate generates and signs new Client certificate and key from server certificate..
-func (c *Certificate) NewClientCertificate(subject pkix.Name, serialNumber int64, validity metav1.Duration, currentTime func() time.Time) (*Certificate, error) {
-	clientPublicKey, clientPrivateKey, err := newKeyPair()
+// NewClientCertificate generates and signs new Client certificate and key from server certificate, using the provided
+// key algorithm.
+func (c *Certificate) NewClientCertificate(subject pkix.Name, validity metav1.Duration, keyAlgorithm KeyAlgorithm, currentTime func() time.Time) (*Certificate, error) {
+	clientPublicKey, clientPrivateKey, err := newKeyPair(keyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
 	if err != nil {
 		return nil, err
 	}
@@ -85,13 +96,11 @@ func (c *Certificate) NewClientCertificate(subject pkix.Name, serialNumber int64
 	clientCert := &x509.Certificate{
 		Subject: subject,
 
-		SignatureAlgorithm: x509.SHA256WithRSA,
-
 		NotBefore:    currentTime().Add(-1 * time.Second),
 		NotAfter:     currentTime().Add(validity.Duration),
-		SerialNumber: big.NewInt(serialNumber),
+		SerialNumber: serialNumber,
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              keyUsage(clientPublicKey),
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 	}
@@ -106,3 +115,20 @@ func (c *Certificate) NewClientCertificate(subject pkix.Name, serialNumber int64
 		Key:          clientPrivateKey,
 	}, nil
 }
+
+// NewCertificateRequest generates new key and PEM encoded certificate signing request for the provided subject and hosts,
+// using the provided key algorithm.
+func NewCertificateRequest(subject pkix.Name, hosts []string, keyAlgorithm KeyAlgorithm) ([]byte, crypto.PrivateKey, error) {
+	_, privateKey, err := newKeyPair(keyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ipAddresses, dnsNames := ipAddressesDNSNames(hosts)
+	csr, err := cert.MakeCSR(privateKey, &subject, dnsNames, ipAddresses)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return csr, privateKey, nil
+}
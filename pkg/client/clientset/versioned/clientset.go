@@ -5,6 +5,7 @@ package versioned
 import (
 	glog "github.com/golang/glog"
 	etcdv1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1alpha1"
+	etcdv1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1beta1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -13,8 +14,9 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	EtcdV1alpha1() etcdv1alpha1.EtcdV1alpha1Interface
+	EtcdV1beta1() etcdv1beta1.EtcdV1beta1Interface
 	// Deprecated: please explicitly pick a version if possible.
-	Etcd() etcdv1alpha1.EtcdV1alpha1Interface
+	Etcd() etcdv1beta1.EtcdV1beta1Interface
 }
 
 // Clientset contains the clients for groups. Each group has exactly one
@@ -22,6 +24,7 @@ type Interface interface {
 type Clientset struct {
 	*discovery.DiscoveryClient
 	etcdV1alpha1 *etcdv1alpha1.EtcdV1alpha1Client
+	etcdV1beta1  *etcdv1beta1.EtcdV1beta1Client
 }
 
 // EtcdV1alpha1 retrieves the EtcdV1alpha1Client
@@ -29,10 +32,15 @@ func (c *Clientset) EtcdV1alpha1() etcdv1alpha1.EtcdV1alpha1Interface {
 	return c.etcdV1alpha1
 }
 
+// EtcdV1beta1 retrieves the EtcdV1beta1Client
+func (c *Clientset) EtcdV1beta1() etcdv1beta1.EtcdV1beta1Interface {
+	return c.etcdV1beta1
+}
+
 // Deprecated: Etcd retrieves the default version of EtcdClient.
 // Please explicitly pick a version.
-func (c *Clientset) Etcd() etcdv1alpha1.EtcdV1alpha1Interface {
-	return c.etcdV1alpha1
+func (c *Clientset) Etcd() etcdv1beta1.EtcdV1beta1Interface {
+	return c.etcdV1beta1
 }
 
 // Discovery retrieves the DiscoveryClient
@@ -55,6 +63,10 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 	if err != nil {
 		return nil, err
 	}
+	cs.etcdV1beta1, err = etcdv1beta1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
 
 	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
 	if err != nil {
@@ -69,6 +81,7 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 func NewForConfigOrDie(c *rest.Config) *Clientset {
 	var cs Clientset
 	cs.etcdV1alpha1 = etcdv1alpha1.NewForConfigOrDie(c)
+	cs.etcdV1beta1 = etcdv1beta1.NewForConfigOrDie(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
 	return &cs
@@ -78,6 +91,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.etcdV1alpha1 = etcdv1alpha1.New(c)
+	cs.etcdV1beta1 = etcdv1beta1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
@@ -6,6 +6,8 @@ import (
 	clientset "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned"
 	etcdv1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1alpha1"
 	fakeetcdv1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1alpha1/fake"
+	etcdv1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1beta1"
+	fakeetcdv1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/typed/etcd/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -59,7 +61,12 @@ func (c *Clientset) EtcdV1alpha1() etcdv1alpha1.EtcdV1alpha1Interface {
 	return &fakeetcdv1alpha1.FakeEtcdV1alpha1{Fake: &c.Fake}
 }
 
-// Etcd retrieves the EtcdV1alpha1Client
-func (c *Clientset) Etcd() etcdv1alpha1.EtcdV1alpha1Interface {
-	return &fakeetcdv1alpha1.FakeEtcdV1alpha1{Fake: &c.Fake}
+// EtcdV1beta1 retrieves the EtcdV1beta1Client
+func (c *Clientset) EtcdV1beta1() etcdv1beta1.EtcdV1beta1Interface {
+	return &fakeetcdv1beta1.FakeEtcdV1beta1{Fake: &c.Fake}
+}
+
+// Etcd retrieves the EtcdV1beta1Client
+func (c *Clientset) Etcd() etcdv1beta1.EtcdV1beta1Interface {
+	return &fakeetcdv1beta1.FakeEtcdV1beta1{Fake: &c.Fake}
 }
@@ -4,6 +4,7 @@ package scheme
 
 import (
 	etcdv1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdv1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
@@ -35,4 +36,5 @@ func init() {
 // correctly.
 func AddToScheme(scheme *runtime.Scheme) {
 	etcdv1alpha1.AddToScheme(scheme)
+	etcdv1beta1.AddToScheme(scheme)
 }
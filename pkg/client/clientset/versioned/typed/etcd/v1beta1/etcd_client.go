@@ -0,0 +1,74 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	v1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/scheme"
+	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	rest "k8s.io/client-go/rest"
+)
+
+type EtcdV1beta1Interface interface {
+	RESTClient() rest.Interface
+	EtcdStoragesGetter
+}
+
+// EtcdV1beta1Client is used to interact with features provided by the etcd.xmudrii.com group.
+type EtcdV1beta1Client struct {
+	restClient rest.Interface
+}
+
+func (c *EtcdV1beta1Client) EtcdStorages() EtcdStorageInterface {
+	return newEtcdStorages(c)
+}
+
+// NewForConfig creates a new EtcdV1beta1Client for the given config.
+func NewForConfig(c *rest.Config) (*EtcdV1beta1Client, error) {
+	config := *c
+	if err := setConfigDefaults(&config); err != nil {
+		return nil, err
+	}
+	client, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdV1beta1Client{client}, nil
+}
+
+// NewForConfigOrDie creates a new EtcdV1beta1Client for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *EtcdV1beta1Client {
+	client, err := NewForConfig(c)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// New creates a new EtcdV1beta1Client for the given RESTClient.
+func New(c rest.Interface) *EtcdV1beta1Client {
+	return &EtcdV1beta1Client{c}
+}
+
+func setConfigDefaults(config *rest.Config) error {
+	gv := v1beta1.SchemeGroupVersion
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	return nil
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *EtcdV1beta1Client) RESTClient() rest.Interface {
+	if c == nil {
+		return nil
+	}
+	return c.restClient
+}
@@ -0,0 +1,72 @@
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	time "time"
+
+	etcd_v1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	versioned "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned"
+	internalinterfaces "github.com/xmudrii/etcdproxy-controller/pkg/client/informers/externalversions/internalinterfaces"
+	v1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/client/listers/etcd/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// EtcdStorageInformer provides access to a shared informer and lister for
+// EtcdStorages.
+type EtcdStorageInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1beta1.EtcdStorageLister
+}
+
+type etcdStorageInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// NewEtcdStorageInformer constructs a new informer for EtcdStorage type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewEtcdStorageInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredEtcdStorageInformer(client, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredEtcdStorageInformer constructs a new informer for EtcdStorage type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredEtcdStorageInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.EtcdV1beta1().EtcdStorages().List(options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.EtcdV1beta1().EtcdStorages().Watch(options)
+			},
+		},
+		&etcd_v1beta1.EtcdStorage{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *etcdStorageInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredEtcdStorageInformer(client, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *etcdStorageInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&etcd_v1beta1.EtcdStorage{}, f.defaultInformer)
+}
+
+func (f *etcdStorageInformer) Lister() v1beta1.EtcdStorageLister {
+	return v1beta1.NewEtcdStorageLister(f.Informer().GetIndexer())
+}
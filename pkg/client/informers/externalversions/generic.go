@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	v1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	v1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -40,6 +41,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	case v1alpha1.SchemeGroupVersion.WithResource("etcdstorages"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Etcd().V1alpha1().EtcdStorages().Informer()}, nil
 
+		// Group=etcd.xmudrii.com, Version=v1beta1
+	case v1beta1.SchemeGroupVersion.WithResource("etcdstorages"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Etcd().V1beta1().EtcdStorages().Informer()}, nil
+
 	}
 
 	return nil, fmt.Errorf("no informer found for %v", resource)
@@ -3,17 +3,32 @@ package controller
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
 	clientset "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned"
 	informers "github.com/xmudrii/etcdproxy-controller/pkg/client/informers/externalversions"
 	"github.com/xmudrii/etcdproxy-controller/pkg/controller/etcdproxy"
+	"github.com/xmudrii/etcdproxy-controller/pkg/healthz"
+	"github.com/xmudrii/etcdproxy-controller/pkg/metrics"
 	"github.com/xmudrii/etcdproxy-controller/pkg/options"
+	"github.com/xmudrii/etcdproxy-controller/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 // NewCommandEtcdProxyControllerStart returns controller root command.
@@ -63,15 +78,136 @@ func RunController(config *etcdproxy.EtcdProxyControllerConfig, stopCh <-chan st
 	}
 	etcdproxyInformers := informers.NewSharedInformerFactory(etcdproxyClient, 10*time.Minute)
 
+	// The workqueue metrics provider must be set before the controller creates its workqueue.
+	metrics.RegisterWorkqueueMetrics(prometheus.DefaultRegisterer)
+
 	controller := etcdproxy.NewEtcdProxyController(kubeClient, etcdproxyClient,
 		kubeInformersNamespaced.Apps().V1().Deployments(),
 		kubeInformersNamespaced.Core().V1().Services(),
-		etcdproxyInformers.Etcd().V1alpha1().EtcdStorages(), config)
+		kubeInformersNamespaced.Core().V1().Endpoints(),
+		kubeInformersNamespaced.Core().V1().ConfigMaps(),
+		etcdproxyInformers.Etcd().V1beta1().EtcdStorages(), config)
+
+	if config.MetricsAddress != "" {
+		if err := controller.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+			return err
+		}
+		metrics.Serve(config.MetricsAddress, prometheus.DefaultGatherer, stopCh)
+	}
+	if config.HealthAddress != "" {
+		healthz.Serve(config.HealthAddress, controller.HealthChecks(), controller.ReadinessChecks(), stopCh)
+	}
+	// The webhook is served by all replicas, as the webhook Service routes admission requests to any of them.
+	if err := runWebhook(kubeClient, etcdproxyClient, controllerNamespace, config.Webhook, config.CertificateValidityDefaults, stopCh); err != nil {
+		return err
+	}
+
+	run := func(stop <-chan struct{}) error {
+		go kubeInformersNamespaced.Start(stop)
+		go etcdproxyInformers.Start(stop)
+
+		return controller.Run(2, stop)
+	}
+
+	if !config.LeaderElection.LeaderElect {
+		return run(stopCh)
+	}
+
+	return runLeaderElection(kubeClient, controllerNamespace, config.LeaderElection, run, stopCh)
+}
+
+// runWebhook bootstraps the webhook serving certificate, registers the EtcdStorage validating and conversion webhooks
+// and starts serving them. The serving certificate is renewed and reloaded while serving, and the webhooks are
+// registered again whenever its CA bundle changes. EtcdStorages are listed on each admission request, as informers are started only on the leader replica.
+func runWebhook(kubeClient kubernetes.Interface, etcdproxyClient clientset.Interface, namespace string,
+	config *etcdproxy.WebhookConfig, defaults *etcdproxy.CertificateValidityDefaultsConfig, stopCh <-chan struct{}) error {
+	rotator := &webhook.CertificateRotator{
+		Ensure: func() ([]byte, *certs.Certificate, error) {
+			return webhook.EnsureServingCertificate(kubeClient, namespace, config.CertSecretName, config.ServiceName,
+				config.CertificateValidity, time.Now)
+		},
+		Register: func(caBundle []byte) error {
+			if err := webhook.EnsureValidatingWebhookConfiguration(kubeClient, config.ConfigurationName, namespace,
+				config.ServiceName, caBundle); err != nil {
+				return fmt.Errorf("unable to register validating webhook: %v", err)
+			}
+			if err := webhook.EnsureCustomResourceConversion(kubeClient.Discovery().RESTClient(), namespace,
+				config.ServiceName, caBundle); err != nil {
+				return fmt.Errorf("unable to register conversion webhook: %v", err)
+			}
+			return nil
+		},
+	}
+
+	validate := func(etcdstorage *etcdstoragev1beta1.EtcdStorage) (field.ErrorList, error) {
+		etcdstorages, err := etcdproxyClient.EtcdV1beta1().EtcdStorages().List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		// Validate the EtcdStorage as the controller sees it, with defaults set.
+		etcdstorage = etcdstorage.DeepCopy()
+		etcdproxy.SetEtcdStorageDefaults(etcdstorage, defaults)
+		for i := range etcdstorages.Items {
+			etcdproxy.SetEtcdStorageDefaults(&etcdstorages.Items[i], defaults)
+		}
+		return etcdproxy.ValidateEtcdStorage(etcdstorage, etcdstorages.Items, namespace), nil
+	}
+
+	return webhook.Serve(config.Address, rotator, validate, stopCh)
+}
+
+// runLeaderElection runs the controller only while this replica is the leader, so only one of multiple controller
+// replicas manages certificates and etcd-proxy Deployments at once. The controller exits if it stops leading,
+// so it can be restarted as a candidate.
+func runLeaderElection(kubeClient kubernetes.Interface, namespace string, config *etcdproxy.LeaderElectionConfig,
+	run func(stop <-chan struct{}) error, stopCh <-chan struct{}) error {
+	id, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events(namespace)})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "etcdproxy-controller"})
+
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, config.LockName, kubeClient.CoreV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      id,
+			EventRecorder: recorder,
+		})
+	if err != nil {
+		return err
+	}
+
+	leaderElector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: config.LeaseDuration,
+		RenewDeadline: config.RenewDeadline,
+		RetryPeriod:   config.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.Infof("Started leading as %s", id)
+				if err := run(stop); err != nil {
+					glog.Fatal(err)
+				}
+			},
+			OnStoppedLeading: func() {
+				glog.Fatalf("Leader election lost")
+			},
+			OnNewLeader: func(identity string) {
+				glog.Infof("New leader elected: %s", identity)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
 
-	go kubeInformersNamespaced.Start(stopCh)
-	go etcdproxyInformers.Start(stopCh)
+	go leaderElector.Run()
+	<-stopCh
 
-	return controller.Run(2, stopCh)
+	return nil
 }
 
 // controllerNamespace returns name of the namespace where controller is located. The namespace name is obtained
@@ -1,17 +1,21 @@
 package etcdproxy
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
 	"time"
 
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
-	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
 )
 
@@ -20,6 +24,11 @@ const (
 	ProxyCertificateExpiryAnnotation = "etcd.xmudrii.com/certificate-expiry-date"
 	// ProxyCertificateSignedBy contains the common name of the certificate that signed another certificate.
 	ProxyCertificateSignedBy = "etcd.xmudrii.com/certificate-signed-by"
+	// ProxyCertificatesHashAnnotation contains the hash of the Server certificate/key pair and the Client CA bundle
+	// mounted in etcd-proxy pods. It is set on the etcd-proxy pod template, so changing it triggers a rolling update.
+	ProxyCertificatesHashAnnotation = "etcd.xmudrii.com/certificates-hash"
+	// ProxyCertificateSerialNumber contains the hexadecimal serial number of the Client certificate, used to revoke it.
+	ProxyCertificateSerialNumber = "etcd.xmudrii.com/certificate-serial-number"
 )
 
 // ensureClientCertificates handles certificate generating, renewal and rotation for Client CA bundle and Client certificates.
@@ -28,110 +37,120 @@ const (
 // The EtcdProxy controller assumes Secrets for Client certificates are already created, but if not, the controller will try to create them.
 // Creating Secrets for Client certificates requires the appropriate RBAC roles if RBAC is enabled on cluster.
 //
-// This function reads all Secrets provided in the EtcdStorage Spec and checks is the 'etcd.xmudrii.com/certificate-expiry-date'
-// annotation present and contains valid date. If date is in the past, i.e. certificate is expired, or the annotation is not present controller:
-// * Generates new CA certificate. If CA bundle already exists in the controller namespace, the new CA certificate will be appended to the bundle.
-// Expired CA certificates from the bundle are removed in this phase.
-// * Generates new Client certificate/key pair using the newly generated CA certificate and updates the appropriate Secret with new pair.
-// TODO: the API server have to be "restarted" manually to pick up changes. Hopefully, this to be fixed in future Kube versions.
-func (c *EtcdProxyController) ensureClientCertificates(etcdstorage *etcdstoragev1alpha1.EtcdStorage) error {
-	var signingCertKeyPair *certs.Certificate
+// The Client signing certificate is appended to the Client CA bundle before it's used. The self-generated Client signer
+// is stored in the Secret named etcdstorageName-client-signer in the controller namespace, and it's rotated to revoke
+// Client certificates. Expired CA certificates from the bundle are removed in this phase.
+//
+// The Client certificates are parsed from the Secrets, and a new Client certificate/key pair is issued if:
+// * the Secret doesn't contain a valid certificate, or the certificate is expired,
+// * the renewal fraction of the certificate lifetime has passed, or the Client certificate validity in the Spec has changed,
+// * the Client signer has been rotated, once the new Client signer is distributed to all etcd-proxy pods.
+// If the consumer workload is provided for the Secret, its pod template is updated whenever it doesn't match the current
+// certificate, so the API server is restarted and picks up the new certificate. Otherwise, the API server has to be
+// restarted manually.
+//
+// The Client signer rotation is recorded in the EtcdStorage status: once all Client certificates are reissued, the
+// rotation is in the LeafReissued phase, and the previous Client signer is removed from the Client CA bundle in the next sync.
+// Client certificates revoked by the Spec when the rotation started are rejected by etcd-proxy pods afterwards.
+func (c *EtcdProxyController) ensureClientCertificates(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if len(etcdstorage.Spec.ClientCertSecrets) == 0 {
+		return nil
+	}
+
+	signingCertKeyPair, err := c.generateClientSigningCertKeyPair(etcdstorage)
+	if err != nil {
+		return err
+	}
+	if err := c.appendClientCABundle(etcdstorage, signingCertKeyPair); err != nil {
+		return err
+	}
+
+	recorded := etcdstorage.Status.ClientCertificates
+	rotation := c.signerRotation(recorded, signingCertKeyPair)
+	// The rotation revokes all Client certificates revoked by the Spec, as it removes all previous signers.
+	if recorded == nil || recorded.Signer != rotation.Signer {
+		rotation.RevokedCertificates = append([]etcdstoragev1beta1.RevokedCertificate{}, etcdstorage.Spec.RevokedClientCertificates...)
+	}
+	// Client certificates signed by the previous Client signer are reissued only once all etcd-proxy pods trust
+	// the new Client signer, which was distributed in a previous sync.
+	reissue := false
+	if inRotationPhase(recorded, signingCertKeyPair, etcdstoragev1beta1.CertificateRotationCADistributed) {
+		reissue, err = c.proxyRolledOut(etcdstorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	revoked, err := revokedSerialNumbers(etcdstorage.Spec.RevokedClientCertificates)
+	if err != nil {
+		return err
+	}
+
 	var errs []error
+	// current handles the Secret containing the current Client certificate. The workload using the Client certificate,
+	// if one is provided, is restarted if it doesn't use the current Client certificate yet. This is checked in every
+	// sync, so restarting the workload is retried if it failed when the Client certificate was issued.
+	current := func(secret *v1.Secret, consumer *etcdstoragev1beta1.ConsumerReference) {
+		c.certificateExpiry.observe(etcdstorage, clientCertificate, secret)
+		if consumer == nil {
+			return
+		}
+		if err := c.restartConsumer(etcdstorage, secret, consumer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	signedByCurrent := true
 	for _, clientCertSecret := range etcdstorage.Spec.ClientCertSecrets {
 		// Get Secret from Kube if it exists or return new, empty, Secret.
 		secret, err := c.kubeclientset.CoreV1().Secrets(clientCertSecret.Namespace).Get(clientCertSecret.Name, metav1.GetOptions{})
 		if errors.IsNotFound(err) {
 			secret = &v1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:        clientCertSecret.Name,
-					Namespace:   clientCertSecret.Namespace,
-					Annotations: map[string]string{},
+					Name:      clientCertSecret.Name,
+					Namespace: clientCertSecret.Namespace,
+					Annotations: map[string]string{
+						CreatedByControllerAnnotation: etcdstorage.Name,
+					},
 				},
 				Type: v1.SecretTypeTLS,
-				Data: map[string][]byte{},
 			}
 			err = nil
 		}
 		if err != nil {
 			errs = append(errs, err)
+			signedByCurrent = false
 			continue
 		}
 
-		// Check is annotation containing expiry date present and valid. If it is valid, we're skipping this iteration.
-		if expiry, ok := secret.Annotations[ProxyCertificateExpiryAnnotation]; ok {
-			certExpiry, err := time.Parse(time.RFC3339, expiry)
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			// If Certificate is not-expired, skip this iteration.
-			// TODO: Check certExpiry without subtracting as well, to prevent errors if validity in Spec is change. To be fixed in a follow-up.
-			if certExpiry.Add(-1*etcdstorage.Spec.ClientCertificateValidity.Duration/2).After(time.Now()) || certExpiry.After(time.Now()) {
+		reason := "certificate not issued"
+		if clientCert, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], nil); err == nil {
+			// Secrets holding a revoked Client certificate are skipped, as described in revokeClientCertificates.
+			if serialNumber := clientCert.Certificates[0].SerialNumber; revoked[serialNumber.String()] {
+				c.recorder.Event(etcdstorage, v1.EventTypeWarning, ClientCertificatesRevoked,
+					fmt.Sprintf("Not reissuing revoked Client certificate %s for Secret %s/%s",
+						certs.FormatSerialNumber(serialNumber), secret.Namespace, secret.Name))
 				continue
 			}
-		}
-
-		// Generate Client CA certificate and append it to the bundle.
-		// The bundle is located in the ConfigMap in the controller namespace.
-		// We're generating one Client CA in this loop for all Client certificates that are going to be regenerated in this loop/iteration.
-		// TODO: Decide is this a good idea. Another idea is to genearte new CA certificate for each Client certificate that has to be regenrated.
-		// TODO: The negative side in this case is that we could have to restart etcd-proxy for each certificate appended and to get/update for each one instead of once.
-		if signingCertKeyPair == nil {
-			// Generate new Client CA certificate.
-			signingCertKeyPair, err = c.generateClientSigningCertKeyPair(etcdstorage)
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			// Get Client CA ConfigMap and check does it contain CA bundle. If yes, append new client CA certificate to the bundle.
-			clientCAConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdstorage), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				clientCAConfigMap = &v1.ConfigMap{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:        etcdProxyCAConfigMapName(etcdstorage),
-						Namespace:   c.config.ControllerNamespace,
-						Annotations: map[string]string{},
-					},
-					Data: map[string]string{},
-				}
-				err = nil
-			}
-			if err != nil {
-				errs = append(errs, err)
-			}
-
-			if clientCABytes, ok := clientCAConfigMap.Data["client-ca.crt"]; ok {
-				oldClientCA, err := certs.ParseCertificateBytes([]byte(clientCABytes), nil)
-				if err != nil {
-					errs = append(errs, err)
+			reason = c.renewalReason(clientCert.Certificates[0], etcdstorage.Spec.ClientCertificateValidity.Duration, !c.useCSR(etcdstorage))
+			if reason == "" && !signedBy(clientCert, signingCertKeyPair) {
+				if !reissue {
+					signedByCurrent = false
+					current(secret, clientCertSecret.Consumer)
 					continue
 				}
-				signingCertKeyPair.Certificates = append(signingCertKeyPair.Certificates, oldClientCA.Certificates...)
-			}
-			// Filter expired certificates in the Client CA bundle.
-			signingCertKeyPair.Certificates = certs.FilterExpiredCerts(signingCertKeyPair.Certificates...)
-
-			// Update ConfigMap with the updated Client CA bundle. If ConfigMap doesn't exist, it will be created.
-			clientCABytes, _, err := signingCertKeyPair.GetPEMBytes()
-			if err != nil {
-				return err
-			}
-			clientCAConfigMap.Data = map[string]string{
-				"client-ca.crt": string(clientCABytes),
-			}
-
-			err = ensureConfigMap(c.kubeclientset, clientCAConfigMap)
-			if err != nil {
-				errs = append(errs, err)
-				continue
+				reason = "signing certificate rotated"
 			}
 		}
+		if reason == "" {
+			current(secret, clientCertSecret.Consumer)
+			continue
+		}
 
-		// Generate new Client certificate/key pair using the newly-generated Client CA certificate and update
-		// the appropriate Secret.
+		// Generate new Client certificate/key pair using the current Client signer and update the appropriate Secret.
 		clientCert, err := c.generateClientCertificate(etcdstorage, signingCertKeyPair, clientCertSecret)
 		if err != nil {
 			errs = append(errs, err)
+			signedByCurrent = false
 			continue
 		}
 		clientCertBytes, clientKeyBytes, err := clientCert.GetPEMBytes()
@@ -139,49 +158,165 @@ func (c *EtcdProxyController) ensureClientCertificates(etcdstorage *etcdstoragev
 			return err
 		}
 
-		// Build new Secret and apply it.
-		secret.Annotations = map[string]string{
-			ProxyCertificateExpiryAnnotation: clientCert.Certificates[0].NotAfter.Format(time.RFC3339),
-			ProxyCertificateSignedBy:         signingCertKeyPair.Certificates[0].Issuer.CommonName,
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
 		}
-		secret.Data = map[string][]byte{
-			"tls.crt": clientCertBytes,
-			"tls.key": clientKeyBytes,
+		secret.Annotations[ProxyCertificateExpiryAnnotation] = clientCert.Certificates[0].NotAfter.Format(time.RFC3339)
+		secret.Annotations[ProxyCertificateSignedBy] = signingCertKeyPair.Certificates[0].Subject.CommonName
+		secret.Annotations[ProxyCertificateSerialNumber] = certs.FormatSerialNumber(clientCert.Certificates[0].SerialNumber)
+		// Other keys of the Secret are kept, as the Secret may be owned by the user.
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
 		}
+		secret.Data["tls.crt"] = clientCertBytes
+		secret.Data["tls.key"] = clientKeyBytes
 
-		err = ensureSecret(c.kubeclientset, secret)
-		if err != nil {
+		if err := updateCertificateSecret(c.kubeclientset, secret); err != nil {
 			errs = append(errs, err)
+			signedByCurrent = false
+			continue
 		}
+		c.recorder.Event(etcdstorage, v1.EventTypeNormal, CertificateRenewed,
+			fmt.Sprintf("Issued Client certificate for Secret %s/%s: %s", secret.Namespace, secret.Name, reason))
+		current(secret, clientCertSecret.Consumer)
 	}
 
+	if signedByCurrent {
+		switch rotation.Phase {
+		case etcdstoragev1beta1.CertificateRotationCADistributed:
+			c.setRotationPhase(rotation, etcdstoragev1beta1.CertificateRotationLeafReissued)
+		case etcdstoragev1beta1.CertificateRotationLeafReissued:
+			// The previous Client signer is removed only in the sync after all Client certificates have been
+			// reissued, so consumers had a chance to pick up new Client certificates.
+			if inRotationPhase(recorded, signingCertKeyPair, etcdstoragev1beta1.CertificateRotationLeafReissued) {
+				if err := c.removeStaleClientCAs(etcdstorage, signingCertKeyPair); err != nil {
+					errs = append(errs, err)
+				} else {
+					c.setRotationPhase(rotation, etcdstoragev1beta1.CertificateRotationOldCARemoved)
+				}
+			}
+		}
+	}
+	etcdstorage.Status.ClientCertificates = rotation
+
 	return utilerrors.NewAggregate(errs)
 }
 
+// appendClientCABundle appends the Client signing certificate chain to the Client CA bundle stored in the ConfigMap
+// in the controller namespace. Expired certificates are removed from the bundle. If the ConfigMap doesn't exist,
+// it will be created.
+func (c *EtcdProxyController) appendClientCABundle(etcdstorage *etcdstoragev1beta1.EtcdStorage, signingCertKeyPair *certs.Certificate) error {
+	clientCAConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdstorage), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		clientCAConfigMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        etcdProxyCAConfigMapName(etcdstorage),
+				Namespace:   c.config.ControllerNamespace,
+				Annotations: map[string]string{},
+			},
+			Data: map[string]string{},
+		}
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	clientCA := &certs.Certificate{
+		Certificates: append([]*x509.Certificate{}, signingCertKeyPair.Certificates...),
+	}
+	if clientCABytes, ok := clientCAConfigMap.Data["client-ca.crt"]; ok {
+		oldClientCA, err := certs.ParseCertificateBytes([]byte(clientCABytes), nil)
+		if err != nil {
+			return err
+		}
+		// The issuer CA certificate is already in the bundle if it was used to sign previous Client certificates.
+		for _, cert := range oldClientCA.Certificates {
+			if !containsCertificate(clientCA.Certificates, cert) {
+				clientCA.Certificates = append(clientCA.Certificates, cert)
+			}
+		}
+	}
+	// Filter expired certificates in the Client CA bundle.
+	clientCA.Certificates = certs.FilterExpiredCerts(c.currentTime, clientCA.Certificates...)
+
+	clientCABytes, _, err := clientCA.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+	clientCAConfigMap.Data = map[string]string{
+		"client-ca.crt": string(clientCABytes),
+	}
+
+	return ensureConfigMap(c.kubeclientset, clientCAConfigMap)
+}
+
+// removeStaleClientCAs removes certificates that are not part of the current Client signing certificate chain from
+// the Client CA bundle stored in the ConfigMap in the controller namespace. It should be called only once all Client
+// certificates are signed by the current Client signer, otherwise etcd-proxy pods would reject the remaining ones.
+func (c *EtcdProxyController) removeStaleClientCAs(etcdstorage *etcdstoragev1beta1.EtcdStorage, signingCertKeyPair *certs.Certificate) error {
+	clientCAConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdstorage), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	clientCA, err := certs.ParseCertificateBytes([]byte(clientCAConfigMap.Data["client-ca.crt"]), nil)
+	if err != nil {
+		return err
+	}
+
+	var currentCerts []*x509.Certificate
+	for _, cert := range clientCA.Certificates {
+		if containsCertificate(signingCertKeyPair.Certificates, cert) {
+			currentCerts = append(currentCerts, cert)
+		}
+	}
+	if len(currentCerts) == len(clientCA.Certificates) {
+		return nil
+	}
+
+	clientCA.Certificates = currentCerts
+	clientCABytes, _, err := clientCA.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+	clientCAConfigMap.Data["client-ca.crt"] = string(clientCABytes)
+
+	return ensureConfigMap(c.kubeclientset, clientCAConfigMap)
+}
+
 // ensureServerCertificates handles certificate generating, renewal and rotation for Serving CA bundle and Server certificates.
 // The Serving CA bundle is saved in a ConfigMaps defined in EtcdStorage Spec.
 // The Server certificate/key pair is stored in the Secrets named etcdstorageName-server-cert in the controller namespace.
 // The EtcdProxy controller assumes ConfigMaps for the Serving CA bundle are already created, but if not, the controller will try to create them.
 // Creating ConfigMaps for storing the Serving CA bundle requires the appropriate RBAC roles if RBAC is enabled on cluster.
 //
-// This function reads the Secret in the controller namespace and checks is the 'etcd.xmudrii.com/certificate-expiry-date'
-// annotation present and contains valid date. If date is in the past, i.e. certificate is expired, or the annotation is not present controller:
-// * Generates new CA certificate. The new CA certificate is appended to all ConfigMaps specified by the EtcdStorage Spec.
+// The Server certificate is parsed from the Secret in the controller namespace, and a new Server certificate/key pair is
+// issued if:
+// * the Secret doesn't contain a valid certificate, or the certificate is expired,
+// * the renewal fraction of the certificate lifetime has passed, or the Serving certificate validity in the Spec has changed,
+// * the Server signer has been rotated, once the new Server signer is distributed in the Serving CA bundles by a previous sync.
+// The Server signing certificate and the Server certificate chain are appended to all ConfigMaps specified by the EtcdStorage Spec.
 // Expired CA certificates from the bundle are removed in this phase.
-// * Generates new Server certificate/key pair using the newly generated CA certificate and update Secret in the controller namespace with new pair.
-// * "Restarts" etcd-proxy to pick-up new changes.
-// TODO: Implement "restarting" etcd-proxy. This is going to be done using rolling updates.
-func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev1alpha1.EtcdStorage) error {
+//
+// The etcd-proxy pods are restarted by syncHandler using rolling update, as the hash of the certificates is stamped
+// into the pod template. Once the rollout is done, old CA certificates are removed from the bundle by removeStaleServingCAs.
+// The Server signer rotation is recorded in the EtcdStorage status.
+func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	servingCA, err := c.generateServerSigningCertKeyPair(etcdstorage)
+	if err != nil {
+		return err
+	}
+	recorded := etcdstorage.Status.ServerCertificates
+	rotation := c.signerRotation(recorded, servingCA)
+
 	serverSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdProxyServerCertsSecret(etcdstorage), metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		serverSecret = &v1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:        etcdProxyServerCertsSecret(etcdstorage),
-				Namespace:   c.config.ControllerNamespace,
-				Annotations: map[string]string{},
+				Name:      etcdProxyServerCertsSecret(etcdstorage),
+				Namespace: c.config.ControllerNamespace,
 			},
 			Type: v1.SecretTypeTLS,
-			Data: map[string][]byte{},
 		}
 		err = nil
 	}
@@ -189,41 +324,19 @@ func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev
 		return err
 	}
 
-	var serverCert *certs.Certificate
-	// Check does the annotation contain valid expiry date, and if not, or it is expired, regenerate the certificate.
-	if expiry, ok := serverSecret.Annotations[ProxyCertificateExpiryAnnotation]; ok {
-		certExpiry, err := time.Parse(time.RFC3339, expiry)
-		if err != nil {
-			return err
+	reason := "certificate not issued"
+	serverCert, err := certs.ParseCertificateBytes(serverSecret.Data["tls.crt"], serverSecret.Data["tls.key"])
+	if err == nil {
+		reason = c.renewalReason(serverCert.Certificates[0], etcdstorage.Spec.ServingCertificateValidity.Duration, !c.useCSR(etcdstorage))
+		// The Server certificate signed by the previous Server signer is reissued only once the new Server signer
+		// was distributed in the Serving CA bundles by a previous sync.
+		if reason == "" && !signedBy(serverCert, servingCA) &&
+			inRotationPhase(recorded, servingCA, etcdstoragev1beta1.CertificateRotationCADistributed) {
+			reason = "signing certificate rotated"
 		}
-		// TODO: Check certExpiry without subtracting as well, to prevent errors if validity in Spec is change. To be fixed in a follow-up.
-		if certExpiry.Add(-1*etcdstorage.Spec.ClientCertificateValidity.Duration/2).Before(time.Now()) || certExpiry.Before(time.Now()) {
-			serverCert, err = c.generateServerBundle(etcdstorage)
-			if err != nil {
-				return err
-			}
-
-			// Write new Server certificate/key pair to the Secret in the controller namespace.
-			serverCertBytes, serverKeyBytes, err := serverCert.GetPEMBytes()
-			if err != nil {
-				return err
-			}
-
-			serverSecret.Annotations = map[string]string{
-				ProxyCertificateExpiryAnnotation: serverCert.Certificates[0].NotAfter.Format(time.RFC3339),
-				ProxyCertificateSignedBy:         serverCert.Certificates[0].Issuer.CommonName,
-			}
-			serverSecret.Data = map[string][]byte{
-				"tls.crt": serverCertBytes,
-				"tls.key": serverKeyBytes,
-			}
-			err = ensureSecret(c.kubeclientset, serverSecret)
-			if err != nil {
-				return err
-			}
-		}
-	} else if !ok { // If the annotation is not present, generate the certificate.
-		serverCert, err = c.generateServerBundle(etcdstorage)
+	}
+	if reason != "" {
+		serverCert, err = c.generateServerBundle(etcdstorage, servingCA)
 		if err != nil {
 			return err
 		}
@@ -233,7 +346,6 @@ func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev
 		if err != nil {
 			return err
 		}
-
 		serverSecret.Annotations = map[string]string{
 			ProxyCertificateExpiryAnnotation: serverCert.Certificates[0].NotAfter.Format(time.RFC3339),
 			ProxyCertificateSignedBy:         serverCert.Certificates[0].Issuer.CommonName,
@@ -242,29 +354,36 @@ func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev
 			"tls.crt": serverCertBytes,
 			"tls.key": serverKeyBytes,
 		}
-		err = ensureSecret(c.kubeclientset, serverSecret)
-		if err != nil {
+		if err := updateCertificateSecret(c.kubeclientset, serverSecret); err != nil {
 			return err
 		}
+		c.recorder.Event(etcdstorage, v1.EventTypeNormal, CertificateRenewed,
+			fmt.Sprintf("Issued Server certificate for Secret %s/%s: %s", serverSecret.Namespace, serverSecret.Name, reason))
 	}
-
-	serverCert, err = certs.ParseCertificateBytes(serverSecret.Data["tls.crt"], serverSecret.Data["tls.key"])
-	if err != nil {
-		return err
+	c.certificateExpiry.observe(etcdstorage, serverCertificate, serverSecret)
+
+	// Append the Server signing certificate and the Server certificate chain to the bundle in all ConfigMaps defined
+	// by EtcdStorage Spec, unless the current Server signer has already been appended.
+	servingCerts := append([]*x509.Certificate{}, servingCA.Certificates...)
+	for _, cert := range serverCert.Certificates {
+		if !containsCertificate(servingCerts, cert) {
+			servingCerts = append(servingCerts, cert)
+		}
 	}
-
-	// Append new Serving CA certificate to the bundle in all ConfigMaps defined by EtcdStorage Spec.
+	signerName := servingCA.Certificates[0].Subject.CommonName
 	var errs []error
 	for _, cm := range etcdstorage.Spec.CACertConfigMaps {
-		// Get CA bundle from the ConfigMap, check does it already have certificates in the bundle, append new one to it,
+		// Get CA bundle from the ConfigMap, check does it already have certificates in the bundle, append new ones to it,
 		// and filter expired certificates.
 		configMap, err := c.kubeclientset.CoreV1().ConfigMaps(cm.Namespace).Get(cm.Name, metav1.GetOptions{})
 		if errors.IsNotFound(err) {
 			configMap = &v1.ConfigMap{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:        cm.Name,
-					Namespace:   cm.Namespace,
-					Annotations: map[string]string{},
+					Name:      cm.Name,
+					Namespace: cm.Namespace,
+					Annotations: map[string]string{
+						CreatedByControllerAnnotation: etcdstorage.Name,
+					},
 				},
 				Data: map[string]string{},
 			}
@@ -274,11 +393,11 @@ func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev
 			return err
 		}
 
-		if signedBy, ok := configMap.Annotations[ProxyCertificateSignedBy]; ok && signedBy == serverCert.Certificates[0].Issuer.CommonName {
+		if appendedSigner, ok := configMap.Annotations[ProxyCertificateSignedBy]; ok && appendedSigner == signerName {
 			continue
 		}
 
-		var ca *certs.Certificate
+		ca := &certs.Certificate{}
 		if oldCABytes, ok := configMap.Data["serving-ca.crt"]; ok {
 			ca, err = certs.ParseCertificateBytes([]byte(oldCABytes), nil)
 			if err != nil {
@@ -286,80 +405,256 @@ func (c *EtcdProxyController) ensureServerCertificates(etcdstorage *etcdstoragev
 				continue
 			}
 		}
-
-		if ca != nil {
-			ca.Certificates = append(ca.Certificates, serverCert.Certificates...)
-		} else {
-			ca = serverCert
+		for _, cert := range servingCerts {
+			if !containsCertificate(ca.Certificates, cert) {
+				ca.Certificates = append(ca.Certificates, cert)
+			}
 		}
 
 		// Filter expired certificates in the Serving CA bundle.
-		ca.Certificates = certs.FilterExpiredCerts(ca.Certificates...)
-		if err != nil {
-			return err
-		}
+		ca.Certificates = certs.FilterExpiredCerts(c.currentTime, ca.Certificates...)
 		// Update appropriate ConfigMap with the new Serving CA bundle.
 		servingCABytes, _, err := ca.GetPEMBytes()
 		if err != nil {
 			return err
 		}
-		configMap.Annotations = map[string]string{
-			ProxyCertificateSignedBy: serverCert.Certificates[0].Issuer.CommonName,
+		// Other keys and annotations of the ConfigMap are kept, as the ConfigMap may be owned by the user.
+		if configMap.Annotations == nil {
+			configMap.Annotations = map[string]string{}
 		}
-		configMap.Data = map[string]string{
-			"serving-ca.crt": string(servingCABytes),
+		configMap.Annotations[ProxyCertificateSignedBy] = signerName
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
 		}
+		configMap.Data["serving-ca.crt"] = string(servingCABytes)
 		err = ensureConfigMap(c.kubeclientset, configMap)
 		if err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	if len(errs) == 0 && signedBy(serverCert, servingCA) && rotation.Phase == etcdstoragev1beta1.CertificateRotationCADistributed {
+		c.setRotationPhase(rotation, etcdstoragev1beta1.CertificateRotationLeafReissued)
+	}
+	etcdstorage.Status.ServerCertificates = rotation
+
 	return utilerrors.NewAggregate(errs)
 }
 
-// generateClientBundle generates new etcd-proxy Client CA bundle.
-func (c *EtcdProxyController) generateClientSigningCertKeyPair(etcdstorage *etcdstoragev1alpha1.EtcdStorage) (*certs.Certificate, error) {
-	currentTime := time.Now
-	r := rand.New(rand.NewSource(currentTime().UnixNano()))
-	serviceUrl := fmt.Sprintf("%s.%s.svc", serviceName(etcdstorage), c.config.ControllerNamespace)
+// removeStaleServingCAs removes certificates that are not part of the current Server certificate chain from the
+// Serving CA bundles in all ConfigMaps defined by the EtcdStorage Spec. It should be called only once all etcd-proxy
+// pods are serving the current Server certificate, otherwise clients would not trust the pods that are not updated yet.
+//
+// Old CA certificates are kept while the new Server signer is being distributed, as the current Server certificate
+// is still signed by the previous Server signer. Once they are removed, the Server signer rotation is completed.
+func (c *EtcdProxyController) removeStaleServingCAs(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	rotation := etcdstorage.Status.ServerCertificates
+	if rotation != nil && rotation.Phase == etcdstoragev1beta1.CertificateRotationCADistributed {
+		return nil
+	}
+
+	serverSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdProxyServerCertsSecret(etcdstorage), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	serverCert, err := certs.ParseCertificateBytes(serverSecret.Data["tls.crt"], nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cm := range etcdstorage.Spec.CACertConfigMaps {
+		configMap, err := c.kubeclientset.CoreV1().ConfigMaps(cm.Namespace).Get(cm.Name, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		caBytes, ok := configMap.Data["serving-ca.crt"]
+		if !ok {
+			continue
+		}
+		ca, err := certs.ParseCertificateBytes([]byte(caBytes), nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var currentCerts []*x509.Certificate
+		for _, cert := range ca.Certificates {
+			if containsCertificate(serverCert.Certificates, cert) {
+				currentCerts = append(currentCerts, cert)
+			}
+		}
+		if len(currentCerts) == len(ca.Certificates) {
+			continue
+		}
+
+		ca.Certificates = currentCerts
+		servingCABytes, _, err := ca.GetPEMBytes()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		configMap.Data["serving-ca.crt"] = string(servingCABytes)
+		if err := ensureConfigMap(c.kubeclientset, configMap); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	// Generate the Client CA bundle.
-	return certs.NewCACertificate(pkix.Name{
-		CommonName: fmt.Sprintf("%s-client-signer-%v", serviceUrl, time.Now().Unix()),
-	}, r.Int63n(100000), etcdstorage.Spec.SigningCertificateValidity, currentTime)
+	if len(errs) == 0 && rotation != nil && rotation.Phase == etcdstoragev1beta1.CertificateRotationLeafReissued {
+		c.setRotationPhase(rotation, etcdstoragev1beta1.CertificateRotationOldCARemoved)
+	}
+
+	return utilerrors.NewAggregate(errs)
 }
 
-// generateClientBundle generates new etcd-proxy client certificate/key pair based on provided Client CA bundle.
-func (c *EtcdProxyController) generateClientCertificate(etcdstorage *etcdstoragev1alpha1.EtcdStorage, clientCABundle *certs.Certificate, clientCertSecret etcdstoragev1alpha1.ClientCertificateDestination) (*certs.Certificate, error) {
-	currentTime := time.Now
-	r := rand.New(rand.NewSource(currentTime().UnixNano()))
+// proxyCertificatesHash calculates the hash of the Server certificate/key pair and the Client CA bundle mounted in
+// etcd-proxy pods, along with the core etcd client certificate issued for the EtcdStorage, if any.
+func (c *EtcdProxyController) proxyCertificatesHash(etcdstorage *etcdstoragev1beta1.EtcdStorage) (string, error) {
+	serverSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdProxyServerCertsSecret(etcdstorage), metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
 
-	return clientCABundle.NewClientCertificate(pkix.Name{CommonName: fmt.Sprintf("client-%s-%s", clientCertSecret.Namespace, clientCertSecret.Name)},
-		r.Int63n(100000), etcdstorage.Spec.ClientCertificateValidity, currentTime)
+	// The Client CA ConfigMap is not created if there are no Client certificates defined in the EtcdStorage Spec.
+	var clientCABytes string
+	clientCAConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdstorage), metav1.GetOptions{})
+	if err == nil {
+		clientCABytes = clientCAConfigMap.Data["client-ca.crt"]
+	} else if !errors.IsNotFound(err) {
+		return "", err
+	}
+
+	data := [][]byte{serverSecret.Data["tls.crt"], serverSecret.Data["tls.key"], []byte(clientCABytes)}
+	if c.config.CoreEtcd.SignerSecretName != "" {
+		coreCertSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdClientCertSecretName(etcdstorage), metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		if err == nil {
+			data = append(data, coreCertSecret.Data["tls.crt"], coreCertSecret.Data["tls.key"])
+		}
+	}
+
+	return certificatesHash(data...), nil
 }
 
-// generateServerBundle generates both Serving CA bundle and Server certificate/key pair.
-func (c *EtcdProxyController) generateServerBundle(etcdstorage *etcdstoragev1alpha1.EtcdStorage) (*certs.Certificate, error) {
-	currentTime := time.Now
-	r := rand.New(rand.NewSource(currentTime().UnixNano()))
-	serviceUrl := fmt.Sprintf("%s.%s.svc", serviceName(etcdstorage), c.config.ControllerNamespace)
+// certificatesHash returns hex encoded SHA256 hash of the provided PEM encoded certificates and keys.
+func certificatesHash(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	// Generate the Serving CA bundle.
-	servingCA, err := certs.NewCACertificate(pkix.Name{
-		CommonName: fmt.Sprintf("%s-server-signer-%v", serviceUrl, time.Now().Unix()),
-	}, r.Int63n(100000), etcdstorage.Spec.SigningCertificateValidity, currentTime)
+// containsCertificate checks is the certificate present in the provided slice of certificates.
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateClientSigningCertKeyPair returns the etcd-proxy Client signing certificate/key pair. The self-generated Client
+// signer is stored in the controller namespace and reused until it nears expiry or Client certificates are revoked.
+// If the EtcdStorage Issuer is set, the issuer CA certificate is used instead. If certificates are issued using CertificateSigningRequests, the CA certificate of
+// the cluster signer is used, without the key.
+func (c *EtcdProxyController) generateClientSigningCertKeyPair(etcdstorage *etcdstoragev1beta1.EtcdStorage) (*certs.Certificate, error) {
+	rotate, err := c.revokeClientCertificates(etcdstorage)
 	if err != nil {
 		return nil, err
 	}
+	if etcdstorage.Spec.Issuer != nil {
+		return c.issuerCertKeyPair(etcdstorage)
+	}
+	if c.useCSR(etcdstorage) {
+		return c.csrSignerCA()
+	}
+
+	// Reuse the stored Client signer, or rotate it if it's not valid long enough to sign Client certificates,
+	// or if Client certificates have to be revoked.
+	return c.signingCertKeyPair(etcdstorage, clientSigner, etcdstorage.Spec.ClientCertificateValidity.Duration, rotate)
+}
+
+// generateClientBundle generates new etcd-proxy client certificate/key pair based on provided Client CA bundle.
+// If certificates are issued using CertificateSigningRequests, the certificate is requested from the cluster signer.
+func (c *EtcdProxyController) generateClientCertificate(etcdstorage *etcdstoragev1beta1.EtcdStorage, clientCABundle *certs.Certificate, clientCertSecret etcdstoragev1beta1.ClientCertificateDestination) (*certs.Certificate, error) {
+	subject := pkix.Name{CommonName: fmt.Sprintf("client-%s-%s", clientCertSecret.Namespace, clientCertSecret.Name)}
+	if c.useCSR(etcdstorage) {
+		return c.requestCertificate(etcdstorage, fmt.Sprintf("client-%s-%s", clientCertSecret.Namespace, clientCertSecret.Name), subject, nil,
+			[]certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageKeyEncipherment, certificatesv1beta1.UsageClientAuth})
+	}
+
+	return clientCABundle.NewClientCertificate(subject, etcdstorage.Spec.ClientCertificateValidity, keyAlgorithm(etcdstorage), c.currentTime)
+}
+
+// generateServerSigningCertKeyPair returns the etcd-proxy Server signing certificate/key pair. The self-generated Server
+// signer is stored in the controller namespace and reused until it nears expiry. If the EtcdStorage Issuer is set, the
+// issuer CA certificate is used instead. If certificates are issued using CertificateSigningRequests, the CA certificate
+// of the cluster signer is used, without the key.
+func (c *EtcdProxyController) generateServerSigningCertKeyPair(etcdstorage *etcdstoragev1beta1.EtcdStorage) (*certs.Certificate, error) {
+	if etcdstorage.Spec.Issuer != nil {
+		return c.issuerCertKeyPair(etcdstorage)
+	}
+	if c.useCSR(etcdstorage) {
+		return c.csrSignerCA()
+	}
+
+	// Reuse the stored Server signer, or rotate it if it's not valid long enough to sign the Server certificate.
+	return c.signingCertKeyPair(etcdstorage, serverSigner, etcdstorage.Spec.ServingCertificateValidity.Duration, false)
+}
+
+// generateServerBundle generates the Server certificate/key pair, signed by the provided Server signing certificate.
+// If certificates are issued using CertificateSigningRequests, the Server certificate is requested from the cluster
+// signer, and the CA certificate of the cluster signer is appended to the chain.
+func (c *EtcdProxyController) generateServerBundle(etcdstorage *etcdstoragev1beta1.EtcdStorage, servingCA *certs.Certificate) (*certs.Certificate, error) {
+	serviceUrl := fmt.Sprintf("%s.%s.svc", serviceName(etcdstorage), c.config.ControllerNamespace)
+
+	if c.useCSR(etcdstorage) {
+		serverCerts, err := c.requestCertificate(etcdstorage, "server", pkix.Name{CommonName: serviceUrl}, []string{serviceUrl},
+			[]certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageKeyEncipherment,
+				certificatesv1beta1.UsageServerAuth, certificatesv1beta1.UsageClientAuth})
+		if err != nil {
+			return nil, err
+		}
+		serverCerts.Certificates = append(serverCerts.Certificates, servingCA.Certificates...)
+		return serverCerts, nil
+	}
 
 	// Generate server certificate/key pair.
 	serverCerts, err := servingCA.NewServerCertificate(pkix.Name{
-		CommonName: fmt.Sprintf("%s-serving-cert-%v", serviceUrl, time.Now().Unix()),
-	}, []string{serviceUrl}, r.Int63n(100000), etcdstorage.Spec.ServingCertificateValidity, currentTime)
+		CommonName: fmt.Sprintf("%s-serving-cert-%v", serviceUrl, c.currentTime().Unix()),
+	}, []string{serviceUrl}, etcdstorage.Spec.ServingCertificateValidity, keyAlgorithm(etcdstorage), c.currentTime)
 	if err != nil {
 		return nil, err
 	}
 
 	return serverCerts, nil
 }
+
+// issuerCertKeyPair loads the intermediate CA certificate/key pair from the Secret referenced by the EtcdStorage Issuer.
+// The rest of the certificate chain, if present in the Secret, is kept after the CA certificate, so it's served along
+// with the Server certificate and distributed in the CA bundles.
+func (c *EtcdProxyController) issuerCertKeyPair(etcdstorage *etcdstoragev1beta1.EtcdStorage) (*certs.Certificate, error) {
+	issuer := etcdstorage.Spec.Issuer
+	secret, err := c.kubeclientset.CoreV1().Secrets(issuer.Namespace).Get(issuer.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("unable to load issuer from secret %s/%s: %v", issuer.Namespace, issuer.Name, err)
+	}
+	if ca.Key == nil {
+		return nil, fmt.Errorf("issuer secret %s/%s doesn't contain the CA key", issuer.Namespace, issuer.Name)
+	}
+	if !ca.Certificates[0].IsCA {
+		return nil, fmt.Errorf("certificate in issuer secret %s/%s is not a CA certificate", issuer.Namespace, issuer.Name)
+	}
+
+	return ca, nil
+}
@@ -1,6 +1,11 @@
 package etcdproxy
 
 import (
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
 
 	"k8s.io/api/core/v1"
@@ -9,16 +14,16 @@ import (
 
 	"time"
 
-	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
 )
 
 func TestEnsureServerCertificates(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				CACertConfigMaps: []v1alpha1.CABundleDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
 					{
 						Name:      "etcd-serving-ca",
 						Namespace: "k8s-sample-apiserver",
@@ -41,7 +46,7 @@ func TestEnsureServerCertificates(t *testing.T) {
 	tests := []struct {
 		name                string
 		etcdProxyConfig     *EtcdProxyControllerConfig
-		startingEtcdStorage *v1alpha1.EtcdStorage
+		startingEtcdStorage *v1beta1.EtcdStorage
 		startingConfigMaps  []*v1.ConfigMap
 	}{
 		{
@@ -88,7 +93,7 @@ func TestEnsureServerCertificates(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			newDest := v1alpha1.CABundleDestination{
+			newDest := v1beta1.CABundleDestination{
 				Name:      tc.startingConfigMaps[1].Name,
 				Namespace: tc.startingConfigMaps[1].Namespace,
 			}
@@ -128,11 +133,11 @@ func TestEnsureServerCertificates(t *testing.T) {
 }
 
 func TestEnsureServerCertificatesDuplication(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				CACertConfigMaps: []v1alpha1.CABundleDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
 					{
 						Name:      "etcd-serving-ca",
 						Namespace: "k8s-sample-apiserver",
@@ -155,7 +160,7 @@ func TestEnsureServerCertificatesDuplication(t *testing.T) {
 	tests := []struct {
 		name                string
 		etcdProxyConfig     *EtcdProxyControllerConfig
-		startingEtcdStorage *v1alpha1.EtcdStorage
+		startingEtcdStorage *v1beta1.EtcdStorage
 		startingConfigMaps  []*v1.ConfigMap
 	}{
 		{
@@ -233,11 +238,11 @@ func TestEnsureServerCertificatesDuplication(t *testing.T) {
 }
 
 func TestEnsureClientCertificates(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				ClientCertSecrets: []v1alpha1.ClientCertificateDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
 					{
 						Name:      "etcd-client-cert",
 						Namespace: "k8s-sample-apiserver",
@@ -261,7 +266,7 @@ func TestEnsureClientCertificates(t *testing.T) {
 	tests := []struct {
 		name                string
 		etcdProxyConfig     *EtcdProxyControllerConfig
-		startingEtcdStorage *v1alpha1.EtcdStorage
+		startingEtcdStorage *v1beta1.EtcdStorage
 		startingSecrets     []*v1.Secret
 	}{
 		{
@@ -311,7 +316,7 @@ func TestEnsureClientCertificates(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			newDest := v1alpha1.ClientCertificateDestination{
+			newDest := v1beta1.ClientCertificateDestination{
 				Name:      tc.startingSecrets[1].Name,
 				Namespace: tc.startingSecrets[1].Namespace,
 			}
@@ -357,11 +362,11 @@ func TestEnsureClientCertificates(t *testing.T) {
 }
 
 func TestEnsureClientCertificatesDuplication(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				ClientCertSecrets: []v1alpha1.ClientCertificateDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
 					{
 						Name:      "etcd-client-cert",
 						Namespace: "k8s-sample-apiserver",
@@ -385,7 +390,7 @@ func TestEnsureClientCertificatesDuplication(t *testing.T) {
 	tests := []struct {
 		name                string
 		etcdProxyConfig     *EtcdProxyControllerConfig
-		startingEtcdStorage *v1alpha1.EtcdStorage
+		startingEtcdStorage *v1beta1.EtcdStorage
 		startingSecrets     []*v1.Secret
 	}{
 		{
@@ -467,3 +472,237 @@ func TestEnsureClientCertificatesDuplication(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveStaleServingCAs(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "certs-test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			CACertConfigMaps: []v1beta1.CABundleDestination{
+				{
+					Name:      "etcd-serving-ca",
+					Namespace: "k8s-sample-apiserver",
+				},
+			},
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-serving-ca",
+			Namespace: "k8s-sample-apiserver",
+		},
+	}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, configMap})
+	err := c.ensureServerCertificates(etcdStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a CA certificate that signed the previous server certificate to the bundle.
+	cm, err := c.kubeclientset.CoreV1().ConfigMaps(configMap.Namespace).Get(configMap.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := certs.ParseCertificateBytes([]byte(cm.Data["serving-ca.crt"]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCA, err := certs.NewCACertificate(pkix.Name{CommonName: "old-server-signer"}, metav1.Duration{time.Hour * 24 * 60}, "", time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.Certificates = append(oldCA.Certificates, bundle.Certificates...)
+	bundleBytes, _, err := bundle.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.Data["serving-ca.crt"] = string(bundleBytes)
+	_, err = c.kubeclientset.CoreV1().ConfigMaps(cm.Namespace).Update(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.removeStaleServingCAs(etcdStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err = c.kubeclientset.CoreV1().ConfigMaps(configMap.Namespace).Get(configMap.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certs.ParseCertificateBytes([]byte(cm.Data["serving-ca.crt"]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crt.Certificates) != 2 {
+		t.Fatalf("expected 2 certificates (ca + server) in the serving chain but got '%d'", len(crt.Certificates))
+	}
+	for _, cert := range crt.Certificates {
+		if cert.Subject.CommonName == "old-server-signer" {
+			t.Fatal("expected old CA certificate to be removed from the serving chain")
+		}
+	}
+}
+
+func TestIssuerCertificates(t *testing.T) {
+	validity := metav1.Duration{time.Hour * 24 * 60}
+	rootCA, err := certs.NewCACertificate(pkix.Name{CommonName: "root-ca"}, validity, "", time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateKey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "intermediate-ca"},
+		SerialNumber:          big.NewInt(2),
+		NotBefore:             time.Now().Add(-1 * time.Second),
+		NotAfter:              time.Now().Add(validity.Duration),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	intermediateDER, err := x509.CreateCertificate(cryptorand.Reader, intermediateTemplate, rootCA.Certificates[0], &intermediateKey.PublicKey, rootCA.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateCert, err := x509.ParseCertificate(intermediateDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerCertBytes, issuerKeyBytes, err := (&certs.Certificate{
+		Certificates: []*x509.Certificate{intermediateCert, rootCA.Certificates[0]},
+		Key:          intermediateKey,
+	}).GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCA.Certificates[0])
+
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "certs-test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			CACertConfigMaps: []v1beta1.CABundleDestination{
+				{
+					Name:      "etcd-serving-ca",
+					Namespace: "k8s-sample-apiserver",
+				},
+			},
+			ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+				{
+					Name:      "etcd-client-cert",
+					Namespace: "k8s-sample-apiserver",
+				},
+			},
+			SigningCertificateValidity: validity,
+			ServingCertificateValidity: validity,
+			ClientCertificateValidity:  validity,
+			Issuer: &v1beta1.IssuerReference{
+				Name:      "intermediate-ca",
+				Namespace: "security",
+			},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	issuerSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "intermediate-ca",
+			Namespace: "security",
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": issuerCertBytes,
+			"tls.key": issuerKeyBytes,
+		},
+	}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, issuerSecret})
+	if err := c.ensureServerCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+
+	// Server and Client certificates chain to the root CA through the intermediate CA.
+	serverSecret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdProxyServerCertsSecret(etcdStorage), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := certs.ParseCertificateBytes(serverSecret.Data["tls.crt"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range serverCert.Certificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := serverCert.Certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Fatalf("expected server certificate to chain to the root CA: %v", err)
+	}
+
+	clientSecret, err := c.kubeclientset.CoreV1().Secrets("k8s-sample-apiserver").Get("etcd-client-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := certs.ParseCertificateBytes(clientSecret.Data["tls.crt"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediates = x509.NewCertPool()
+	intermediates.AddCert(intermediateCert)
+	if _, err := clientCert.Certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("expected client certificate to chain to the root CA: %v", err)
+	}
+
+	// Renewing Client certificates doesn't duplicate the issuer CA certificate in the Client CA bundle.
+	delete(clientSecret.Annotations, ProxyCertificateExpiryAnnotation)
+	if _, err := c.kubeclientset.CoreV1().Secrets(clientSecret.Namespace).Update(clientSecret); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	clientCAConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(etcdProxyConfig.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdStorage), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA, err := certs.ParseCertificateBytes([]byte(clientCAConfigMap.Data["client-ca.crt"]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientCA.Certificates) != 2 {
+		t.Fatalf("expected 2 certificates (intermediate + root) in the client CA bundle but got '%d'", len(clientCA.Certificates))
+	}
+
+	// Missing issuer Secret fails certificate generation.
+	etcdStorage.Spec.Issuer.Name = "missing-ca"
+	etcdStorage.Name = "certs-test-2"
+	if err := c.ensureServerCertificates(etcdStorage); err == nil {
+		t.Fatal("expected error when the issuer secret is missing")
+	}
+}
@@ -0,0 +1,186 @@
+package etcdproxy
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const (
+	// CleanupFinalizer is used to clean up Secrets and ConfigMaps managed by the controller before
+	// the EtcdStorage resource is deleted.
+	CleanupFinalizer = "etcd.xmudrii.com/cleanup"
+
+	// CleanupFailure is used as part of the Event reason when Secrets and ConfigMaps managed by the controller
+	// are not cleaned up successfully.
+	CleanupFailure = "CleanupFailure"
+
+	// CreatedByControllerAnnotation contains the name of the EtcdStorage for which the controller has created
+	// the Secret or the ConfigMap defined in the EtcdStorage Spec. Only such Secrets and ConfigMaps are deleted
+	// by the Delete cleanup policy.
+	CreatedByControllerAnnotation = "etcd.xmudrii.com/created-by-controller"
+)
+
+// cleanupCertificates handles Secrets and ConfigMaps managed by the controller for the EtcdStorage being deleted,
+// as defined by the EtcdStorage cleanup policy. Those are Secrets and ConfigMaps defined in the EtcdStorage Spec,
+// as well as the Client CA ConfigMap, and the Server certificate and signer Secrets in
+// the controller namespace.
+//
+// With the Delete policy, Secrets and ConfigMaps in the controller namespace are deleted. Secrets and ConfigMaps
+// defined in the EtcdStorage Spec are deleted only if the controller has created them. Otherwise, they are owned by
+// the user, so only the certificates and annotations written by the controller are removed from them. With the Orphan
+// policy, certificates are kept, but the controller annotations are removed. With the Retain policy, Secrets and
+// ConfigMaps are not changed. Pending CertificateSigningRequests are deleted regardless of the policy.
+//
+// Data snapshot Secrets are kept regardless of the policy, as they are the only copy of the data if
+// the DataRetentionPolicy is Snapshot.
+func (c *EtcdProxyController) cleanupCertificates(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if err := c.cleanupCertificateSigningRequests(etcdstorage); err != nil {
+		return err
+	}
+
+	policy := etcdstorage.Spec.CleanupPolicy
+	if policy == "" {
+		policy = etcdstoragev1beta1.CleanupPolicyDelete
+	}
+	if policy == etcdstoragev1beta1.CleanupPolicyRetain {
+		return nil
+	}
+
+	var errs []error
+	for _, name := range []string{
+		etcdProxyServerCertsSecret(etcdstorage),
+		etcdProxyClientSignerSecretName(etcdstorage),
+		etcdProxyServerSignerSecretName(etcdstorage),
+	} {
+		if err := c.cleanupSecret(etcdstorage, policy, c.config.ControllerNamespace, name, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, s := range etcdstorage.Spec.ClientCertSecrets {
+		if err := c.cleanupSecret(etcdstorage, policy, s.Namespace, s.Name, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := c.cleanupConfigMap(etcdstorage, policy, c.config.ControllerNamespace, etcdProxyCAConfigMapName(etcdstorage), true); err != nil {
+		errs = append(errs, err)
+	}
+	for _, cm := range etcdstorage.Spec.CACertConfigMaps {
+		if err := c.cleanupConfigMap(etcdstorage, policy, cm.Namespace, cm.Name, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// cleanupSecret handles the Secret containing a certificate as defined by the cleanup policy. Secrets owned by
+// the controller are deleted by the Delete policy, while only certificates are removed from other Secrets.
+// The tls.crt and tls.key keys are required in kubernetes.io/tls Secrets, so they are emptied instead.
+func (c *EtcdProxyController) cleanupSecret(etcdstorage *etcdstoragev1beta1.EtcdStorage, policy etcdstoragev1beta1.CleanupPolicy,
+	namespace, name string, owned bool) error {
+	secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if policy == etcdstoragev1beta1.CleanupPolicyDelete && (owned || createdByController(etcdstorage, secret.ObjectMeta)) {
+		err := c.kubeclientset.CoreV1().Secrets(namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	modified := removeControllerAnnotations(&secret.ObjectMeta)
+	if policy == etcdstoragev1beta1.CleanupPolicyDelete {
+		for _, key := range []string{"tls.crt", "tls.key"} {
+			if len(secret.Data[key]) == 0 {
+				continue
+			}
+			if secret.Type == corev1.SecretTypeTLS {
+				secret.Data[key] = []byte{}
+			} else {
+				delete(secret.Data, key)
+			}
+			modified = true
+		}
+	}
+	if !modified {
+		return nil
+	}
+	_, err = c.kubeclientset.CoreV1().Secrets(namespace).Update(secret)
+	return err
+}
+
+// cleanupConfigMap handles the ConfigMap containing a CA bundle as defined by the cleanup policy. ConfigMaps owned by
+// the controller are deleted by the Delete policy, while only the Serving CA bundle is removed from other ConfigMaps.
+func (c *EtcdProxyController) cleanupConfigMap(etcdstorage *etcdstoragev1beta1.EtcdStorage, policy etcdstoragev1beta1.CleanupPolicy,
+	namespace, name string, owned bool) error {
+	configMap, err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if policy == etcdstoragev1beta1.CleanupPolicyDelete && (owned || createdByController(etcdstorage, configMap.ObjectMeta)) {
+		err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	modified := removeControllerAnnotations(&configMap.ObjectMeta)
+	if _, ok := configMap.Data["serving-ca.crt"]; ok && policy == etcdstoragev1beta1.CleanupPolicyDelete {
+		delete(configMap.Data, "serving-ca.crt")
+		modified = true
+	}
+	if !modified {
+		return nil
+	}
+	_, err = c.kubeclientset.CoreV1().ConfigMaps(namespace).Update(configMap)
+	return err
+}
+
+// createdByController checks was the Secret or the ConfigMap created by the controller for the EtcdStorage.
+func createdByController(etcdstorage *etcdstoragev1beta1.EtcdStorage, meta metav1.ObjectMeta) bool {
+	return meta.Annotations[CreatedByControllerAnnotation] == etcdstorage.Name
+}
+
+// addFinalizer adds the finalizer to the EtcdStorage resource, if it's not already present.
+func (c *EtcdProxyController) addFinalizer(etcdstorage *etcdstoragev1beta1.EtcdStorage, finalizer string) (*etcdstoragev1beta1.EtcdStorage, error) {
+	if hasFinalizer(etcdstorage.Finalizers, finalizer) {
+		return etcdstorage, nil
+	}
+
+	etcdstorageCopy := etcdstorage.DeepCopy()
+	etcdstorageCopy.Finalizers = append(etcdstorageCopy.Finalizers, finalizer)
+	return c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Update(etcdstorageCopy)
+}
+
+// removeFinalizer removes the finalizer from the EtcdStorage resource, if it's present.
+func (c *EtcdProxyController) removeFinalizer(etcdstorage *etcdstoragev1beta1.EtcdStorage, finalizer string) (*etcdstoragev1beta1.EtcdStorage, error) {
+	if !hasFinalizer(etcdstorage.Finalizers, finalizer) {
+		return etcdstorage, nil
+	}
+
+	etcdstorageCopy := etcdstorage.DeepCopy()
+	var finalizers []string
+	for _, f := range etcdstorageCopy.Finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	etcdstorageCopy.Finalizers = finalizers
+	return c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Update(etcdstorageCopy)
+}
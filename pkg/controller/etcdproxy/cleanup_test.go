@@ -0,0 +1,225 @@
+package etcdproxy
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestCleanupCertificates(t *testing.T) {
+	etcdStorage := func(name string, policy v1beta1.CleanupPolicy) *v1beta1.EtcdStorage {
+		deletionTimestamp := metav1.NewTime(time.Now())
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				DeletionTimestamp: &deletionTimestamp,
+				Finalizers:        []string{CleanupFinalizer},
+			},
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
+					{
+						Name:      "etcd-serving-ca",
+						Namespace: "k8s-sample-apiserver",
+					},
+				},
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+					{
+						Name:      "etcd-client-cert",
+						Namespace: "k8s-sample-apiserver",
+					},
+				},
+				SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+				CleanupPolicy:              policy,
+			},
+		}
+	}
+	// Objects created by the controller are annotated with the EtcdStorage name, while objects created by the user
+	// contain a key not written by the controller.
+	configMap := func(name, namespace, createdFor string) *v1.ConfigMap {
+		configMap := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					ProxyCertificateSignedBy: "test-signer",
+				},
+			},
+			Data: map[string]string{
+				"serving-ca.crt": "test",
+			},
+		}
+		if createdFor != "" {
+			configMap.Annotations[CreatedByControllerAnnotation] = createdFor
+		} else {
+			configMap.Data["user-key"] = "test"
+		}
+		return configMap
+	}
+	secret := func(name, namespace, createdFor string) *v1.Secret {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					ProxyCertificateExpiryAnnotation: time.Now().Format(time.RFC3339),
+					ProxyCertificateSignedBy:         "test-signer",
+				},
+			},
+			Type: v1.SecretTypeTLS,
+			Data: map[string][]byte{
+				"tls.crt": []byte("test"),
+				"tls.key": []byte("test"),
+			},
+		}
+		if createdFor != "" {
+			secret.Annotations[CreatedByControllerAnnotation] = createdFor
+		} else {
+			secret.Data["user-key"] = []byte("test")
+		}
+		return secret
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+
+	tests := []struct {
+		name                  string
+		startingEtcdStorage   *v1beta1.EtcdStorage
+		createdByUser         bool
+		expectDeleted         bool
+		expectConsumerDeleted bool
+		expectAnnotations     bool
+		expectCertificates    bool
+	}{
+		{
+			name:                  "default policy deletes secrets and configmaps",
+			startingEtcdStorage:   etcdStorage("test-1", ""),
+			expectDeleted:         true,
+			expectConsumerDeleted: true,
+		},
+		{
+			name:                  "delete policy deletes secrets and configmaps",
+			startingEtcdStorage:   etcdStorage("test-2", v1beta1.CleanupPolicyDelete),
+			expectDeleted:         true,
+			expectConsumerDeleted: true,
+		},
+		{
+			name:                "delete policy removes certificates from secrets and configmaps created by the user",
+			startingEtcdStorage: etcdStorage("test-3", v1beta1.CleanupPolicyDelete),
+			createdByUser:       true,
+			expectDeleted:       true,
+		},
+		{
+			name:                "retain policy keeps secrets and configmaps unchanged",
+			startingEtcdStorage: etcdStorage("test-4", v1beta1.CleanupPolicyRetain),
+			expectAnnotations:   true,
+			expectCertificates:  true,
+		},
+		{
+			name:                "orphan policy removes controller annotations",
+			startingEtcdStorage: etcdStorage("test-5", v1beta1.CleanupPolicyOrphan),
+			expectCertificates:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es := tc.startingEtcdStorage
+			createdFor := es.Name
+			if tc.createdByUser {
+				createdFor = ""
+			}
+			testObjs := []runtime.Object{
+				es,
+				configMap("etcd-serving-ca", "k8s-sample-apiserver", createdFor),
+				configMap(etcdProxyCAConfigMapName(es), etcdProxyConfig.ControllerNamespace, es.Name),
+				secret("etcd-client-cert", "k8s-sample-apiserver", createdFor),
+				secret(etcdProxyServerCertsSecret(es), etcdProxyConfig.ControllerNamespace, es.Name),
+			}
+			c := newEtcdProxyControllerMock(etcdProxyConfig, testObjs)
+
+			err := c.syncHandler(es.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range []struct {
+				v1beta1.ClientCertificateDestination
+				expectDeleted bool
+			}{
+				{v1beta1.ClientCertificateDestination{Name: "etcd-client-cert", Namespace: "k8s-sample-apiserver"}, tc.expectConsumerDeleted},
+				{v1beta1.ClientCertificateDestination{Name: etcdProxyServerCertsSecret(es), Namespace: etcdProxyConfig.ControllerNamespace}, tc.expectDeleted},
+			} {
+				secret, err := c.kubeclientset.CoreV1().Secrets(s.Namespace).Get(s.Name, metav1.GetOptions{})
+				if s.expectDeleted {
+					if !errors.IsNotFound(err) {
+						t.Fatalf("expected secret '%s/%s' to be deleted, but got: %v", s.Namespace, s.Name, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := secret.Annotations[ProxyCertificateSignedBy]; ok != tc.expectAnnotations {
+					t.Fatalf("expected annotations present in secret '%s/%s' to be %v", s.Namespace, s.Name, tc.expectAnnotations)
+				}
+				if (len(secret.Data["tls.crt"]) != 0) != tc.expectCertificates {
+					t.Fatalf("expected certificate present in secret '%s/%s' to be %v", s.Namespace, s.Name, tc.expectCertificates)
+				}
+				if tc.createdByUser && len(secret.Data["user-key"]) == 0 {
+					t.Fatalf("expected user keys in secret '%s/%s' to be kept", s.Namespace, s.Name)
+				}
+			}
+
+			for _, cm := range []struct {
+				v1beta1.CABundleDestination
+				expectDeleted bool
+			}{
+				{v1beta1.CABundleDestination{Name: "etcd-serving-ca", Namespace: "k8s-sample-apiserver"}, tc.expectConsumerDeleted},
+				{v1beta1.CABundleDestination{Name: etcdProxyCAConfigMapName(es), Namespace: etcdProxyConfig.ControllerNamespace}, tc.expectDeleted},
+			} {
+				configMap, err := c.kubeclientset.CoreV1().ConfigMaps(cm.Namespace).Get(cm.Name, metav1.GetOptions{})
+				if cm.expectDeleted {
+					if !errors.IsNotFound(err) {
+						t.Fatalf("expected configmap '%s/%s' to be deleted, but got: %v", cm.Namespace, cm.Name, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := configMap.Annotations[ProxyCertificateSignedBy]; ok != tc.expectAnnotations {
+					t.Fatalf("expected annotations present in configmap '%s/%s' to be %v", cm.Namespace, cm.Name, tc.expectAnnotations)
+				}
+				if _, ok := configMap.Data["serving-ca.crt"]; ok != tc.expectCertificates {
+					t.Fatalf("expected ca bundle present in configmap '%s/%s' to be %v", cm.Namespace, cm.Name, tc.expectCertificates)
+				}
+				if tc.createdByUser && configMap.Data["user-key"] == "" {
+					t.Fatalf("expected user keys in configmap '%s/%s' to be kept", cm.Namespace, cm.Name)
+				}
+			}
+
+			updated, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer(updated.Finalizers, CleanupFinalizer) {
+				t.Fatalf("expected finalizer '%s' to be removed", CleanupFinalizer)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package etcdproxy
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// availableCondition calculates the Available condition from the etcd-proxy Deployment status and
+// the etcd-proxy Service endpoints. The EtcdStorage is available if at least one etcd-proxy pod is
+// available and ready to serve traffic through the Service.
+func availableCondition(deployment *appsv1.Deployment, endpoints *corev1.Endpoints) etcdstoragev1beta1.EtcdStorageCondition {
+	condition := etcdstoragev1beta1.EtcdStorageCondition{
+		Type:               etcdstoragev1beta1.Available,
+		Status:             etcdstoragev1beta1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	if deployment == nil {
+		condition.Reason = "DeploymentNotFound"
+		condition.Message = "etcd-proxy deployment is not created"
+		return condition
+	}
+	if deployment.Status.AvailableReplicas == 0 {
+		condition.Reason = "NoReplicasAvailable"
+		condition.Message = fmt.Sprintf("no etcd-proxy pods of deployment %s are available", deployment.Name)
+		return condition
+	}
+
+	readyAddresses := 0
+	if endpoints != nil {
+		for _, subset := range endpoints.Subsets {
+			readyAddresses += len(subset.Addresses)
+		}
+	}
+	if readyAddresses == 0 {
+		condition.Reason = "NoEndpoints"
+		condition.Message = "etcd-proxy service has no ready endpoints"
+		return condition
+	}
+
+	condition.Status = etcdstoragev1beta1.ConditionTrue
+	condition.Reason = "MinimumReplicasAvailable"
+	condition.Message = fmt.Sprintf("%d of %d etcd-proxy pods are available", deployment.Status.AvailableReplicas, desiredReplicas(deployment))
+	return condition
+}
+
+// progressingCondition calculates the Progressing condition from the etcd-proxy Deployment status. The EtcdStorage
+// is progressing while etcd-proxy pods are being updated, and until all updated pods are available.
+func progressingCondition(deployment *appsv1.Deployment) etcdstoragev1beta1.EtcdStorageCondition {
+	condition := etcdstoragev1beta1.EtcdStorageCondition{
+		Type:               etcdstoragev1beta1.Progressing,
+		Status:             etcdstoragev1beta1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	if deployment == nil {
+		condition.Reason = "DeploymentNotFound"
+		condition.Message = "etcd-proxy deployment is not created"
+		return condition
+	}
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse {
+			condition.Reason = cond.Reason
+			condition.Message = cond.Message
+			return condition
+		}
+	}
+
+	replicas := desiredReplicas(deployment)
+	if deployment.Generation > deployment.Status.ObservedGeneration ||
+		deployment.Status.UpdatedReplicas < replicas ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		condition.Status = etcdstoragev1beta1.ConditionTrue
+		condition.Reason = "RollingOut"
+		condition.Message = fmt.Sprintf("%d of %d etcd-proxy pods are updated, %d are available",
+			deployment.Status.UpdatedReplicas, replicas, deployment.Status.AvailableReplicas)
+		return condition
+	}
+
+	condition.Reason = "RolledOut"
+	condition.Message = "all etcd-proxy pods are updated and available"
+	return condition
+}
+
+// certificatesReadyCondition calculates the CertificatesReady condition from errors returned while generating
+// and deploying certificates and CA bundles.
+func certificatesReadyCondition(certErrs []error) etcdstoragev1beta1.EtcdStorageCondition {
+	if len(certErrs) != 0 {
+		return etcdstoragev1beta1.EtcdStorageCondition{
+			Type:               etcdstoragev1beta1.CertificatesReady,
+			Status:             etcdstoragev1beta1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             CertificatesDeployFailure,
+			Message:            utilerrors.NewAggregate(certErrs).Error(),
+		}
+	}
+
+	return etcdstoragev1beta1.EtcdStorageCondition{
+		Type:               etcdstoragev1beta1.CertificatesReady,
+		Status:             etcdstoragev1beta1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "CertificatesDeployed",
+		Message:            "certificates and ca bundles are deployed",
+	}
+}
+
+// desiredReplicas returns the number of replicas requested by the Deployment.
+func desiredReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
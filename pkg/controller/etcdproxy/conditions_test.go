@@ -0,0 +1,181 @@
+package etcdproxy
+
+import (
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func newTestDeployment(replicas int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "etcd-test-1",
+			Namespace:  "test-storage",
+			Generation: 1,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: status,
+	}
+}
+
+func TestAvailableCondition(t *testing.T) {
+	endpoints := func(addresses int) *v1.Endpoints {
+		subset := v1.EndpointSubset{}
+		for i := 0; i < addresses; i++ {
+			subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: fmt.Sprintf("10.0.0.%d", i+1)})
+		}
+		return &v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd-test-1", Namespace: "test-storage"},
+			Subsets:    []v1.EndpointSubset{subset},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		deployment     *appsv1.Deployment
+		endpoints      *v1.Endpoints
+		expectedStatus v1beta1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "deployment not created",
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "DeploymentNotFound",
+		},
+		{
+			name:           "no replicas available",
+			deployment:     newTestDeployment(3, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3}),
+			endpoints:      endpoints(0),
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "NoReplicasAvailable",
+		},
+		{
+			name:           "no endpoints",
+			deployment:     newTestDeployment(3, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}),
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "NoEndpoints",
+		},
+		{
+			name:           "no ready endpoints",
+			deployment:     newTestDeployment(3, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}),
+			endpoints:      endpoints(0),
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "NoEndpoints",
+		},
+		{
+			name:           "some replicas available",
+			deployment:     newTestDeployment(3, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 1}),
+			endpoints:      endpoints(1),
+			expectedStatus: v1beta1.ConditionTrue,
+			expectedReason: "MinimumReplicasAvailable",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			condition := availableCondition(tc.deployment, tc.endpoints)
+			if condition.Type != v1beta1.Available {
+				t.Fatalf("expected condition type '%s', but got '%s'", v1beta1.Available, condition.Type)
+			}
+			if condition.Status != tc.expectedStatus || condition.Reason != tc.expectedReason {
+				t.Fatalf("expected status '%s' with reason '%s', but got '%s' with reason '%s'",
+					tc.expectedStatus, tc.expectedReason, condition.Status, condition.Reason)
+			}
+		})
+	}
+}
+
+func TestProgressingCondition(t *testing.T) {
+	tests := []struct {
+		name           string
+		deployment     *appsv1.Deployment
+		expectedStatus v1beta1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "deployment not created",
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "DeploymentNotFound",
+		},
+		{
+			name:           "deployment not observed",
+			deployment:     newTestDeployment(3, appsv1.DeploymentStatus{}),
+			expectedStatus: v1beta1.ConditionTrue,
+			expectedReason: "RollingOut",
+		},
+		{
+			name: "pods not updated",
+			deployment: newTestDeployment(3, appsv1.DeploymentStatus{
+				ObservedGeneration: 1, Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3,
+			}),
+			expectedStatus: v1beta1.ConditionTrue,
+			expectedReason: "RollingOut",
+		},
+		{
+			name: "updated pods not available",
+			deployment: newTestDeployment(3, appsv1.DeploymentStatus{
+				ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2,
+			}),
+			expectedStatus: v1beta1.ConditionTrue,
+			expectedReason: "RollingOut",
+		},
+		{
+			name: "progress deadline exceeded",
+			deployment: newTestDeployment(3, appsv1.DeploymentStatus{
+				ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3,
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:   appsv1.DeploymentProgressing,
+						Status: v1.ConditionFalse,
+						Reason: "ProgressDeadlineExceeded",
+					},
+				},
+			}),
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "ProgressDeadlineExceeded",
+		},
+		{
+			name: "rolled out",
+			deployment: newTestDeployment(3, appsv1.DeploymentStatus{
+				ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3,
+			}),
+			expectedStatus: v1beta1.ConditionFalse,
+			expectedReason: "RolledOut",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			condition := progressingCondition(tc.deployment)
+			if condition.Type != v1beta1.Progressing {
+				t.Fatalf("expected condition type '%s', but got '%s'", v1beta1.Progressing, condition.Type)
+			}
+			if condition.Status != tc.expectedStatus || condition.Reason != tc.expectedReason {
+				t.Fatalf("expected status '%s' with reason '%s', but got '%s' with reason '%s'",
+					tc.expectedStatus, tc.expectedReason, condition.Status, condition.Reason)
+			}
+		})
+	}
+}
+
+func TestCertificatesReadyCondition(t *testing.T) {
+	condition := certificatesReadyCondition(nil)
+	if condition.Type != v1beta1.CertificatesReady || condition.Status != v1beta1.ConditionTrue {
+		t.Fatalf("expected condition '%s' to be true, but got %+v", v1beta1.CertificatesReady, condition)
+	}
+
+	condition = certificatesReadyCondition([]error{fmt.Errorf("secrets \"etcd-client-cert\" not found")})
+	if condition.Type != v1beta1.CertificatesReady || condition.Status != v1beta1.ConditionFalse {
+		t.Fatalf("expected condition '%s' to be false, but got %+v", v1beta1.CertificatesReady, condition)
+	}
+	if condition.Message != "secrets \"etcd-client-cert\" not found" {
+		t.Fatalf("expected condition message to contain the error, but got '%s'", condition.Message)
+	}
+}
@@ -1,6 +1,8 @@
 package etcdproxy
 
 import (
+	"time"
+
 	restclient "k8s.io/client-go/rest"
 )
 
@@ -17,6 +19,35 @@ type EtcdProxyControllerConfig struct {
 
 	// ProxyImage is name of the etcd image to be used for etcd-proxy Deployment creation.
 	ProxyImage string
+
+	// ProxyPodTemplateConfigMapName is the name of the ConfigMap in the controller namespace containing the default
+	// pod template for etcd-proxy Deployments. If empty, the default pod template is not used.
+	ProxyPodTemplateConfigMapName string
+
+	// CertificateValidityDefaults contains certificate validities used if validities are not set in the EtcdStorage spec.
+	CertificateValidityDefaults *CertificateValidityDefaultsConfig
+
+	// CertificateRenewalFraction is the fraction of the certificate lifetime after which the certificate is renewed.
+	// If not between 0 and 1, DefaultCertificateRenewalFraction is used.
+	CertificateRenewalFraction float64
+
+	// UsageMeasurementPeriod is how often the usage of the core etcd is measured.
+	UsageMeasurementPeriod time.Duration
+
+	// MetricsAddress is the address on which Prometheus metrics are served. If empty, metrics are not served.
+	MetricsAddress string
+
+	// HealthAddress is the address on which health and readiness checks are served. If empty, checks are not served.
+	HealthAddress string
+
+	// LeaderElection contains information needed to elect the leader among multiple controller replicas.
+	LeaderElection *LeaderElectionConfig
+
+	// Webhook contains information needed to serve the EtcdStorage validating and conversion webhooks.
+	Webhook *WebhookConfig
+
+	// CSR contains information needed to issue etcd-proxy certificates using the Kubernetes CSR API.
+	CSR *CSRConfig
 }
 
 // CoreEtcdConfig type is used to wire the core etcd information used by controller to create Deployments.
@@ -31,4 +62,80 @@ type CoreEtcdConfig struct {
 	// CertSecretName is the name of the Secret in the controller namespace where Client certificate and key for
 	// the core etcd are stored.
 	CertSecretName string
+
+	// AuthSecretName is the name of the Secret in the controller namespace where the user name and password of
+	// the core etcd user allowed to manage users and roles are stored. If set, the controller provisions a core etcd
+	// user and role restricted to the EtcdStorage prefix for each EtcdStorage. If empty, the core etcd
+	// authentication is not used.
+	AuthSecretName string
+
+	// SignerSecretName is the name of the TLS Secret in the controller namespace where the core etcd CA certificate
+	// and key are stored. If set, the controller issues a core etcd client certificate for each EtcdStorage, whose
+	// common name is the core etcd user restricted to the EtcdStorage prefix, and mounts it in etcd-proxy pods
+	// instead of the shared client certificate from CertSecretName.
+	SignerSecretName string
+}
+
+// CertificateValidityDefaultsConfig type is used to configure default certificate validities.
+type CertificateValidityDefaultsConfig struct {
+	// Signing is the default validity of signing certificates.
+	Signing time.Duration
+
+	// Serving is the default validity of serving certificates.
+	Serving time.Duration
+
+	// Client is the default validity of client certificates.
+	Client time.Duration
+}
+
+// LeaderElectionConfig type is used to configure leader election among multiple controller replicas.
+type LeaderElectionConfig struct {
+	// LeaderElect enables leader election. Only the leader runs the controller workers.
+	LeaderElect bool
+
+	// LockName is the name of the ConfigMap in the controller namespace used as the leader election lock.
+	LockName string
+
+	// LeaseDuration is the duration that non-leader candidates wait before forcing to acquire leadership.
+	LeaseDuration time.Duration
+
+	// RenewDeadline is the duration that the leader retries refreshing leadership before giving up.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is the duration candidates wait between tries of acquiring or renewing leadership.
+	RetryPeriod time.Duration
+}
+
+// WebhookConfig type is used to configure the EtcdStorage validating and conversion webhooks.
+type WebhookConfig struct {
+	// Address is the address on which the validating and conversion webhooks are served. If empty, the webhooks are not served.
+	Address string
+
+	// ServiceName is the name of the Service in the controller namespace exposing the webhooks.
+	ServiceName string
+
+	// ConfigurationName is the name of the ValidatingWebhookConfiguration registering the validating webhook.
+	ConfigurationName string
+
+	// CertSecretName is the name of the Secret in the controller namespace where the webhook CA and serving
+	// certificates are stored.
+	CertSecretName string
+
+	// CertificateValidity is how long the webhook CA and serving certificates are valid.
+	CertificateValidity time.Duration
+}
+
+// CSRConfig type is used to configure issuing etcd-proxy Server and Client certificates using the Kubernetes
+// certificates.k8s.io CertificateSigningRequests, instead of signing them using self-generated CA certificates.
+type CSRConfig struct {
+	// Enabled enables issuing certificates using CertificateSigningRequests.
+	Enabled bool
+
+	// SignerCAConfigMapName is the name of the ConfigMap in the controller namespace where the CA certificate of
+	// the cluster signer is stored under the ca.crt key. The CA certificate is distributed in the CA bundles.
+	SignerCAConfigMapName string
+
+	// AutoApprove enables approving CertificateSigningRequests created by the controller. If disabled,
+	// CertificateSigningRequests must be approved by the cluster administrator or another approver.
+	AutoApprove bool
 }
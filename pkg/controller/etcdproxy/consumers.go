@@ -0,0 +1,73 @@
+package etcdproxy
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const (
+	// ClientCertificateHashAnnotation contains the hash of the Client certificate/key pair used by the consumer workload.
+	// It is set on the consumer pod template, so changing it triggers a rolling update of the consumer.
+	ClientCertificateHashAnnotation = "etcd.xmudrii.com/client-certificate-hash"
+
+	// ConsumerRestarted is used as part of the Event reason when a workload using the Client certificate is restarted.
+	ConsumerRestarted = "ConsumerRestarted"
+)
+
+// restartConsumer updates the Client certificate hash annotation in the pod template of the workload using the
+// Client certificate stored in the provided Secret. If the hash has changed, the workload rolls out new pods,
+// which pick up the new Client certificate. The workload is not updated if the hash is unchanged.
+func (c *EtcdProxyController) restartConsumer(etcdstorage *etcdstoragev1beta1.EtcdStorage, secret *corev1.Secret,
+	consumer *etcdstoragev1beta1.ConsumerReference) error {
+	hash := certificatesHash(secret.Data["tls.crt"], secret.Data["tls.key"])
+
+	switch consumer.Kind {
+	case etcdstoragev1beta1.DeploymentConsumer:
+		deployment, err := c.kubeclientset.AppsV1().Deployments(consumer.Namespace).Get(consumer.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !setPodTemplateAnnotation(&deployment.Spec.Template, ClientCertificateHashAnnotation, hash) {
+			return nil
+		}
+		if _, err := c.kubeclientset.AppsV1().Deployments(consumer.Namespace).Update(deployment); err != nil {
+			return err
+		}
+	case etcdstoragev1beta1.StatefulSetConsumer:
+		statefulSet, err := c.kubeclientset.AppsV1().StatefulSets(consumer.Namespace).Get(consumer.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !setPodTemplateAnnotation(&statefulSet.Spec.Template, ClientCertificateHashAnnotation, hash) {
+			return nil
+		}
+		if _, err := c.kubeclientset.AppsV1().StatefulSets(consumer.Namespace).Update(statefulSet); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported consumer kind '%s' for secret '%s/%s'", consumer.Kind, secret.Namespace, secret.Name)
+	}
+
+	c.recorder.Event(etcdstorage, corev1.EventTypeNormal, ConsumerRestarted,
+		fmt.Sprintf("Rolling out %s %s/%s to pick up new client certificate from Secret %s/%s",
+			consumer.Kind, consumer.Namespace, consumer.Name, secret.Namespace, secret.Name))
+
+	return nil
+}
+
+// setPodTemplateAnnotation sets the annotation on the pod template and returns true if the value has changed.
+func setPodTemplateAnnotation(template *corev1.PodTemplateSpec, key, value string) bool {
+	if template.Annotations[key] == value {
+		return false
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[key] = value
+
+	return true
+}
@@ -0,0 +1,199 @@
+package etcdproxy
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestRestartConsumer(t *testing.T) {
+	etcdStorage := func(name string, consumer *v1beta1.ConsumerReference) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1beta1.EtcdStorageSpec{
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+					{
+						Name:      "etcd-client-cert",
+						Namespace: "k8s-sample-apiserver",
+						Consumer:  consumer,
+					},
+				},
+				SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+			},
+		}
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-client-cert",
+			Namespace: "k8s-sample-apiserver",
+		},
+		Type: v1.SecretTypeTLS,
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "apiserver",
+			Namespace: "k8s-sample-apiserver",
+		},
+	}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "apiserver",
+			Namespace: "k8s-sample-apiserver",
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+
+	tests := []struct {
+		name                string
+		startingEtcdStorage *v1beta1.EtcdStorage
+		startingObjects     []runtime.Object
+		expectError         bool
+	}{
+		{
+			name: "restart deployment",
+			startingEtcdStorage: etcdStorage("test-1", &v1beta1.ConsumerReference{
+				Kind:      v1beta1.DeploymentConsumer,
+				Name:      "apiserver",
+				Namespace: "k8s-sample-apiserver",
+			}),
+			startingObjects: []runtime.Object{secret, deployment},
+		},
+		{
+			name: "restart statefulset",
+			startingEtcdStorage: etcdStorage("test-2", &v1beta1.ConsumerReference{
+				Kind:      v1beta1.StatefulSetConsumer,
+				Name:      "apiserver",
+				Namespace: "k8s-sample-apiserver",
+			}),
+			startingObjects: []runtime.Object{secret, statefulSet},
+		},
+		{
+			name: "unsupported consumer kind",
+			startingEtcdStorage: etcdStorage("test-3", &v1beta1.ConsumerReference{
+				Kind:      "ReplicaSet",
+				Name:      "apiserver",
+				Namespace: "k8s-sample-apiserver",
+			}),
+			startingObjects: []runtime.Object{secret},
+			expectError:     true,
+		},
+		{
+			name: "consumer not found",
+			startingEtcdStorage: etcdStorage("test-4", &v1beta1.ConsumerReference{
+				Kind:      v1beta1.DeploymentConsumer,
+				Name:      "apiserver",
+				Namespace: "k8s-sample-apiserver",
+			}),
+			startingObjects: []runtime.Object{secret},
+			expectError:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			testObjs := append([]runtime.Object{tc.startingEtcdStorage}, tc.startingObjects...)
+			c := newEtcdProxyControllerMock(etcdProxyConfig, testObjs)
+
+			err := c.ensureClientCertificates(tc.startingEtcdStorage)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			certSecret, err := c.kubeclientset.CoreV1().Secrets(secret.Namespace).Get(secret.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedHash := certificatesHash(certSecret.Data["tls.crt"], certSecret.Data["tls.key"])
+
+			var template v1.PodTemplateSpec
+			consumer := tc.startingEtcdStorage.Spec.ClientCertSecrets[0].Consumer
+			switch consumer.Kind {
+			case v1beta1.DeploymentConsumer:
+				d, err := c.kubeclientset.AppsV1().Deployments(consumer.Namespace).Get(consumer.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				template = d.Spec.Template
+			case v1beta1.StatefulSetConsumer:
+				s, err := c.kubeclientset.AppsV1().StatefulSets(consumer.Namespace).Get(consumer.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				template = s.Spec.Template
+			}
+
+			if hash := template.Annotations[ClientCertificateHashAnnotation]; hash != expectedHash {
+				t.Fatalf("expected client certificate hash '%s' in the pod template, but got '%s'", expectedHash, hash)
+			}
+		})
+	}
+}
+
+func TestRestartConsumerRetried(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("consumer-test-1")
+	etcdStorage.Spec.ClientCertSecrets[0].Consumer = &v1beta1.ConsumerReference{
+		Kind:      v1beta1.DeploymentConsumer,
+		Name:      "apiserver",
+		Namespace: "k8s-sample-apiserver",
+	}
+	c := newEtcdProxyControllerMock(newTestSignerConfig(), []runtime.Object{etcdStorage})
+	c.currentTime = newFakeClock().currentTime
+
+	// The Client certificate is issued, but restarting the consumer fails, as it doesn't exist yet.
+	if err := c.ensureClientCertificates(etcdStorage); err == nil {
+		t.Fatal("expected error restarting the missing consumer")
+	}
+	clientCert := getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert")
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "apiserver",
+			Namespace: "k8s-sample-apiserver",
+		},
+	}
+	if _, err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Create(deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	// The consumer is restarted in the next sync, even though the Client certificate is not reissued.
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	if !getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert").Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected client certificate not to be reissued")
+	}
+	certSecret, err := c.kubeclientset.CoreV1().Secrets("k8s-sample-apiserver").Get("etcd-client-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Get(deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedHash := certificatesHash(certSecret.Data["tls.crt"], certSecret.Data["tls.key"])
+	if hash := d.Spec.Template.Annotations[ClientCertificateHashAnnotation]; hash != expectedHash {
+		t.Fatalf("expected client certificate hash '%s' in the pod template, but got '%s'", expectedHash, hash)
+	}
+}
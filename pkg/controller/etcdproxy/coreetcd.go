@@ -0,0 +1,67 @@
+package etcdproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// coreEtcdDialTimeout is the timeout for establishing connection to the core etcd.
+	coreEtcdDialTimeout = 10 * time.Second
+
+	// coreEtcdRequestTimeout is the timeout for a single request to the core etcd.
+	coreEtcdRequestTimeout = 30 * time.Second
+)
+
+// newCoreEtcdClient creates an etcd v3 client for the core etcd. The client uses the same CA certificate and
+// client certificate and key as etcd-proxy pods, read from the ConfigMap and the Secret in the controller namespace.
+// If the core etcd authentication is enabled, the client authenticates using the credentials from the auth Secret.
+func (c *EtcdProxyController) newCoreEtcdClient() (*clientv3.Client, error) {
+	tlsConfig, err := c.coreEtcdTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	username, password, err := c.coreEtcdRootCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	return clientv3.New(clientv3.Config{
+		Endpoints:   c.config.CoreEtcd.URLs,
+		DialTimeout: coreEtcdDialTimeout,
+		TLS:         tlsConfig,
+		Username:    username,
+		Password:    password,
+	})
+}
+
+// coreEtcdTLSConfig builds the TLS configuration for connecting to the core etcd.
+func (c *EtcdProxyController) coreEtcdTLSConfig() (*tls.Config, error) {
+	caConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(c.config.CoreEtcd.CAConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	certSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(c.config.CoreEtcd.CertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(caConfigMap.Data["ca.crt"])) {
+		return nil, fmt.Errorf("no core etcd ca certificates found in configmap %s", caConfigMap.Name)
+	}
+	cert, err := tls.X509KeyPair(certSecret.Data["tls.crt"], certSecret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("unable to load core etcd client certificate from secret %s: %v", certSecret.Name, err)
+	}
+
+	return &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
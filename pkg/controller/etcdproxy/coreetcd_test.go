@@ -0,0 +1,195 @@
+package etcdproxy
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// embeddedEtcd is an etcd server running in the test process, used as the core etcd.
+type embeddedEtcd struct {
+	etcd *embed.Etcd
+	dir  string
+
+	// URL is the client URL of the embedded etcd server.
+	URL string
+	// Objects contains the CA ConfigMap and the client certificate Secret for the embedded etcd server.
+	Objects []runtime.Object
+	// CA is the CA certificate and key trusted by the embedded etcd server.
+	CA *certs.Certificate
+}
+
+// startEmbeddedEtcd starts an etcd server serving TLS on the loopback interface. The CA ConfigMap and
+// the client certificate Secret are created as defined by the provided CoreEtcdConfig.
+func startEmbeddedEtcd(t *testing.T, config *EtcdProxyControllerConfig) *embeddedEtcd {
+	return startEmbeddedEtcdServer(t, config, true)
+}
+
+// startEmbeddedEtcdServer starts an etcd server as startEmbeddedEtcd does. If clientCertAuth is false, the server
+// doesn't verify client certificates, so clients are authenticated by the user name and password if auth is enabled.
+func startEmbeddedEtcdServer(t *testing.T, config *EtcdProxyControllerConfig, clientCertAuth bool) *embeddedEtcd {
+	dir, err := ioutil.TempDir("", "etcdproxy-controller-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validity := metav1.Duration{Duration: time.Hour}
+	ca, err := certs.NewCACertificate(pkix.Name{CommonName: "test-core-etcd-ca"}, validity, "", time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.NewServerCertificate(pkix.Name{CommonName: "test-core-etcd"}, []string{"127.0.0.1"}, validity, "", time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.NewClientCertificate(pkix.Name{CommonName: "test-core-etcd-client"}, validity, "", time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, _, err := ca.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey, err := server.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey, err := client.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"ca.crt": caCert, "server.crt": serverCert, "server.key": serverKey} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = filepath.Join(dir, "data")
+	clientURL := url.URL{Scheme: "https", Host: freeLocalAddress(t)}
+	peerURL := url.URL{Scheme: "http", Host: freeLocalAddress(t)}
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.ClientTLSInfo.CertFile = filepath.Join(dir, "server.crt")
+	cfg.ClientTLSInfo.KeyFile = filepath.Join(dir, "server.key")
+	cfg.ClientTLSInfo.TrustedCAFile = filepath.Join(dir, "ca.crt")
+	cfg.ClientTLSInfo.ClientCertAuth = clientCertAuth
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal("embedded etcd server is not ready")
+	}
+
+	return &embeddedEtcd{
+		etcd: e,
+		dir:  dir,
+		URL:  clientURL.String(),
+		CA:   ca,
+		Objects: []runtime.Object{
+			&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      config.CoreEtcd.CAConfigMapName,
+					Namespace: config.ControllerNamespace,
+				},
+				Data: map[string]string{
+					"ca.crt": string(caCert),
+				},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      config.CoreEtcd.CertSecretName,
+					Namespace: config.ControllerNamespace,
+				},
+				Type: v1.SecretTypeTLS,
+				Data: map[string][]byte{
+					"tls.crt": clientCert,
+					"tls.key": clientKey,
+				},
+			},
+		},
+	}
+}
+
+// Stop stops the embedded etcd server and removes its data.
+func (e *embeddedEtcd) Stop() {
+	e.etcd.Close()
+	os.RemoveAll(e.dir)
+}
+
+// freeLocalAddress returns a loopback address with a port that is not in use.
+func freeLocalAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return fmt.Sprintf("127.0.0.1:%d", l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestNewCoreEtcdClient(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, coreEtcd.Objects)
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	if _, err := client.Put(ctx, "/test/foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewCoreEtcdClientMissingCertificates(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{})
+	if _, err := c.newCoreEtcdClient(); err == nil {
+		t.Fatal("expected error when core etcd certificates are missing")
+	}
+}
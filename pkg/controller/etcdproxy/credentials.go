@@ -0,0 +1,296 @@
+package etcdproxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// EtcdCredentialsFailure is used as part of the Event reason when the core etcd user and role are not
+	// provisioned successfully.
+	EtcdCredentialsFailure = "EtcdCredentialsFailure"
+
+	// EtcdCredentialsUsernameKey is the key in the credentials Secret where the core etcd user name is stored.
+	EtcdCredentialsUsernameKey = "username"
+
+	// EtcdCredentialsPasswordKey is the key in the credentials Secret where the core etcd user password is stored.
+	EtcdCredentialsPasswordKey = "password"
+
+	// etcdCredentialsPasswordLength is the number of random bytes used to generate core etcd user passwords.
+	etcdCredentialsPasswordLength = 32
+)
+
+// ensureEtcdCredentials provisions the core etcd user and role used by etcd-proxy pods of the EtcdStorage, if
+// the core etcd authentication is enabled. The role grants read and write access only to keys under the
+// EtcdStorage prefix, so tenants are isolated by the core etcd itself, and not only by the etcd-proxy namespace.
+//
+// The user name and password are stored in the Secret named etcdstorageName-etcd-credentials in the controller
+// namespace. The password is generated once and reused, while the user and role are recreated if they are removed
+// from the core etcd. The password of an existing user is set when the Secret is created, and afterwards only if
+// the user can't authenticate using the password from the Secret, so auth tokens held by etcd-proxy pods stay valid.
+func (c *EtcdProxyController) ensureEtcdCredentials(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if c.config.CoreEtcd.AuthSecretName == "" {
+		return nil
+	}
+
+	created := false
+	secret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdCredentialsSecretName(etcdstorage), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		var password string
+		created = true
+		password, err = generateEtcdPassword()
+		if err != nil {
+			return err
+		}
+		secret, err = c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      etcdCredentialsSecretName(etcdstorage),
+				Namespace: c.config.ControllerNamespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				EtcdCredentialsUsernameKey: []byte(etcdUserName(etcdstorage)),
+				EtcdCredentialsPasswordKey: []byte(password),
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	username := string(secret.Data[EtcdCredentialsUsernameKey])
+	password := string(secret.Data[EtcdCredentialsPasswordKey])
+	if username == "" || password == "" {
+		return fmt.Errorf("secret %s doesn't contain the core etcd user name and password", secret.Name)
+	}
+
+	return c.ensureEtcdUser(etcdstorage, username, password, created)
+}
+
+// ensureEtcdUser creates the core etcd role granting read and write access only to keys under the EtcdStorage prefix,
+// and the core etcd user with the provided name and password having the role. The password of an existing user is
+// changed only if resetPassword is set or if the user can't authenticate using the provided password, as changing
+// the password invalidates all auth tokens of the user. If the password is empty, a random password is set when
+// the user is created, and the password of an existing user is not changed, as users authenticating using client
+// certificates don't use it.
+func (c *EtcdProxyController) ensureEtcdUser(etcdstorage *etcdstoragev1beta1.EtcdStorage, username, password string, resetPassword bool) error {
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+
+	role := etcdRoleName(etcdstorage)
+	if _, err := client.RoleAdd(ctx, role); err != nil && err != rpctypes.ErrRoleAlreadyExist {
+		return err
+	}
+	prefix := etcdPrefix(etcdstorage)
+	if _, err := client.RoleGrantPermission(ctx, role, prefix, clientv3.GetPrefixRangeEnd(prefix),
+		clientv3.PermissionType(clientv3.PermReadWrite)); err != nil {
+		return err
+	}
+
+	changePassword := password != ""
+	if !changePassword {
+		password, err = generateEtcdPassword()
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := client.UserAdd(ctx, username, password); err == rpctypes.ErrUserAlreadyExist {
+		if changePassword {
+			if err := ensureEtcdPassword(ctx, client, username, password, resetPassword); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	_, err = client.UserGrantRole(ctx, username, role)
+
+	return err
+}
+
+// ensureEtcdPassword changes the password of the existing core etcd user to the provided password, if reset is set
+// or if the user fails to authenticate using the provided password. If the core etcd authentication is not enabled,
+// the password can't be verified, so it's not changed.
+func ensureEtcdPassword(ctx context.Context, client *clientv3.Client, username, password string, reset bool) error {
+	if !reset {
+		_, err := etcdserverpb.NewAuthClient(client.ActiveConnection()).Authenticate(ctx,
+			&etcdserverpb.AuthenticateRequest{Name: username, Password: password})
+		switch rpctypes.Error(err) {
+		case nil, rpctypes.ErrAuthNotEnabled:
+			return nil
+		case rpctypes.ErrAuthFailed:
+		default:
+			return err
+		}
+	}
+
+	_, err := client.UserChangePassword(ctx, username, password)
+	return err
+}
+
+// ensureEtcdClientCertificate issues the core etcd client certificate used by etcd-proxy pods of the EtcdStorage,
+// if the core etcd signer is provided to the controller. The certificate is signed by the core etcd CA, and its
+// common name is the name of the core etcd user having the role granting access only to the EtcdStorage prefix,
+// so the core etcd isolates tenants when the client certificate authentication is enabled.
+//
+// The certificate is stored in the Secret named etcdstorageName-etcd-client-cert in the controller namespace, which
+// is mounted in etcd-proxy pods instead of the shared core etcd client certificate Secret. Like other certificates
+// issued by the controller, the certificate is renewed once it reaches its renewal time or its validity changes,
+// and it's reissued once the core etcd signer changes.
+func (c *EtcdProxyController) ensureEtcdClientCertificate(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if c.config.CoreEtcd.SignerSecretName == "" {
+		return nil
+	}
+
+	if err := c.ensureEtcdUser(etcdstorage, etcdUserName(etcdstorage), "", false); err != nil {
+		return err
+	}
+
+	signerSecret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(c.config.CoreEtcd.SignerSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	signer, err := certs.ParseCertificateBytes(signerSecret.Data["tls.crt"], signerSecret.Data["tls.key"])
+	if err != nil {
+		return fmt.Errorf("unable to load core etcd signer from secret %s: %v", signerSecret.Name, err)
+	}
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(etcdClientCertSecretName(etcdstorage), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      etcdClientCertSecretName(etcdstorage),
+				Namespace: c.config.ControllerNamespace,
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	reason := "certificate not issued"
+	if clientCert, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], nil); err == nil {
+		reason = c.renewalReason(clientCert.Certificates[0], etcdstorage.Spec.ClientCertificateValidity.Duration, true)
+		if reason == "" && !signedBy(clientCert, signer) {
+			reason = "core etcd signer changed"
+		}
+	}
+	if reason == "" {
+		c.certificateExpiry.observe(etcdstorage, coreClientCertificate, secret)
+		return nil
+	}
+
+	clientCert, err := signer.NewClientCertificate(pkix.Name{CommonName: etcdUserName(etcdstorage)},
+		etcdstorage.Spec.ClientCertificateValidity, keyAlgorithm(etcdstorage), c.currentTime)
+	if err != nil {
+		return err
+	}
+	clientCertBytes, clientKeyBytes, err := clientCert.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+
+	secret.Annotations = map[string]string{
+		ProxyCertificateExpiryAnnotation: clientCert.Certificates[0].NotAfter.Format(time.RFC3339),
+		ProxyCertificateSignedBy:         clientCert.Certificates[0].Issuer.CommonName,
+	}
+	secret.Data = map[string][]byte{
+		"tls.crt": clientCertBytes,
+		"tls.key": clientKeyBytes,
+	}
+	if err := updateCertificateSecret(c.kubeclientset, secret); err != nil {
+		return err
+	}
+	c.recorder.Event(etcdstorage, corev1.EventTypeNormal, CertificateRenewed,
+		fmt.Sprintf("Issued core etcd client certificate for Secret %s/%s: %s", secret.Namespace, secret.Name, reason))
+	c.certificateExpiry.observe(etcdstorage, coreClientCertificate, secret)
+
+	return nil
+}
+
+// coreEtcdAuthEnabled checks does the controller provision core etcd users and roles for EtcdStorages.
+func (c *EtcdProxyController) coreEtcdAuthEnabled() bool {
+	return c.config.CoreEtcd.AuthSecretName != "" || c.config.CoreEtcd.SignerSecretName != ""
+}
+
+// removeEtcdCredentials removes the core etcd user and role of the EtcdStorage being deleted, along with
+// the credentials and client certificate Secrets in the controller namespace.
+func (c *EtcdProxyController) removeEtcdCredentials(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if !c.coreEtcdAuthEnabled() {
+		return nil
+	}
+
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+
+	if _, err := client.UserDelete(ctx, etcdUserName(etcdstorage)); err != nil && err != rpctypes.ErrUserNotFound {
+		return err
+	}
+	if _, err := client.RoleDelete(ctx, etcdRoleName(etcdstorage)); err != nil && err != rpctypes.ErrRoleNotFound {
+		return err
+	}
+
+	for _, secretName := range []string{etcdCredentialsSecretName(etcdstorage), etcdClientCertSecretName(etcdstorage)} {
+		err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Delete(secretName, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	c.certificateExpiry.forget(etcdstorage.Name)
+
+	return nil
+}
+
+// coreEtcdRootCredentials reads the user name and password used by the controller to authenticate to the core etcd
+// from the Secret in the controller namespace. Empty credentials are returned if the core etcd authentication is disabled.
+func (c *EtcdProxyController) coreEtcdRootCredentials() (string, string, error) {
+	if c.config.CoreEtcd.AuthSecretName == "" {
+		return "", "", nil
+	}
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(c.config.CoreEtcd.AuthSecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	username := string(secret.Data[EtcdCredentialsUsernameKey])
+	password := string(secret.Data[EtcdCredentialsPasswordKey])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("secret %s doesn't contain the core etcd user name and password", secret.Name)
+	}
+
+	return username, password, nil
+}
+
+// generateEtcdPassword generates a random password for a core etcd user.
+func generateEtcdPassword() (string, error) {
+	b := make([]byte, etcdCredentialsPasswordLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,459 @@
+package etcdproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// enableEtcdAuth creates the root user with the provided password and enables authentication on the core etcd.
+func enableEtcdAuth(t *testing.T, c *EtcdProxyController, password string) {
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	if _, err := client.UserAdd(ctx, "root", password); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UserGrantRole(ctx, "root", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AuthEnable(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTenantEtcdClient creates a core etcd client authenticating using the provided credentials.
+func newTenantEtcdClient(c *EtcdProxyController, username, password string) (*clientv3.Client, error) {
+	tlsConfig, err := c.coreEtcdTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   c.config.CoreEtcd.URLs,
+		DialTimeout: coreEtcdDialTimeout,
+		TLS:         tlsConfig,
+		Username:    username,
+		Password:    password,
+	})
+}
+
+func TestEnsureEtcdCredentials(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcdServer(t, etcdProxyConfig, false)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	authSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-core-auth",
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Data: map[string][]byte{
+			EtcdCredentialsUsernameKey: []byte("root"),
+			EtcdCredentialsPasswordKey: []byte("root-password"),
+		},
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es, authSecret}, coreEtcd.Objects...))
+	enableEtcdAuth(t, c, "root-password")
+	etcdProxyConfig.CoreEtcd.AuthSecretName = authSecret.Name
+
+	// Credentials are provisioned once and reused on subsequent syncs.
+	var password []byte
+	for i := 0; i < 2; i++ {
+		if err := c.ensureEtcdCredentials(es); err != nil {
+			t.Fatal(err)
+		}
+		secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdCredentialsSecretName(es), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(secret.Data[EtcdCredentialsUsernameKey]) != "etcdproxy-test-1" {
+			t.Fatalf("expected user name 'etcdproxy-test-1', but got '%s'", secret.Data[EtcdCredentialsUsernameKey])
+		}
+		if password != nil && string(password) != string(secret.Data[EtcdCredentialsPasswordKey]) {
+			t.Fatal("expected the password to be reused")
+		}
+		password = secret.Data[EtcdCredentialsPasswordKey]
+	}
+
+	client, err := newTenantEtcdClient(c, "etcdproxy-test-1", string(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	if _, err := client.Put(ctx, "/test-1/foo", "bar"); err != nil {
+		t.Fatalf("expected access to the etcdstorage prefix: %v", err)
+	}
+	if _, err := client.Put(ctx, "/test-2/foo", "bar"); err == nil {
+		t.Fatal("expected no access outside of the etcdstorage prefix")
+	}
+
+	if err := c.removeEtcdCredentials(es); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdCredentialsSecretName(es), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the credentials secret to be deleted, but got: %v", err)
+	}
+	if removedClient, err := newTenantEtcdClient(c, "etcdproxy-test-1", string(password)); err == nil {
+		removedClient.Close()
+		t.Fatal("expected the core etcd user to be removed")
+	}
+}
+
+func TestEnsureEtcdCredentialsKeepsTokens(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcdServer(t, etcdProxyConfig, false)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	es := &v1beta1.EtcdStorage{ObjectMeta: metav1.ObjectMeta{Name: "test-1"}}
+	authSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-core-auth",
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Data: map[string][]byte{
+			EtcdCredentialsUsernameKey: []byte("root"),
+			EtcdCredentialsPasswordKey: []byte("root-password"),
+		},
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es, authSecret}, coreEtcd.Objects...))
+	enableEtcdAuth(t, c, "root-password")
+	etcdProxyConfig.CoreEtcd.AuthSecretName = authSecret.Name
+
+	if err := c.ensureEtcdCredentials(es); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdCredentialsSecretName(es), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	username, password := string(secret.Data[EtcdCredentialsUsernameKey]), string(secret.Data[EtcdCredentialsPasswordKey])
+
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// The token is used directly, as etcd clients transparently request a new token once it's invalidated,
+	// so the tenant client doesn't authenticate by itself.
+	tenantClient, err := newTenantEtcdClient(c, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tenantClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+
+	authenticate := func() string {
+		resp, err := etcdserverpb.NewAuthClient(tenantClient.ActiveConnection()).Authenticate(ctx,
+			&etcdserverpb.AuthenticateRequest{Name: username, Password: password})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Token
+	}
+	put := func(token string) error {
+		_, err := etcdserverpb.NewKVClient(tenantClient.ActiveConnection()).Put(metadata.NewOutgoingContext(ctx, metadata.Pairs("token", token)),
+			&etcdserverpb.PutRequest{Key: []byte("/test-1/foo"), Value: []byte("bar")})
+		return err
+	}
+
+	token := authenticate()
+	if err := put(token); err != nil {
+		t.Fatalf("expected access to the etcdstorage prefix: %v", err)
+	}
+	if err := c.ensureEtcdCredentials(es); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(token); err != nil {
+		t.Fatalf("expected the token to stay valid after the credentials are ensured again: %v", err)
+	}
+
+	// The password is restored if it's changed in the core etcd.
+	if _, err := client.UserChangePassword(ctx, username, "changed-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ensureEtcdCredentials(es); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(authenticate()); err != nil {
+		t.Fatalf("expected the password to be restored: %v", err)
+	}
+}
+
+func TestApplyEtcdCredentials(t *testing.T) {
+	es := &v1beta1.EtcdStorage{ObjectMeta: metav1.ObjectMeta{Name: "test-1"}}
+	d := newDeployment(es, "test-storage", es.Name, "quay.io/coreos/etcd:v3.2.24", "etcd-coreserving-ca",
+		"etcd-coreserving-cert", []string{"https://test.etcd.svc:2379"}, "", nil)
+	applyEtcdCredentials(d, etcdCredentialsSecretName(es))
+
+	container := d.Spec.Template.Spec.Containers[0]
+	if len(container.Env) != 2 || container.Env[0].ValueFrom.SecretKeyRef.Name != "test-1-etcd-credentials" {
+		t.Fatalf("expected credentials environment variables, but got %+v", container.Env)
+	}
+	if !hasVolume(d.Spec.Template.Spec.Volumes, "test-1-etcd-credentials") {
+		t.Fatal("expected credentials volume")
+	}
+	mounted := false
+	for _, mount := range container.VolumeMounts {
+		if mount.Name == "test-1-etcd-credentials" && mount.MountPath == "/etc/coreetcd-credentials" {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Fatal("expected credentials to be mounted in the etcd-proxy container")
+	}
+}
+
+func TestEnsureEtcdClientCertificate(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName:  "etcd-coreserving-ca",
+			CertSecretName:   "etcd-coreserving-cert",
+			SignerSecretName: "etcd-coreserving-signer",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	caCert, caKey, err := coreEtcd.CA.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdProxyConfig.CoreEtcd.SignerSecretName,
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": caCert,
+			"tls.key": caKey,
+		},
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es, signerSecret}, coreEtcd.Objects...))
+
+	// The controller authenticates using the common name of the shared client certificate,
+	// so the user with that name must have the root role once the authentication is enabled.
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	if _, err := client.UserAdd(ctx, "test-core-etcd-client", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UserGrantRole(ctx, "test-core-etcd-client", "root"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	enableEtcdAuth(t, c, "root-password")
+
+	// The certificate is issued once and reused on subsequent syncs.
+	var tenantCert []byte
+	for i := 0; i < 2; i++ {
+		if err := c.ensureEtcdClientCertificate(es); err != nil {
+			t.Fatal(err)
+		}
+		secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdClientCertSecretName(es), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tenantCert != nil && string(tenantCert) != string(secret.Data["tls.crt"]) {
+			t.Fatal("expected the client certificate to be reused")
+		}
+		tenantCert = secret.Data["tls.crt"]
+	}
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdClientCertSecretName(es), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := cert.Certificates[0].Subject.CommonName; cn != "etcdproxy-test-1" {
+		t.Fatalf("expected common name 'etcdproxy-test-1', but got '%s'", cn)
+	}
+
+	tlsConfig, err := c.coreEtcdTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPair, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{keyPair}
+	tenantClient, err := clientv3.New(clientv3.Config{
+		Endpoints:   etcdProxyConfig.CoreEtcd.URLs,
+		DialTimeout: coreEtcdDialTimeout,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tenantClient.Close()
+
+	if _, err := tenantClient.Put(ctx, "/test-1/foo", "bar"); err != nil {
+		t.Fatalf("expected access to the etcdstorage prefix: %v", err)
+	}
+	if _, err := tenantClient.Put(ctx, "/test-2/foo", "bar"); err == nil {
+		t.Fatal("expected no access outside of the etcdstorage prefix")
+	}
+
+	if err := c.removeEtcdCredentials(es); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdClientCertSecretName(es), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the client certificate secret to be deleted, but got: %v", err)
+	}
+	if _, err := tenantClient.Put(ctx, "/test-1/foo", "bar"); err == nil {
+		t.Fatal("expected the core etcd user to be removed")
+	}
+}
+
+func TestEnsureEtcdClientCertificateRenewal(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName:  "etcd-coreserving-ca",
+			CertSecretName:   "etcd-coreserving-cert",
+			SignerSecretName: "etcd-coreserving-signer",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	signerSecret := func(signer *certs.Certificate) *v1.Secret {
+		caCert, caKey, err := signer.GetPEMBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      etcdProxyConfig.CoreEtcd.SignerSecretName,
+				Namespace: etcdProxyConfig.ControllerNamespace,
+			},
+			Type: v1.SecretTypeTLS,
+			Data: map[string][]byte{
+				"tls.crt": caCert,
+				"tls.key": caKey,
+			},
+		}
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es, signerSecret(coreEtcd.CA)}, coreEtcd.Objects...))
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	sync := func() *certs.Certificate {
+		if err := c.ensureEtcdClientCertificate(es); err != nil {
+			t.Fatal(err)
+		}
+		return getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdClientCertSecretName(es))
+	}
+
+	// The certificate is issued using the controller clock.
+	issued := sync()
+	if !issued.Certificates[0].NotBefore.Before(clock.currentTime()) || issued.Certificates[0].NotAfter.After(clock.currentTime().Add(es.Spec.ClientCertificateValidity.Duration)) {
+		t.Fatalf("expected certificate issued at %s, but it's valid from %s to %s",
+			clock.currentTime(), issued.Certificates[0].NotBefore, issued.Certificates[0].NotAfter)
+	}
+
+	// The certificate is reused until it reaches its renewal time.
+	clock.step(time.Hour * 24 * 29)
+	if cert := sync(); !cert.Certificates[0].Equal(issued.Certificates[0]) {
+		t.Fatal("expected the client certificate to be reused before its renewal time")
+	}
+	clock.step(time.Hour * 24 * 2)
+	renewed := sync()
+	if renewed.Certificates[0].Equal(issued.Certificates[0]) {
+		t.Fatal("expected the client certificate to be renewed after its renewal time")
+	}
+
+	// The certificate is reissued when its validity changes.
+	es.Spec.ClientCertificateValidity = metav1.Duration{time.Hour * 24 * 30}
+	reissued := sync()
+	if reissued.Certificates[0].Equal(renewed.Certificates[0]) {
+		t.Fatal("expected the client certificate to be reissued after its validity changed")
+	}
+
+	// The certificate is reissued when the core etcd signer changes.
+	newSigner, err := certs.NewCACertificate(pkix.Name{CommonName: "test-core-etcd-ca-2"}, metav1.Duration{time.Hour * 24 * 365}, "", clock.currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Update(signerSecret(newSigner)); err != nil {
+		t.Fatal(err)
+	}
+	if cert := sync(); !signedBy(cert, newSigner) {
+		t.Fatal("expected the client certificate to be reissued by the new core etcd signer")
+	}
+}
@@ -0,0 +1,233 @@
+package etcdproxy
+
+import (
+	"crypto/x509/pkix"
+	"fmt"
+	"time"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// CSRAutoApprovedReason is used as the reason of the Approved condition set by the controller on
+	// CertificateSigningRequests it has created.
+	CSRAutoApprovedReason = "EtcdProxyControllerAutoApproved"
+
+	// CSRPending is used as part of the Event reason when a CertificateSigningRequest is created and
+	// the controller is waiting for it to be approved and signed.
+	CSRPending = "CertificateSigningRequestPending"
+
+	// CSRNameAnnotation is the annotation on the pending CertificateSigningRequest Secret with the name of
+	// the CertificateSigningRequest waiting to be approved and signed.
+	CSRNameAnnotation = "etcd.xmudrii.com/certificate-signing-request"
+
+	// PendingCSRLabel is the label set to the EtcdStorage name on pending CertificateSigningRequests and
+	// the Secrets holding their private keys.
+	PendingCSRLabel = "etcd.xmudrii.com/pending-csr"
+)
+
+// useCSR checks are certificates of the EtcdStorage issued using CertificateSigningRequests. The EtcdStorage Issuer,
+// if set, takes precedence over the CSR API.
+func (c *EtcdProxyController) useCSR(etcdstorage *etcdstoragev1beta1.EtcdStorage) bool {
+	return c.config.CSR != nil && c.config.CSR.Enabled && etcdstorage.Spec.Issuer == nil
+}
+
+// csrSignerCA loads the CA certificate of the cluster signer from the ConfigMap in the controller namespace.
+// The CA certificate is distributed in the CA bundles in place of the self-generated signing certificates.
+func (c *EtcdProxyController) csrSignerCA() (*certs.Certificate, error) {
+	configMap, err := c.kubeclientset.CoreV1().ConfigMaps(c.config.ControllerNamespace).Get(c.config.CSR.SignerCAConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ca, err := certs.ParseCertificateBytes([]byte(configMap.Data["ca.crt"]), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load csr signer ca from configmap %s: %v", configMap.Name, err)
+	}
+	return ca, nil
+}
+
+// requestCertificate issues the certificate for the provided subject and hosts using the CertificateSigningRequest
+// named after the EtcdStorage and the certificate kind. The CertificateSigningRequest is approved by the controller
+// if auto-approving is enabled. The controller doesn't wait for the CertificateSigningRequest to be approved and
+// signed. Instead, the private key and the name of the pending CertificateSigningRequest are stored in a Secret in
+// the controller namespace, an error is returned so the EtcdStorage is requeued, and the issued certificate is
+// picked up on a later sync. The CertificateSigningRequest is deleted once the certificate is issued or
+// the CertificateSigningRequest is denied.
+//
+// The returned Certificate contains the issued certificate and the private key generated by the controller.
+// The validity of the certificate is decided by the cluster signer.
+func (c *EtcdProxyController) requestCertificate(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind string, subject pkix.Name,
+	hosts []string, usages []certificatesv1beta1.KeyUsage) (*certs.Certificate, error) {
+	secretClient := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace)
+	csrClient := c.kubeclientset.CertificatesV1beta1().CertificateSigningRequests()
+
+	pending, err := secretClient.Get(certificateSigningRequestSecretName(etcdstorage, kind), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, c.createCertificateSigningRequest(etcdstorage, kind, subject, hosts, usages)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	csrName := pending.Annotations[CSRNameAnnotation]
+	csr, err := csrClient.Get(csrName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// The CertificateSigningRequest has been removed before the certificate is issued, so a new one is created.
+		if err := c.deleteCertificateSigningRequest(pending); err != nil {
+			return nil, err
+		}
+		return nil, c.createCertificateSigningRequest(etcdstorage, kind, subject, hosts, usages)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificatesv1beta1.CertificateDenied {
+			if err := c.deleteCertificateSigningRequest(pending); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("certificate signing request %s is denied: %s", csr.Name, condition.Message)
+		}
+	}
+	if len(csr.Status.Certificate) == 0 {
+		return nil, fmt.Errorf("certificate signing request %s is not approved and signed yet", csr.Name)
+	}
+
+	cert, err := certs.ParseCertificateBytes(csr.Status.Certificate, pending.Data["tls.key"])
+	if err != nil {
+		// The issued certificate can't be used, so the CertificateSigningRequest is requested again.
+		if err := c.deleteCertificateSigningRequest(pending); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to parse certificate issued for certificate signing request %s: %v", csr.Name, err)
+	}
+	if err := c.deleteCertificateSigningRequest(pending); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// createCertificateSigningRequest generates the private key and creates the CertificateSigningRequest for
+// the provided subject and hosts. The private key and the name of the CertificateSigningRequest are stored in
+// the pending CertificateSigningRequest Secret. The returned error reports the CertificateSigningRequest is pending,
+// so the EtcdStorage is requeued.
+func (c *EtcdProxyController) createCertificateSigningRequest(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind string, subject pkix.Name,
+	hosts []string, usages []certificatesv1beta1.KeyUsage) error {
+	request, key, err := certs.NewCertificateRequest(subject, hosts, keyAlgorithm(etcdstorage))
+	if err != nil {
+		return err
+	}
+	_, keyBytes, err := (&certs.Certificate{Key: key}).GetPEMBytes()
+	if err != nil {
+		return err
+	}
+
+	csrName := certificateSigningRequestName(etcdstorage, kind, c.currentTime())
+	csrLabels := map[string]string{
+		PendingCSRLabel: etcdstorage.Name,
+	}
+	// The Secret is created first, so the CertificateSigningRequest is never left without the private key.
+	_, err = c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        certificateSigningRequestSecretName(etcdstorage, kind),
+			Namespace:   c.config.ControllerNamespace,
+			Labels:      csrLabels,
+			Annotations: map[string]string{CSRNameAnnotation: csrName},
+		},
+		Data: map[string][]byte{
+			"tls.key": keyBytes,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	csrClient := c.kubeclientset.CertificatesV1beta1().CertificateSigningRequests()
+	csr, err := csrClient.Create(&certificatesv1beta1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   csrName,
+			Labels: csrLabels,
+		},
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Request: request,
+			Usages:  usages,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.config.CSR.AutoApprove {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+			Type:           certificatesv1beta1.CertificateApproved,
+			Reason:         CSRAutoApprovedReason,
+			Message:        fmt.Sprintf("Auto-approved etcd-proxy %s certificate for EtcdStorage %s", kind, etcdstorage.Name),
+			LastUpdateTime: metav1.NewTime(c.currentTime()),
+		})
+		if _, err := csrClient.UpdateApproval(csr); err != nil {
+			return err
+		}
+	}
+
+	c.recorder.Event(etcdstorage, corev1.EventTypeNormal, CSRPending,
+		fmt.Sprintf("Created certificate signing request %s for etcd-proxy %s certificate", csrName, kind))
+	return fmt.Errorf("certificate signing request %s is not approved and signed yet", csrName)
+}
+
+// deleteCertificateSigningRequest deletes the CertificateSigningRequest recorded in the provided pending
+// CertificateSigningRequest Secret, and the Secret itself.
+func (c *EtcdProxyController) deleteCertificateSigningRequest(pending *corev1.Secret) error {
+	if csrName := pending.Annotations[CSRNameAnnotation]; csrName != "" {
+		err := c.kubeclientset.CertificatesV1beta1().CertificateSigningRequests().Delete(csrName, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err := c.kubeclientset.CoreV1().Secrets(pending.Namespace).Delete(pending.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// cleanupCertificateSigningRequests deletes pending CertificateSigningRequests of the EtcdStorage being deleted,
+// along with the Secrets holding their private keys.
+func (c *EtcdProxyController) cleanupCertificateSigningRequests(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	secrets, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).List(metav1.ListOptions{
+		LabelSelector: labels.Set{PendingCSRLabel: etcdstorage.Name}.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range secrets.Items {
+		if err := c.deleteCertificateSigningRequest(&secrets.Items[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// certificateSigningRequestSecretName calculates name to be used to create a Secret with the private key of
+// the pending CertificateSigningRequest for the etcd-proxy certificate of the provided kind.
+func certificateSigningRequestSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind string) string {
+	return fmt.Sprintf("%s-csr-%s", etcdstorage.Name, kind)
+}
+
+// certificateSigningRequestName calculates name to be used to create a CertificateSigningRequest for the
+// etcd-proxy certificate of the provided kind.
+func certificateSigningRequestName(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind string, now time.Time) string {
+	return fmt.Sprintf("etcdproxy-%s-%s-%d", etcdstorage.Name, kind, now.Unix())
+}
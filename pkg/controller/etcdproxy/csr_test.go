@@ -0,0 +1,305 @@
+package etcdproxy
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// runFakeCSRSigner signs approved CertificateSigningRequests using the provided CA, as the cluster signer does.
+// If deny is true, pending CertificateSigningRequests are denied instead.
+func runFakeCSRSigner(t *testing.T, c *EtcdProxyController, ca *certs.Certificate, deny bool, stopCh <-chan struct{}) {
+	csrClient := c.kubeclientset.CertificatesV1beta1().CertificateSigningRequests()
+	go wait.Until(func() {
+		csrs, err := csrClient.List(metav1.ListOptions{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, csr := range csrs.Items {
+			if len(csr.Status.Certificate) != 0 || len(csr.Status.Conditions) == 0 && !deny {
+				continue
+			}
+			if deny {
+				csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+					Type:    certificatesv1beta1.CertificateDenied,
+					Message: "denied by test",
+				})
+				if _, err := csrClient.UpdateApproval(&csr); err != nil {
+					t.Error(err)
+				}
+				continue
+			}
+
+			block, _ := pem.Decode(csr.Spec.Request)
+			request, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			der, err := x509.CreateCertificate(cryptorand.Reader, &x509.Certificate{
+				Subject:      request.Subject,
+				DNSNames:     request.DNSNames,
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				NotBefore:    time.Now().Add(-1 * time.Second),
+				NotAfter:     time.Now().Add(time.Hour * 24 * 365),
+				KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			}, ca.Certificates[0], request.PublicKey, ca.Key)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			csr.Status.Certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+			if _, err := csrClient.UpdateStatus(&csr); err != nil {
+				t.Error(err)
+			}
+		}
+	}, 100*time.Millisecond, stopCh)
+}
+
+func TestCSRCertificates(t *testing.T) {
+	etcdStorage := func() *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{Name: "csr-test-1"},
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
+					{
+						Name:      "etcd-serving-ca",
+						Namespace: "k8s-sample-apiserver",
+					},
+				},
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+					{
+						Name:      "etcd-client-cert",
+						Namespace: "k8s-sample-apiserver",
+					},
+				},
+				SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		autoApprove bool
+		approve     bool
+		deny        bool
+		expectedErr string
+	}{
+		{
+			name:        "auto-approved certificate signing requests",
+			autoApprove: true,
+		},
+		{
+			name:    "certificate signing requests approved after the first sync",
+			approve: true,
+		},
+		{
+			name:        "denied certificate signing requests",
+			deny:        true,
+			expectedErr: "is denied",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signerCA, err := certs.NewCACertificate(pkix.Name{CommonName: "cluster-signer"}, metav1.Duration{Duration: time.Hour * 24 * 365}, "", time.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signerCABytes, _, err := signerCA.GetPEMBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			etcdProxyConfig := &EtcdProxyControllerConfig{
+				CoreEtcd: &CoreEtcdConfig{
+					URLs:            []string{"https://test.etcd.svc:2379"},
+					CAConfigMapName: "etcd-coreserving-ca",
+					CertSecretName:  "etcd-coreserving-cert",
+				},
+				ControllerNamespace: "test-storage",
+				ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+				CSR: &CSRConfig{
+					Enabled:               true,
+					SignerCAConfigMapName: "etcdproxy-csr-signer-ca",
+					AutoApprove:           tc.autoApprove,
+				},
+			}
+			signerCAConfigMap := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "etcdproxy-csr-signer-ca",
+					Namespace: etcdProxyConfig.ControllerNamespace,
+				},
+				Data: map[string]string{
+					"ca.crt": string(signerCABytes),
+				},
+			}
+			es := etcdStorage()
+			c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{es, signerCAConfigMap})
+			csrClient := c.kubeclientset.CertificatesV1beta1().CertificateSigningRequests()
+
+			// The first sync creates certificate signing requests and returns without waiting for them.
+			for _, err := range []error{c.ensureServerCertificates(es), c.ensureClientCertificates(es)} {
+				if err == nil || !strings.Contains(err.Error(), "is not approved and signed yet") {
+					t.Fatalf("expected pending certificate signing request error, but got '%v'", err)
+				}
+			}
+			csrs, err := csrClient.List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(csrs.Items) != 2 {
+				t.Fatalf("expected 2 pending certificate signing requests, but got %d", len(csrs.Items))
+			}
+
+			if tc.approve {
+				// Pending certificate signing requests are kept and reused by later syncs.
+				for _, err := range []error{c.ensureServerCertificates(es), c.ensureClientCertificates(es)} {
+					if err == nil || !strings.Contains(err.Error(), "is not approved and signed yet") {
+						t.Fatalf("expected pending certificate signing request error, but got '%v'", err)
+					}
+				}
+				pending, err := csrClient.List(metav1.ListOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(pending.Items, csrs.Items) {
+					t.Fatal("expected pending certificate signing requests to be kept")
+				}
+
+				for _, csr := range csrs.Items {
+					csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+						Type: certificatesv1beta1.CertificateApproved,
+					})
+					if _, err := csrClient.UpdateApproval(&csr); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			runFakeCSRSigner(t, c, signerCA, tc.deny, stopCh)
+
+			// Later syncs pick up the issued certificates, or report the certificate signing requests are denied.
+			results := map[string]error{}
+			err = wait.PollImmediate(100*time.Millisecond, 5*time.Second, func() (bool, error) {
+				for name, ensure := range map[string]func(*v1beta1.EtcdStorage) error{
+					"server": c.ensureServerCertificates,
+					"client": c.ensureClientCertificates,
+				} {
+					if _, ok := results[name]; ok {
+						continue
+					}
+					err := ensure(es)
+					if err == nil || !strings.Contains(err.Error(), "is not approved and signed yet") {
+						results[name] = err
+					}
+				}
+				return len(results) == 2, nil
+			})
+			if err != nil {
+				t.Fatalf("expected certificate signing requests to be processed: %v", err)
+			}
+
+			// Certificate signing requests are deleted once certificates are issued or denied.
+			csrs, err = csrClient.List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(csrs.Items) != 0 {
+				t.Fatalf("expected certificate signing requests to be deleted, but got %d", len(csrs.Items))
+			}
+			for _, kind := range []string{"server", "client-k8s-sample-apiserver-etcd-client-cert"} {
+				_, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(certificateSigningRequestSecretName(es, kind), metav1.GetOptions{})
+				if !errors.IsNotFound(err) {
+					t.Fatalf("expected pending certificate signing request secret '%s' to be deleted, but got '%v'", kind, err)
+				}
+			}
+
+			if tc.expectedErr != "" {
+				for _, err := range results {
+					if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+						t.Fatalf("expected error containing '%s', but got '%v'", tc.expectedErr, err)
+					}
+				}
+				return
+			}
+			for _, err := range results {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(signerCA.Certificates[0])
+
+			serverSecret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdProxyServerCertsSecret(es), metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := serverSecret.Annotations[ProxyCertificateExpiryAnnotation]; !ok {
+				t.Fatal("expected expiry annotation on the server certificate secret")
+			}
+			serverCert, err := certs.ParseCertificateBytes(serverSecret.Data["tls.crt"], serverSecret.Data["tls.key"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := serverCert.Certificates[0].Verify(x509.VerifyOptions{Roots: roots, DNSName: "etcd-csr-test-1.test-storage.svc"}); err != nil {
+				t.Fatalf("expected server certificate signed by the cluster signer: %v", err)
+			}
+
+			clientSecret, err := c.kubeclientset.CoreV1().Secrets("k8s-sample-apiserver").Get("etcd-client-cert", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := clientSecret.Annotations[ProxyCertificateSignedBy]; !ok {
+				t.Fatal("expected signed-by annotation on the client certificate secret")
+			}
+			clientCert, err := certs.ParseCertificateBytes(clientSecret.Data["tls.crt"], clientSecret.Data["tls.key"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := clientCert.Certificates[0].Verify(x509.VerifyOptions{Roots: roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+				t.Fatalf("expected client certificate signed by the cluster signer: %v", err)
+			}
+
+			// The cluster signer CA is distributed in the CA bundles.
+			for _, cm := range []struct{ namespace, name, key string }{
+				{"k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt"},
+				{etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(es), "client-ca.crt"},
+			} {
+				configMap, err := c.kubeclientset.CoreV1().ConfigMaps(cm.namespace).Get(cm.name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				bundle, err := certs.ParseCertificateBytes([]byte(configMap.Data[cm.key]), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !containsCertificate(bundle.Certificates, signerCA.Certificates[0]) {
+					t.Fatalf("expected cluster signer CA in configmap '%s/%s'", cm.namespace, cm.name)
+				}
+			}
+		})
+	}
+}
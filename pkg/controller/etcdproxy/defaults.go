@@ -0,0 +1,26 @@
+package etcdproxy
+
+import (
+	"time"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// SetEtcdStorageDefaults sets defaults for fields not set in the EtcdStorage spec. Certificate validities are set
+// to the provided cluster-wide defaults, if set, and to the API defaults otherwise. It's used by the controller and
+// the validating webhook, so both see EtcdStorages the same way.
+func SetEtcdStorageDefaults(etcdstorage *etcdstoragev1beta1.EtcdStorage, defaults *CertificateValidityDefaultsConfig) {
+	if defaults != nil {
+		setDefaultDuration(&etcdstorage.Spec.SigningCertificateValidity.Duration, defaults.Signing)
+		setDefaultDuration(&etcdstorage.Spec.ServingCertificateValidity.Duration, defaults.Serving)
+		setDefaultDuration(&etcdstorage.Spec.ClientCertificateValidity.Duration, defaults.Client)
+	}
+	etcdstoragev1beta1.SetObjectDefaults_EtcdStorage(etcdstorage)
+}
+
+// setDefaultDuration sets the duration to the default value, if the duration is not set.
+func setDefaultDuration(duration *time.Duration, defaultDuration time.Duration) {
+	if *duration == 0 {
+		*duration = defaultDuration
+	}
+}
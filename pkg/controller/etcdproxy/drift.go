@@ -0,0 +1,292 @@
+package etcdproxy
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// EtcdProxyDriftReconciled is used as part of the Event reason when the etcd-proxy Deployment or Service is
+// updated because it doesn't match the desired state.
+const EtcdProxyDriftReconciled = "EtcdProxyDriftReconciled"
+
+// reconcileDeployment updates the existing etcd-proxy Deployment to match the required Deployment, and records
+// an Event describing which fields have drifted.
+func (c *EtcdProxyController) reconcileDeployment(etcdstorage *etcdstoragev1beta1.EtcdStorage,
+	existing, required *appsv1.Deployment) (*appsv1.Deployment, error) {
+	merged, drifted := mergeDeployment(existing, required)
+	if len(drifted) == 0 {
+		return existing, nil
+	}
+
+	updated, err := c.kubeclientset.AppsV1().Deployments(merged.Namespace).Update(merged)
+	if err != nil {
+		return existing, err
+	}
+	c.recorder.Event(etcdstorage, corev1.EventTypeNormal, EtcdProxyDriftReconciled,
+		fmt.Sprintf("Reconciled drifted etcd-proxy Deployment %s: %s", existing.Name, strings.Join(drifted, ", ")))
+
+	return updated, nil
+}
+
+// reconcileService updates the existing etcd-proxy Service to match the required Service, and records
+// an Event describing which fields have drifted.
+func (c *EtcdProxyController) reconcileService(etcdstorage *etcdstoragev1beta1.EtcdStorage,
+	existing, required *corev1.Service) (*corev1.Service, error) {
+	merged, drifted := mergeService(existing, required)
+	if len(drifted) == 0 {
+		return existing, nil
+	}
+
+	updated, err := c.kubeclientset.CoreV1().Services(merged.Namespace).Update(merged)
+	if err != nil {
+		return existing, err
+	}
+	c.recorder.Event(etcdstorage, corev1.EventTypeNormal, EtcdProxyDriftReconciled,
+		fmt.Sprintf("Reconciled drifted etcd-proxy Service %s: %s", existing.Name, strings.Join(drifted, ", ")))
+
+	return updated, nil
+}
+
+// mergeDeployment returns a copy of the existing Deployment with fields managed by the controller set as in
+// the required Deployment, along with names of fields that have drifted. Fields defaulted by the API server and
+// immutable fields are not compared. The certificates hash is managed by restartEtcdProxy and replicas are not
+// reconciled while the Deployment is scaled down because of the EtcdStorage quota.
+func mergeDeployment(existing, required *appsv1.Deployment) (*appsv1.Deployment, []string) {
+	merged := existing.DeepCopy()
+	var drifted []string
+
+	if _, scaledDown := existing.Annotations[QuotaScaledDownReplicasAnnotation]; !scaledDown &&
+		!equality.Semantic.DeepEqual(merged.Spec.Replicas, required.Spec.Replicas) {
+		merged.Spec.Replicas = required.Spec.Replicas
+		drifted = append(drifted, "replicas")
+	}
+
+	// Fields taken from the default pod template are not compared one by one, so the whole pod template is
+	// replaced when the default pod template changes.
+	if existing.Spec.Template.Annotations[ProxyPodTemplateHashAnnotation] != required.Spec.Template.Annotations[ProxyPodTemplateHashAnnotation] {
+		merged.Spec.Template = *required.Spec.Template.DeepCopy()
+		drifted = append(drifted, "default pod template")
+		return merged, drifted
+	}
+
+	modified := false
+	mergeStringMap(&modified, &merged.Spec.Template.Labels, required.Spec.Template.Labels)
+	if modified {
+		drifted = append(drifted, "pod labels")
+	}
+	modified = false
+	requiredAnnotations := map[string]string{}
+	for k, v := range required.Spec.Template.Annotations {
+		if k != ProxyCertificatesHashAnnotation {
+			requiredAnnotations[k] = v
+		}
+	}
+	mergeStringMap(&modified, &merged.Spec.Template.Annotations, requiredAnnotations)
+	if modified {
+		drifted = append(drifted, "pod annotations")
+	}
+
+	podSpec, requiredPodSpec := &merged.Spec.Template.Spec, &required.Spec.Template.Spec
+	if !equality.Semantic.DeepEqual(podSpec.NodeSelector, requiredPodSpec.NodeSelector) {
+		podSpec.NodeSelector = requiredPodSpec.NodeSelector
+		drifted = append(drifted, "node selector")
+	}
+	if !equality.Semantic.DeepEqual(podSpec.Tolerations, requiredPodSpec.Tolerations) {
+		podSpec.Tolerations = requiredPodSpec.Tolerations
+		drifted = append(drifted, "tolerations")
+	}
+	if !equality.Semantic.DeepEqual(podSpec.Affinity, requiredPodSpec.Affinity) {
+		podSpec.Affinity = requiredPodSpec.Affinity
+		drifted = append(drifted, "affinity")
+	}
+	if podSpec.PriorityClassName != requiredPodSpec.PriorityClassName {
+		podSpec.PriorityClassName = requiredPodSpec.PriorityClassName
+		drifted = append(drifted, "priority class")
+	}
+
+	drifted = append(drifted, mergeContainers(&merged.Spec.Template.Spec.Containers, required.Spec.Template.Spec.Containers)...)
+	if mergeVolumes(&merged.Spec.Template.Spec.Volumes, required.Spec.Template.Spec.Volumes) {
+		drifted = append(drifted, "volumes")
+	}
+
+	return merged, drifted
+}
+
+// mergeContainers sets containers managed by the controller as in the required containers, and returns names of
+// fields that have drifted. Only fields of the etcd-proxy container set by the controller are compared, after setting
+// defaults the API server sets on them. Other required containers come from the default pod template, which is
+// reconciled as a whole when it changes, so they are only added if missing. Containers not managed by the controller
+// are removed.
+func mergeContainers(existing *[]corev1.Container, required []corev1.Container) []string {
+	var drifted []string
+	if len(*existing) != len(required) {
+		drifted = append(drifted, "containers")
+	}
+
+	merged := []corev1.Container{}
+	for _, requiredContainer := range required {
+		var container *corev1.Container
+		for i := range *existing {
+			if (*existing)[i].Name == requiredContainer.Name {
+				container = (*existing)[i].DeepCopy()
+				break
+			}
+		}
+		if container == nil {
+			drifted = append(drifted, fmt.Sprintf("container %s", requiredContainer.Name))
+			merged = append(merged, requiredContainer)
+			continue
+		}
+		if container.Name == "etcdproxy" {
+			drifted = append(drifted, mergeProxyContainer(container, requiredContainer)...)
+		}
+		merged = append(merged, *container)
+	}
+
+	*existing = merged
+	return drifted
+}
+
+// mergeProxyContainer sets fields of the etcd-proxy container set by the controller as in the required container,
+// and returns names of fields that have drifted.
+func mergeProxyContainer(container *corev1.Container, required corev1.Container) []string {
+	var drifted []string
+	required = *required.DeepCopy()
+	setContainerDefaults(&required)
+
+	if container.Image != required.Image {
+		container.Image = required.Image
+		drifted = append(drifted, fmt.Sprintf("container %s image", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.Command, required.Command) {
+		container.Command = required.Command
+		drifted = append(drifted, fmt.Sprintf("container %s command", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.Args, required.Args) {
+		container.Args = required.Args
+		drifted = append(drifted, fmt.Sprintf("container %s args", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.Ports, required.Ports) {
+		container.Ports = required.Ports
+		drifted = append(drifted, fmt.Sprintf("container %s ports", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.Env, required.Env) {
+		container.Env = required.Env
+		drifted = append(drifted, fmt.Sprintf("container %s env", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.VolumeMounts, required.VolumeMounts) {
+		container.VolumeMounts = required.VolumeMounts
+		drifted = append(drifted, fmt.Sprintf("container %s volume mounts", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.Resources, required.Resources) {
+		container.Resources = required.Resources
+		drifted = append(drifted, fmt.Sprintf("container %s resources", container.Name))
+	}
+	if !equality.Semantic.DeepEqual(container.LivenessProbe, required.LivenessProbe) {
+		container.LivenessProbe = required.LivenessProbe
+		drifted = append(drifted, fmt.Sprintf("container %s liveness probe", container.Name))
+	}
+
+	return drifted
+}
+
+// setContainerDefaults sets defaults the API server sets on container fields compared by mergeProxyContainer,
+// so containers read from the API server don't drift from the required containers.
+func setContainerDefaults(container *corev1.Container) {
+	for i := range container.Ports {
+		if container.Ports[i].Protocol == "" {
+			container.Ports[i].Protocol = corev1.ProtocolTCP
+		}
+	}
+	for i := range container.Env {
+		if valueFrom := container.Env[i].ValueFrom; valueFrom != nil && valueFrom.FieldRef != nil && valueFrom.FieldRef.APIVersion == "" {
+			valueFrom.FieldRef.APIVersion = "v1"
+		}
+	}
+	container.Resources = defaultResourceRequests(container.Resources)
+
+	if probe := container.LivenessProbe; probe != nil {
+		if probe.TimeoutSeconds == 0 {
+			probe.TimeoutSeconds = 1
+		}
+		if probe.PeriodSeconds == 0 {
+			probe.PeriodSeconds = 10
+		}
+		if probe.SuccessThreshold == 0 {
+			probe.SuccessThreshold = 1
+		}
+		if probe.FailureThreshold == 0 {
+			probe.FailureThreshold = 3
+		}
+		if httpGet := probe.HTTPGet; httpGet != nil {
+			if httpGet.Path == "" {
+				httpGet.Path = "/"
+			}
+			if httpGet.Scheme == "" {
+				httpGet.Scheme = corev1.URISchemeHTTP
+			}
+		}
+	}
+}
+
+// mergeVolumes sets volumes as in the required volumes, and returns true if they have drifted. Default modes
+// set by the API server are kept, unless they are explicitly required.
+func mergeVolumes(existing *[]corev1.Volume, required []corev1.Volume) bool {
+	merged := []corev1.Volume{}
+	for _, requiredVolume := range required {
+		volume := *requiredVolume.DeepCopy()
+		for _, existingVolume := range *existing {
+			if existingVolume.Name != volume.Name {
+				continue
+			}
+			if volume.Secret != nil && existingVolume.Secret != nil && volume.Secret.DefaultMode == nil {
+				volume.Secret.DefaultMode = existingVolume.Secret.DefaultMode
+			}
+			if volume.ConfigMap != nil && existingVolume.ConfigMap != nil && volume.ConfigMap.DefaultMode == nil {
+				volume.ConfigMap.DefaultMode = existingVolume.ConfigMap.DefaultMode
+			}
+		}
+		merged = append(merged, volume)
+	}
+
+	if equality.Semantic.DeepEqual(*existing, merged) {
+		return false
+	}
+	*existing = merged
+	return true
+}
+
+// mergeService returns a copy of the existing Service with fields managed by the controller set as in the required
+// Service, along with names of fields that have drifted. Fields defaulted by the API server are kept.
+func mergeService(existing, required *corev1.Service) (*corev1.Service, []string) {
+	merged := existing.DeepCopy()
+	var drifted []string
+
+	if !equality.Semantic.DeepEqual(merged.Spec.Selector, required.Spec.Selector) {
+		merged.Spec.Selector = required.Spec.Selector
+		drifted = append(drifted, "selector")
+	}
+
+	ports := []corev1.ServicePort{}
+	for _, requiredPort := range required.Spec.Ports {
+		port := requiredPort
+		for _, existingPort := range existing.Spec.Ports {
+			if existingPort.Port == port.Port && port.NodePort == 0 {
+				port.NodePort = existingPort.NodePort
+			}
+		}
+		ports = append(ports, port)
+	}
+	if !equality.Semantic.DeepEqual(merged.Spec.Ports, ports) {
+		merged.Spec.Ports = ports
+		drifted = append(drifted, "ports")
+	}
+
+	return merged, drifted
+}
@@ -0,0 +1,305 @@
+package etcdproxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestMergeDeployment(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+	}
+	required := newDeployment(etcdStorage, "test-storage", etcdStorage.Name, "quay.io/coreos/etcd:v3.2.24",
+		"etcd-coreserving-ca", "etcd-coreserving-cert", []string{"https://test.etcd.svc:2379"}, "hash", nil)
+
+	tests := []struct {
+		name            string
+		modify          func(d *appsv1.Deployment)
+		expectedDrifted []string
+	}{
+		{
+			name:   "no drift",
+			modify: func(d *appsv1.Deployment) {},
+		},
+		{
+			name: "fields defaulted by the api server",
+			modify: func(d *appsv1.Deployment) {
+				mode := int32(0644)
+				d.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+				d.Spec.Template.Spec.Containers[0].ImagePullPolicy = v1.PullIfNotPresent
+				d.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyAlways
+				for _, volume := range d.Spec.Template.Spec.Volumes {
+					if volume.Secret != nil {
+						volume.Secret.DefaultMode = &mode
+					}
+					if volume.ConfigMap != nil {
+						volume.ConfigMap.DefaultMode = &mode
+					}
+				}
+			},
+		},
+		{
+			name: "certificates hash is not reconciled",
+			modify: func(d *appsv1.Deployment) {
+				d.Spec.Template.Annotations[ProxyCertificatesHashAnnotation] = "stale-hash"
+			},
+		},
+		{
+			name: "replicas are not reconciled while scaled down",
+			modify: func(d *appsv1.Deployment) {
+				replicas := int32(0)
+				d.Spec.Replicas = &replicas
+				d.Annotations = map[string]string{QuotaScaledDownReplicasAnnotation: "3"}
+			},
+		},
+		{
+			name: "image and args",
+			modify: func(d *appsv1.Deployment) {
+				d.Spec.Template.Spec.Containers[0].Image = "quay.io/coreos/etcd:v3.2.18"
+				d.Spec.Template.Spec.Containers[0].Args[0] = "--endpoints=https://old.etcd.svc:2379"
+			},
+			expectedDrifted: []string{"container etcdproxy image", "container etcdproxy args"},
+		},
+		{
+			name: "replicas",
+			modify: func(d *appsv1.Deployment) {
+				replicas := int32(1)
+				d.Spec.Replicas = &replicas
+			},
+			expectedDrifted: []string{"replicas"},
+		},
+		{
+			name: "additional container and volume",
+			modify: func(d *appsv1.Deployment) {
+				d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, v1.Container{Name: "sidecar"})
+				d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, v1.Volume{Name: "sidecar"})
+			},
+			expectedDrifted: []string{"containers", "volumes"},
+		},
+		{
+			name: "proxy template",
+			modify: func(d *appsv1.Deployment) {
+				d.Spec.Template.Spec.NodeSelector = map[string]string{"node-role": "storage"}
+				d.Spec.Template.Spec.PriorityClassName = "system-cluster-critical"
+				d.Spec.Template.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}
+			},
+			expectedDrifted: []string{"node selector", "priority class", "container etcdproxy resources"},
+		},
+		{
+			name: "pod labels",
+			modify: func(d *appsv1.Deployment) {
+				d.Spec.Template.Labels["apiserver"] = "test-2"
+			},
+			expectedDrifted: []string{"pod labels"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := required.DeepCopy()
+			tc.modify(existing)
+			original := existing.DeepCopy()
+
+			merged, drifted := mergeDeployment(existing, required)
+			if strings.Join(drifted, ", ") != strings.Join(tc.expectedDrifted, ", ") {
+				t.Fatalf("expected drifted fields '%v', but got '%v'", tc.expectedDrifted, drifted)
+			}
+			if len(drifted) != 0 {
+				if _, drifted := mergeDeployment(merged, required); len(drifted) != 0 {
+					t.Fatalf("expected merged deployment not to drift, but got '%v'", drifted)
+				}
+			}
+			if !reflect.DeepEqual(existing, original) {
+				t.Fatal("expected existing deployment not to be modified")
+			}
+		})
+	}
+}
+
+func TestMergeDeploymentWithAPIServerDefaults(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+	}
+	defaultPodTemplate := &v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{ProxyPodTemplateHashAnnotation: "template-hash"},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name: "etcdproxy",
+					Env: []v1.EnvVar{{
+						Name:      "POD_NAME",
+						ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+					}},
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")},
+					},
+				},
+				{
+					Name:  "metrics",
+					Image: "prom/statsd-exporter",
+					Ports: []v1.ContainerPort{{Name: "metrics", ContainerPort: 9102}},
+					LivenessProbe: &v1.Probe{
+						Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{Port: intstr.FromInt(9102)}},
+					},
+				},
+			},
+		},
+	}
+	required := newDeployment(etcdStorage, "test-storage", etcdStorage.Name, "quay.io/coreos/etcd:v3.2.24",
+		"etcd-coreserving-ca", "etcd-coreserving-cert", []string{"https://test.etcd.svc:2379"}, "hash", defaultPodTemplate)
+
+	// The live Deployment has defaults set by the API server on all containers.
+	existing := required.DeepCopy()
+	for i := range existing.Spec.Template.Spec.Containers {
+		container := &existing.Spec.Template.Spec.Containers[i]
+		container.TerminationMessagePath = "/dev/termination-log"
+		container.TerminationMessagePolicy = v1.TerminationMessageReadFile
+		container.ImagePullPolicy = v1.PullIfNotPresent
+		for j := range container.Ports {
+			container.Ports[j].Protocol = v1.ProtocolTCP
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.FieldRef != nil {
+				env.ValueFrom.FieldRef.APIVersion = "v1"
+			}
+		}
+		if probe := container.LivenessProbe; probe != nil {
+			if probe.HTTPGet != nil {
+				probe.HTTPGet.Path = "/"
+				probe.HTTPGet.Scheme = v1.URISchemeHTTP
+			}
+			if probe.TimeoutSeconds == 0 {
+				probe.TimeoutSeconds = 1
+			}
+			if probe.PeriodSeconds == 0 {
+				probe.PeriodSeconds = 10
+			}
+			if probe.SuccessThreshold == 0 {
+				probe.SuccessThreshold = 1
+			}
+			if probe.FailureThreshold == 0 {
+				probe.FailureThreshold = 3
+			}
+		}
+	}
+	existing.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyAlways
+	existing.Spec.Template.Spec.DNSPolicy = v1.DNSClusterFirst
+
+	if _, drifted := mergeDeployment(existing, required); len(drifted) != 0 {
+		t.Fatalf("expected no drift with api server defaults, but got '%v'", drifted)
+	}
+
+	// Fields of the etcd-proxy container set by the controller are still reconciled.
+	existing.Spec.Template.Spec.Containers[0].Args = existing.Spec.Template.Spec.Containers[0].Args[1:]
+	merged, drifted := mergeDeployment(existing, required)
+	if strings.Join(drifted, ", ") != "container etcdproxy args" {
+		t.Fatalf("expected drifted etcd-proxy args, but got '%v'", drifted)
+	}
+	if _, drifted := mergeDeployment(merged, required); len(drifted) != 0 {
+		t.Fatalf("expected merged deployment not to drift, but got '%v'", drifted)
+	}
+}
+
+func TestMergeService(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+	}
+	required := newService(etcdStorage, "test-storage")
+
+	existing := required.DeepCopy()
+	existing.Spec.ClusterIP = "10.0.0.10"
+	existing.Spec.Type = v1.ServiceTypeClusterIP
+	if _, drifted := mergeService(existing, required); len(drifted) != 0 {
+		t.Fatalf("expected no drift, but got '%v'", drifted)
+	}
+
+	existing.Spec.Selector = map[string]string{"app": "other"}
+	existing.Spec.Ports[0].Port = 2380
+	merged, drifted := mergeService(existing, required)
+	if strings.Join(drifted, ", ") != "selector, ports" {
+		t.Fatalf("expected selector and ports to drift, but got '%v'", drifted)
+	}
+	if merged.Spec.ClusterIP != "10.0.0.10" {
+		t.Fatalf("expected cluster ip to be kept, but got '%s'", merged.Spec.ClusterIP)
+	}
+	if _, drifted := mergeService(merged, required); len(drifted) != 0 {
+		t.Fatalf("expected merged service not to drift, but got '%v'", drifted)
+	}
+}
+
+func TestSyncHandlerReconcilesDrift(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "kube-apiserver-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.24",
+	}
+	// The Deployment was created by the controller running with an old etcd-proxy image and core etcd URL.
+	deployment := newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name,
+		"quay.io/coreos/etcd:v3.2.18", etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName,
+		[]string{"https://old.etcd.svc:2379"}, "", nil)
+	service := newService(etcdStorage, etcdProxyConfig.ControllerNamespace)
+	service.Spec.Selector = map[string]string{"apiserver": "test-2"}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, deployment, service})
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+	if err := c.syncHandler(etcdStorage.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.kubeclientset.AppsV1().Deployments(etcdProxyConfig.ControllerNamespace).Get(deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := d.Spec.Template.Spec.Containers[0]
+	if container.Image != etcdProxyConfig.ProxyImage {
+		t.Fatalf("expected image '%s', but got '%s'", etcdProxyConfig.ProxyImage, container.Image)
+	}
+	if container.Args[0] != "--endpoints=https://test.etcd.svc:2379" {
+		t.Fatalf("expected core etcd endpoints to be updated, but got '%s'", container.Args[0])
+	}
+
+	s, err := c.kubeclientset.CoreV1().Services(etcdProxyConfig.ControllerNamespace).Get(service.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Spec.Selector["apiserver"] != etcdStorage.Name {
+		t.Fatalf("expected service selector to be updated, but got %v", s.Spec.Selector)
+	}
+
+	driftEvents := 0
+	for len(recorder.Events) != 0 {
+		if event := <-recorder.Events; strings.Contains(event, EtcdProxyDriftReconciled) {
+			driftEvents++
+		}
+	}
+	if driftEvents != 2 {
+		t.Fatalf("expected 2 drift events, but got %d", driftEvents)
+	}
+}
@@ -24,11 +24,11 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
-	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	clientset "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned"
 	samplescheme "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/scheme"
-	informers "github.com/xmudrii/etcdproxy-controller/pkg/client/informers/externalversions/etcd/v1alpha1"
-	listers "github.com/xmudrii/etcdproxy-controller/pkg/client/listers/etcd/v1alpha1"
+	informers "github.com/xmudrii/etcdproxy-controller/pkg/client/informers/externalversions/etcd/v1beta1"
+	listers "github.com/xmudrii/etcdproxy-controller/pkg/client/listers/etcd/v1beta1"
 )
 
 const httpUserAgentName = "etcdproxy-controller"
@@ -42,6 +42,9 @@ const (
 
 	// CertificatesDeployFailure is used as part of the Event reason when a Certificates are not generated or deployed successfully.
 	CertificatesDeployFailure = "CertificatesDeployFailure"
+
+	// EtcdProxyRestarted is used as part of the Event reason when etcd-proxy pods are restarted to pick up new certificates.
+	EtcdProxyRestarted = "EtcdProxyRestarted"
 )
 
 // EtcdProxyController is the controller implementation for EtcdStorage resources
@@ -57,6 +60,12 @@ type EtcdProxyController struct {
 	servicesLister corev1listers.ServiceLister
 	servicesSynced cache.InformerSynced
 
+	endpointsLister corev1listers.EndpointsLister
+	endpointsSynced cache.InformerSynced
+
+	configMapsLister corev1listers.ConfigMapLister
+	configMapsSynced cache.InformerSynced
+
 	etcdstoragesLister listers.EtcdStorageLister
 	etcdstoragesSynced cache.InformerSynced
 
@@ -64,6 +73,18 @@ type EtcdProxyController struct {
 	// recorder is an event recorder for recording Event resources to the Kubernetes API.
 	recorder record.EventRecorder
 
+	// certificateExpiry keeps track of expiry dates of certificates managed by the controller, exposed as metrics.
+	certificateExpiry *certificateExpiryTracker
+
+	// proxyPodTemplate keeps the last default etcd-proxy pod template loaded successfully.
+	proxyPodTemplate *proxyPodTemplateCache
+
+	// health keeps track of the controller state reported by health checks.
+	health *healthState
+
+	// currentTime returns the current time used for issuing and renewing certificates.
+	currentTime func() time.Time
+
 	// config is used to wire information used by controller to create Deployments.
 	config *EtcdProxyControllerConfig
 }
@@ -74,6 +95,8 @@ func NewEtcdProxyController(
 	etcdProxyClient clientset.Interface,
 	deploymentsInformer appsinformers.DeploymentInformer,
 	servicesInformer corev1informers.ServiceInformer,
+	endpointsInformer corev1informers.EndpointsInformer,
+	configMapsInformer corev1informers.ConfigMapInformer,
 	etcdstorageInformer informers.EtcdStorageInformer,
 	config *EtcdProxyControllerConfig) *EtcdProxyController {
 
@@ -93,10 +116,18 @@ func NewEtcdProxyController(
 		deploymentsSynced:  deploymentsInformer.Informer().HasSynced,
 		servicesLister:     servicesInformer.Lister(),
 		servicesSynced:     servicesInformer.Informer().HasSynced,
+		endpointsLister:    endpointsInformer.Lister(),
+		endpointsSynced:    endpointsInformer.Informer().HasSynced,
+		configMapsLister:   configMapsInformer.Lister(),
+		configMapsSynced:   configMapsInformer.Informer().HasSynced,
 		etcdstoragesLister: etcdstorageInformer.Lister(),
 		etcdstoragesSynced: etcdstorageInformer.Informer().HasSynced,
 		workqueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "EtcdStorages"),
 		recorder:           recorder,
+		certificateExpiry:  &certificateExpiryTracker{},
+		proxyPodTemplate:   &proxyPodTemplateCache{},
+		health:             newHealthState(),
+		currentTime:        time.Now,
 		config:             config,
 	}
 
@@ -145,6 +176,38 @@ func NewEtcdProxyController(
 		DeleteFunc: controller.handleObject,
 	})
 
+	// Endpoints are watched to update the Available condition when etcd-proxy pods become ready or unready.
+	endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleEndpoints,
+		UpdateFunc: func(old, new interface{}) {
+			newEndpoints := new.(*corev1.Endpoints)
+			oldEndpoints := old.(*corev1.Endpoints)
+			if newEndpoints.ResourceVersion == oldEndpoints.ResourceVersion {
+				// Periodic resync will send update events for all known Endpoints.
+				// Two different versions of the same Endpoints will always have different RVs.
+				return
+			}
+			controller.handleEndpoints(new)
+		},
+		DeleteFunc: controller.handleEndpoints,
+	})
+
+	// The default etcd-proxy pod template ConfigMap is watched to update all etcd-proxy Deployments when it changes.
+	configMapsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleProxyPodTemplate,
+		UpdateFunc: func(old, new interface{}) {
+			newConfigMap := new.(*corev1.ConfigMap)
+			oldConfigMap := old.(*corev1.ConfigMap)
+			if newConfigMap.ResourceVersion == oldConfigMap.ResourceVersion {
+				// Periodic resync will send update events for all known ConfigMaps.
+				// Two different versions of the same ConfigMap will always have different RVs.
+				return
+			}
+			controller.handleProxyPodTemplate(new)
+		},
+		DeleteFunc: controller.handleProxyPodTemplate,
+	})
+
 	return controller
 }
 
@@ -158,10 +221,16 @@ func (c *EtcdProxyController) Run(threadiness int, stopCh <-chan struct{}) error
 
 	// Start the informer factories to begin populating the informer caches
 	glog.Info("Starting EtcdStorage controller")
+	c.health.setRunning(true)
+	defer c.health.setRunning(false)
+
+	// Periodically check the connectivity to the core etcd, which is reported by readiness checks.
+	go wait.Until(c.updateCoreEtcdHealth, coreEtcdHealthCheckPeriod, stopCh)
 
 	// Wait for the caches to be synced before starting workers
 	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.servicesSynced, c.etcdstoragesSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.servicesSynced, c.endpointsSynced,
+		c.configMapsSynced, c.etcdstoragesSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
@@ -171,6 +240,10 @@ func (c *EtcdProxyController) Run(threadiness int, stopCh <-chan struct{}) error
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
+	// Periodically measure the usage of the core etcd, which is reported in the EtcdStorage status
+	// and used to enforce EtcdStorage quotas.
+	go wait.Until(c.measureUsage, c.config.UsageMeasurementPeriod, stopCh)
+
 	glog.Info("Started workers")
 	<-stopCh
 	glog.Info("Shutting down workers")
@@ -221,7 +294,13 @@ func (c *EtcdProxyController) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// EtcdStorage resource to be synced.
-		if err := c.syncHandler(key); err != nil {
+		start := time.Now()
+		c.health.syncStarted(key)
+		err := c.syncHandler(key)
+		c.health.syncFinished(key)
+		syncDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			syncErrors.Inc()
 			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
 		}
 		// Finally, if no error occurs we Forget this item so it does not
@@ -257,6 +336,7 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 		// processing.
 		if errors.IsNotFound(err) {
 			runtime.HandleError(fmt.Errorf("etcdstorage '%s' in work queue no longer exists", key))
+			c.certificateExpiry.forget(name)
 			return nil
 		}
 
@@ -265,19 +345,96 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 
 	// This prevents syncHandler to continue in case an EtcdStorage resource is being deleted.
 	// Otherwise, the controller ends up in the Deployment recreation loop until GC doesn't
-	// delete the EtcdStorage resource.
+	// delete the EtcdStorage resource. Before the resource is deleted, the data retention
+	// policy is enforced on the core etcd, the core etcd user and role are removed, and
+	// Secrets and ConfigMaps managed by the controller are cleaned up.
 	if !etcdstorage.DeletionTimestamp.IsZero() {
 		glog.V(2).Infof("EtcdStorage %s is being terminated.", etcdstorage.Name)
-		return nil
+		c.certificateExpiry.forget(etcdstorage.Name)
+		if hasFinalizer(etcdstorage.Finalizers, DataRetentionFinalizer) {
+			if err := c.enforceDataRetentionPolicy(etcdstorage); err != nil {
+				c.recorder.Event(etcdstorage, corev1.EventTypeWarning, DataRetentionFailure,
+					fmt.Sprintf("Unable to enforce data retention policy for EtcdStorage %s: %v", etcdstorage.Name, err))
+				return err
+			}
+
+			etcdstorage, err = c.removeFinalizer(etcdstorage, DataRetentionFinalizer)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !hasFinalizer(etcdstorage.Finalizers, CleanupFinalizer) {
+			return nil
+		}
+
+		if err := c.removeEtcdCredentials(etcdstorage); err != nil {
+			c.recorder.Event(etcdstorage, corev1.EventTypeWarning, CleanupFailure,
+				fmt.Sprintf("Unable to remove core etcd credentials for EtcdStorage %s: %v", etcdstorage.Name, err))
+			return err
+		}
+
+		if err := c.cleanupCertificates(etcdstorage); err != nil {
+			c.recorder.Event(etcdstorage, corev1.EventTypeWarning, CleanupFailure,
+				fmt.Sprintf("Unable to clean up certificates for EtcdStorage %s: %v", etcdstorage.Name, err))
+			return err
+		}
+
+		_, err = c.removeFinalizer(etcdstorage, CleanupFinalizer)
+		return err
+	}
+
+	// Ensure the cleanup finalizer is present, so the controller can clean up
+	// Secrets and ConfigMaps once the EtcdStorage resource is deleted.
+	etcdstorage, err = c.addFinalizer(etcdstorage, CleanupFinalizer)
+	if err != nil {
+		return err
+	}
+
+	// The data retention finalizer is present only if the data retention policy requires
+	// the controller to delete or export the data once the EtcdStorage resource is deleted.
+	if needsDataRetentionFinalizer(etcdstorage) {
+		etcdstorage, err = c.addFinalizer(etcdstorage, DataRetentionFinalizer)
+	} else {
+		etcdstorage, err = c.removeFinalizer(etcdstorage, DataRetentionFinalizer)
+	}
+	if err != nil {
+		return err
 	}
 
-	etcdstorageCondition := etcdstoragev1alpha1.EtcdStorageCondition{
-		Type:   etcdstoragev1alpha1.Deployed,
-		Status: etcdstoragev1alpha1.ConditionUnknown,
+	// Set defaults for fields not set in the EtcdStorage spec, such as certificate validities.
+	// Defaults are set on a copy of the EtcdStorage and are not persisted.
+	etcdstorage = etcdstorage.DeepCopy()
+	SetEtcdStorageDefaults(etcdstorage, c.config.CertificateValidityDefaults)
+	// Certificate rotation phases are recorded in the status of the copy while certificates are handled,
+	// so the observed status is kept to detect status changes.
+	observedStatus := etcdstorage.Status.DeepCopy()
+
+	etcdstorageCondition := etcdstoragev1beta1.EtcdStorageCondition{
+		Type:   etcdstoragev1beta1.Deployed,
+		Status: etcdstoragev1beta1.ConditionUnknown,
 	}
 
 	var errs []error
 	var certErrs []error
+	// Provision the core etcd user and role restricted to the EtcdStorage prefix, if the core etcd authentication is enabled.
+	if err = c.ensureEtcdCredentials(etcdstorage); err != nil {
+		c.recorder.Event(etcdstorage, corev1.EventTypeWarning, EtcdCredentialsFailure,
+			fmt.Sprintf("Unable to provision core etcd credentials for EtcdStorage %s: %v", etcdstorage.Name, err))
+		errs = append(errs, err)
+	}
+	// Issue the core etcd client certificate authenticating as the user restricted to the EtcdStorage prefix,
+	// if the core etcd signer is provided.
+	coreCertSecretName := c.config.CoreEtcd.CertSecretName
+	if c.config.CoreEtcd.SignerSecretName != "" {
+		coreCertSecretName = etcdClientCertSecretName(etcdstorage)
+		if err = c.ensureEtcdClientCertificate(etcdstorage); err != nil {
+			c.recorder.Event(etcdstorage, corev1.EventTypeWarning, EtcdCredentialsFailure,
+				fmt.Sprintf("Unable to issue core etcd client certificate for EtcdStorage %s: %v", etcdstorage.Name, err))
+			errs = append(errs, err)
+		}
+	}
+
 	// Deploy Server Etcd Proxy certificates.
 	if err = c.ensureClientCertificates(etcdstorage); err != nil {
 		certErrs = append(certErrs, err)
@@ -285,21 +442,39 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 	if err = c.ensureServerCertificates(etcdstorage); err != nil {
 		certErrs = append(certErrs, err)
 	}
+	certificatesHash, err := c.proxyCertificatesHash(etcdstorage)
+	if err != nil {
+		certErrs = append(certErrs, err)
+	}
 
 	// Etcd proxy Deployment.
+	// A broken default pod template ConfigMap must not block reconciling EtcdStorages. The EtcdStorage is
+	// enqueued again once the ConfigMap changes.
+	defaultPodTemplate, err := c.defaultProxyPodTemplate()
+	if err != nil {
+		fallback := "not using a default pod template"
+		if defaultPodTemplate != nil {
+			fallback = "using the last loaded default pod template"
+		}
+		c.recorder.Event(etcdstorage, corev1.EventTypeWarning, ProxyPodTemplateFailure,
+			fmt.Sprintf("Unable to load default etcd-proxy pod template, %s: %v", fallback, err))
+	}
+	requiredDeployment := newDeployment(etcdstorage, c.config.ControllerNamespace, etcdstorage.Name,
+		c.config.ProxyImage, c.config.CoreEtcd.CAConfigMapName, coreCertSecretName,
+		c.config.CoreEtcd.URLs, certificatesHash, defaultPodTemplate)
+	if c.config.CoreEtcd.AuthSecretName != "" {
+		applyEtcdCredentials(requiredDeployment, etcdCredentialsSecretName(etcdstorage))
+	}
 	deployment, err := c.deploymentsLister.Deployments(c.config.ControllerNamespace).Get(deploymentName(etcdstorage))
 	if errors.IsNotFound(err) {
-		deployment, err = c.kubeclientset.AppsV1().Deployments(c.config.ControllerNamespace).Create(newDeployment(
-			etcdstorage, c.config.ControllerNamespace, etcdstorage.Name,
-			c.config.ProxyImage, c.config.CoreEtcd.CAConfigMapName, c.config.CoreEtcd.CertSecretName,
-			c.config.CoreEtcd.URLs))
+		deployment, err = c.kubeclientset.AppsV1().Deployments(c.config.ControllerNamespace).Create(requiredDeployment)
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
 	// temporary network failure, or any other transient reason.
 	if err != nil {
-		etcdstorageCondition.Status = etcdstoragev1alpha1.ConditionFalse
+		etcdstorageCondition.Status = etcdstoragev1beta1.ConditionFalse
 		etcdstorageCondition.Reason = "FailedDeploying"
 		etcdstorageCondition.Message = err.Error()
 		errs = append(errs, err)
@@ -308,7 +483,7 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 	// If the ReplicaSet is not controlled by this EtcdStorage resource, we should try to update Owner reference.
 	if !metav1.IsControlledBy(deployment, etcdstorage) {
 		deployment.SetOwnerReferences([]metav1.OwnerReference{
-			*metav1.NewControllerRef(etcdstorage, etcdstoragev1alpha1.SchemeGroupVersion.WithKind("EtcdStorage")),
+			*metav1.NewControllerRef(etcdstorage, etcdstoragev1beta1.SchemeGroupVersion.WithKind("EtcdStorage")),
 		})
 
 		deployment, err = c.kubeclientset.AppsV1().Deployments(c.config.ControllerNamespace).Update(deployment)
@@ -317,19 +492,53 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 		}
 	}
 
+	// Changes to the controller flags, such as the etcd-proxy image or the core etcd URLs, and manual
+	// changes to the Deployment are reconciled, so the Deployment always matches the desired state.
+	deployment, err = c.reconcileDeployment(etcdstorage, deployment, requiredDeployment)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// If the Server certificate or the Client CA bundle have changed, update the hash in the pod template,
+	// so the Deployment rolls out etcd-proxy pods using the new certificates.
+	if certificatesHash != "" && deployment.Spec.Template.Annotations[ProxyCertificatesHashAnnotation] != certificatesHash {
+		deployment, err = c.restartEtcdProxy(deployment, certificatesHash)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			c.recorder.Event(etcdstorage, corev1.EventTypeNormal, EtcdProxyRestarted,
+				fmt.Sprintf("Rolling out etcd-proxy Deployment %s to pick up new certificates", deployment.Name))
+		}
+	}
+
+	// The etcd-proxy Deployment is scaled to zero replicas while the EtcdStorage quota is exceeded,
+	// if the ScaleDown quota enforcement is used.
+	deployment, err = c.enforceQuota(etcdstorage, deployment)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Old Serving CA certificates are removed from the bundles only once all etcd-proxy pods are
+	// serving the current Server certificate.
+	if certificatesHash != "" && deploymentRolledOut(deployment, certificatesHash) {
+		if err = c.removeStaleServingCAs(etcdstorage); err != nil {
+			certErrs = append(certErrs, err)
+		}
+	}
+
 	// Create Service to expose the etcdproxy pod.
 	serviceName := fmt.Sprintf("etcd-%s", etcdstorage.ObjectMeta.Name)
+	requiredService := newService(etcdstorage, c.config.ControllerNamespace)
 	service, err := c.servicesLister.Services(c.config.ControllerNamespace).Get(serviceName)
 	if errors.IsNotFound(err) {
-		service, err = c.kubeclientset.CoreV1().Services(c.config.ControllerNamespace).Create(newService(
-			etcdstorage, c.config.ControllerNamespace))
+		service, err = c.kubeclientset.CoreV1().Services(c.config.ControllerNamespace).Create(requiredService)
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
 	// temporary network failure, or any other transient reason.
 	if err != nil {
-		etcdstorageCondition.Status = etcdstoragev1alpha1.ConditionFalse
+		etcdstorageCondition.Status = etcdstoragev1beta1.ConditionFalse
 		etcdstorageCondition.Reason = "FailedDeploying"
 		etcdstorageCondition.Message = err.Error()
 		errs = append(errs, err)
@@ -339,7 +548,7 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 	// a warning to the event recorder and ret
 	if !metav1.IsControlledBy(service, etcdstorage) {
 		service.SetOwnerReferences([]metav1.OwnerReference{
-			*metav1.NewControllerRef(etcdstorage, etcdstoragev1alpha1.SchemeGroupVersion.WithKind("EtcdStorage")),
+			*metav1.NewControllerRef(etcdstorage, etcdstoragev1beta1.SchemeGroupVersion.WithKind("EtcdStorage")),
 		})
 
 		service, err = c.kubeclientset.CoreV1().Services(c.config.ControllerNamespace).Update(service)
@@ -348,18 +557,38 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 		}
 	}
 
+	// Manual changes to the Service are reconciled, so the Service always matches the desired state.
+	service, err = c.reconcileService(etcdstorage, service, requiredService)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// PodDisruptionBudget protects etcd-proxy pods from being evicted all at once, e.g. while draining nodes.
+	if err = c.ensurePodDisruptionBudget(newPodDisruptionBudget(etcdstorage, c.config.ControllerNamespace)); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Endpoints of the etcd-proxy Service are used to determine is the EtcdStorage available.
+	endpoints, err := c.endpointsLister.Endpoints(c.config.ControllerNamespace).Get(serviceName)
+	if err != nil && !errors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+
 	// Finally, we update the status block of the EtcdStorage resource to reflect the
 	// current state of the world
-	if etcdstorageCondition.Status == etcdstoragev1alpha1.ConditionUnknown {
-		etcdstorageCondition = etcdstoragev1alpha1.EtcdStorageCondition{
-			Type:    etcdstoragev1alpha1.Deployed,
-			Status:  etcdstoragev1alpha1.ConditionTrue,
+	if etcdstorageCondition.Status == etcdstoragev1beta1.ConditionUnknown {
+		etcdstorageCondition = etcdstoragev1beta1.EtcdStorageCondition{
+			Type:    etcdstoragev1beta1.Deployed,
+			Status:  etcdstoragev1beta1.ConditionTrue,
 			Reason:  "Deployed",
 			Message: "etcdproxy replicaset and service created",
 		}
 	}
 
-	_, err = c.updateEtcdStorageStatus(etcdstorage, etcdstorageCondition)
+	_, err = c.updateEtcdStorageStatus(etcdstorage, observedStatus, etcdstorageCondition,
+		availableCondition(deployment, endpoints),
+		progressingCondition(deployment),
+		certificatesReadyCondition(certErrs))
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -378,18 +607,38 @@ func (c *EtcdProxyController) syncHandler(key string) error {
 	return utilerrors.NewAggregate(errs)
 }
 
-func (c *EtcdProxyController) updateEtcdStorageStatus(etcdstorage *etcdstoragev1alpha1.EtcdStorage,
-	condition etcdstoragev1alpha1.EtcdStorageCondition) (*etcdstoragev1alpha1.EtcdStorage, error) {
+// restartEtcdProxy updates the certificates hash annotation in the pod template of the etcd-proxy Deployment,
+// which triggers a rolling update of etcd-proxy pods.
+func (c *EtcdProxyController) restartEtcdProxy(deployment *appsv1.Deployment, certificatesHash string) (*appsv1.Deployment, error) {
+	deploymentCopy := deployment.DeepCopy()
+	if deploymentCopy.Spec.Template.Annotations == nil {
+		deploymentCopy.Spec.Template.Annotations = map[string]string{}
+	}
+	deploymentCopy.Spec.Template.Annotations[ProxyCertificatesHashAnnotation] = certificatesHash
+
+	updated, err := c.kubeclientset.AppsV1().Deployments(deploymentCopy.Namespace).Update(deploymentCopy)
+	if err != nil {
+		return deployment, err
+	}
+	return updated, nil
+}
+
+// updateEtcdStorageStatus sets the provided conditions in the EtcdStorage status and updates the EtcdStorage resource
+// if its status differs from the observed status.
+func (c *EtcdProxyController) updateEtcdStorageStatus(etcdstorage *etcdstoragev1beta1.EtcdStorage, observedStatus *etcdstoragev1beta1.EtcdStorageStatus,
+	conditions ...etcdstoragev1beta1.EtcdStorageCondition) (*etcdstoragev1beta1.EtcdStorage, error) {
 	etcdstorageCopy := etcdstorage.DeepCopy()
-	etcdstoragev1alpha1.SetEtcdStorageCondition(etcdstorageCopy, condition)
+	for _, condition := range conditions {
+		etcdstoragev1beta1.SetEtcdStorageCondition(etcdstorageCopy, condition)
+	}
 
 	// We're not updating the EtcdStorage resource if there are no Status changes between new and old objects
 	// in order to prevent Update loops.
-	if equality.Semantic.DeepEqual(etcdstorageCopy.Status, etcdstorage.Status) {
+	if equality.Semantic.DeepEqual(etcdstorageCopy.Status, *observedStatus) {
 		return etcdstorage, nil
 	}
 
-	etcdstorageCopy, err := c.etcdProxyClient.EtcdV1alpha1().EtcdStorages().UpdateStatus(etcdstorageCopy)
+	etcdstorageCopy, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().UpdateStatus(etcdstorageCopy)
 	return etcdstorageCopy, err
 }
 
@@ -445,3 +694,23 @@ func (c *EtcdProxyController) handleObject(obj interface{}) {
 		return
 	}
 }
+
+// handleEndpoints takes Endpoints of a Service and enqueues the EtcdStorage resource owning that Service.
+// Endpoints have the same name as the Service, but don't have the OwnerReference set.
+func (c *EtcdProxyController) handleEndpoints(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	endpoints, ok := obj.(*corev1.Endpoints)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("error decoding endpoints, invalid type"))
+		return
+	}
+
+	service, err := c.servicesLister.Services(endpoints.Namespace).Get(endpoints.Name)
+	if err != nil {
+		glog.V(4).Infof("ignoring endpoints '%s' without service: %v", endpoints.Name, err)
+		return
+	}
+	c.handleObject(service)
+}
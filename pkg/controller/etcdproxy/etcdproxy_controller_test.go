@@ -17,14 +17,16 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
-	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	etcdclient "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned/fake"
-	etcdlisters "github.com/xmudrii/etcdproxy-controller/pkg/client/listers/etcd/v1alpha1"
+	etcdlisters "github.com/xmudrii/etcdproxy-controller/pkg/client/listers/etcd/v1beta1"
 )
 
 func newEtcdProxyControllerMock(config *EtcdProxyControllerConfig, startingObjects []runtime.Object) *EtcdProxyController {
 	dsIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
 	svcIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
+	epIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
+	cmIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
 	esIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
 
 	var kubeObjs []runtime.Object
@@ -35,10 +37,16 @@ func newEtcdProxyControllerMock(config *EtcdProxyControllerConfig, startingObjec
 		case *v1.Service:
 			kubeObjs = append(kubeObjs, obj)
 			svcIndexer.Add(obj)
+		case *v1.Endpoints:
+			kubeObjs = append(kubeObjs, obj)
+			epIndexer.Add(obj)
+		case *v1.ConfigMap:
+			kubeObjs = append(kubeObjs, obj)
+			cmIndexer.Add(obj)
 		case *appsv1.Deployment:
 			kubeObjs = append(kubeObjs, obj)
 			dsIndexer.Add(obj)
-		case *v1alpha1.EtcdStorage:
+		case *v1beta1.EtcdStorage:
 			esObjs = append(esObjs, obj)
 			esIndexer.Add(obj)
 		default:
@@ -56,24 +64,30 @@ func newEtcdProxyControllerMock(config *EtcdProxyControllerConfig, startingObjec
 		kubeclientset:     kubeClient,
 		deploymentsLister: dslisters.NewDeploymentLister(dsIndexer),
 		servicesLister:    corelisters.NewServiceLister(svcIndexer),
+		endpointsLister:   corelisters.NewEndpointsLister(epIndexer),
+		configMapsLister:  corelisters.NewConfigMapLister(cmIndexer),
 		recorder:          &record.FakeRecorder{},
+		certificateExpiry: &certificateExpiryTracker{},
+		proxyPodTemplate:  &proxyPodTemplateCache{},
+		health:            newHealthState(),
+		currentTime:       time.Now,
 
 		config: config,
 	}
 }
 
 func TestSyncHandler(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				CACertConfigMaps: []v1alpha1.CABundleDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
 					{
 						Name:      "etcd-serving-ca",
 						Namespace: "k8s-sample-apiserver",
 					},
 				},
-				ClientCertSecrets: []v1alpha1.ClientCertificateDestination{
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
 					{
 						Name:      "etcd-client-cert",
 						Namespace: "k8s-sample-apiserver",
@@ -85,8 +99,8 @@ func TestSyncHandler(t *testing.T) {
 			},
 		}
 	}
-	etcdStorageNoCerts := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorageNoCerts := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
 		}
 	}
@@ -111,7 +125,7 @@ func TestSyncHandler(t *testing.T) {
 
 	tests := []struct {
 		name                   string
-		startingEtcdStorage    *v1alpha1.EtcdStorage
+		startingEtcdStorage    *v1beta1.EtcdStorage
 		startingConfigMap      *v1.ConfigMap
 		startingSecret         *v1.Secret
 		etcdProxyConfig        *EtcdProxyControllerConfig
@@ -204,22 +218,119 @@ func TestSyncHandler(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+
+			// Check is cleanup finalizer added.
+			es, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(tc.startingEtcdStorage.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasFinalizer(es.Finalizers, CleanupFinalizer) {
+				t.Fatalf("expected finalizer '%s' to be added", CleanupFinalizer)
+			}
+
+			// Check is PodDisruptionBudget created.
+			_, err = c.kubeclientset.PolicyV1beta1().PodDisruptionBudgets(tc.etcdProxyConfig.ControllerNamespace).Get(tc.expectedDeploymentName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("poddisruptionbudget not found: %v", err)
+			}
+
+			// Check are conditions set. No etcd-proxy pods are running, so the EtcdStorage is not available.
+			if !v1beta1.IsEtcdStorageConditionTrue(es, v1beta1.CertificatesReady) {
+				t.Fatalf("expected condition '%s' to be true, but got %+v", v1beta1.CertificatesReady, es.Status.Conditions)
+			}
+			if !v1beta1.IsEtcdStorageConditionFalse(es, v1beta1.Available) {
+				t.Fatalf("expected condition '%s' to be false, but got %+v", v1beta1.Available, es.Status.Conditions)
+			}
+		})
+	}
+}
+
+func TestSyncHandlerDefaultCertificateValidity(t *testing.T) {
+	tests := []struct {
+		name             string
+		defaults         *CertificateValidityDefaultsConfig
+		expectedExpiries map[string]time.Duration
+	}{
+		{
+			name: "api defaults",
+			expectedExpiries: map[string]time.Duration{
+				"k8s-sample-apiserver/etcd-client-cert": v1beta1.DefaultClientCertificateValidity,
+				"test-storage/test-1-server-cert":       v1beta1.DefaultServingCertificateValidity,
+			},
+		},
+		{
+			name: "configured defaults",
+			defaults: &CertificateValidityDefaultsConfig{
+				Signing: 90 * 24 * time.Hour,
+				Serving: 10 * 24 * time.Hour,
+				Client:  5 * 24 * time.Hour,
+			},
+			expectedExpiries: map[string]time.Duration{
+				"k8s-sample-apiserver/etcd-client-cert": 5 * 24 * time.Hour,
+				"test-storage/test-1-server-cert":       10 * 24 * time.Hour,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es := &v1beta1.EtcdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+				Spec: v1beta1.EtcdStorageSpec{
+					ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+						{
+							Name:      "etcd-client-cert",
+							Namespace: "k8s-sample-apiserver",
+						},
+					},
+				},
+			}
+			config := &EtcdProxyControllerConfig{
+				CoreEtcd: &CoreEtcdConfig{
+					URLs:            []string{"https://test.etcd.svc:2379"},
+					CAConfigMapName: "etcd-coreserving-ca",
+					CertSecretName:  "etcd-coreserving-cert",
+				},
+				ControllerNamespace:         "test-storage",
+				ProxyImage:                  "quay.io/coreos/etcd:v3.2.18",
+				CertificateValidityDefaults: tc.defaults,
+			}
+
+			c := newEtcdProxyControllerMock(config, []runtime.Object{es})
+			if err := c.syncHandler(es.Name); err != nil {
+				t.Fatal(err)
+			}
+
+			for key, validity := range tc.expectedExpiries {
+				namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+				secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expiry, err := time.Parse(time.RFC3339, secret.Annotations[ProxyCertificateExpiryAnnotation])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected := time.Now().Add(validity); expiry.Before(expected.Add(-time.Minute)) || expiry.After(expected.Add(time.Minute)) {
+					t.Fatalf("expected secret '%s' certificate to expire at %v, but got %v", key, expected, expiry)
+				}
+			}
 		})
 	}
 }
 
 func TestSyncHandlerFailure(t *testing.T) {
-	etcdStorage := func(name string) *v1alpha1.EtcdStorage {
-		return &v1alpha1.EtcdStorage{
+	etcdStorage := func(name string) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
 			ObjectMeta: metav1.ObjectMeta{Name: name},
-			Spec: v1alpha1.EtdcStorageSpec{
-				CACertConfigMaps: []v1alpha1.CABundleDestination{
+			Spec: v1beta1.EtcdStorageSpec{
+				CACertConfigMaps: []v1beta1.CABundleDestination{
 					{
 						Name:      "etcd-serving-ca",
 						Namespace: "k8s-sample-apiserver",
 					},
 				},
-				ClientCertSecrets: []v1alpha1.ClientCertificateDestination{
+				ClientCertSecrets: []v1beta1.ClientCertificateDestination{
 					{
 						Name:      "etcd-client-cert",
 						Namespace: "k8s-sample-apiserver",
@@ -250,7 +361,7 @@ func TestSyncHandlerFailure(t *testing.T) {
 
 	tests := []struct {
 		name                string
-		startingEtcdStorage *v1alpha1.EtcdStorage
+		startingEtcdStorage *v1beta1.EtcdStorage
 		startingConfigMap   *v1.ConfigMap
 		startingSecret      *v1.Secret
 		etcdProxyConfig     *EtcdProxyControllerConfig
@@ -327,3 +438,48 @@ func TestSyncHandlerFailure(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncHandlerRestartsEtcdProxy(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "kube-apiserver-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	deployment := newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name,
+		etcdProxyConfig.ProxyImage, etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName,
+		etcdProxyConfig.CoreEtcd.URLs, "stale-hash", nil)
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, deployment})
+	err := c.syncHandler(etcdStorage.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedHash, err := c.proxyCertificatesHash(etcdStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expectedHash == "stale-hash" {
+		t.Fatal("expected certificates hash to change after certificates are generated")
+	}
+
+	d, err := c.kubeclientset.AppsV1().Deployments(etcdProxyConfig.ControllerNamespace).Get(deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := d.Spec.Template.Annotations[ProxyCertificatesHashAnnotation]; hash != expectedHash {
+		t.Fatalf("expected certificates hash '%s' in the pod template, but got '%s'", expectedHash, hash)
+	}
+}
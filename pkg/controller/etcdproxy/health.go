@@ -0,0 +1,165 @@
+package etcdproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/healthz"
+)
+
+const (
+	// coreEtcdHealthCheckPeriod is how often the connectivity to the core etcd is checked.
+	coreEtcdHealthCheckPeriod = 30 * time.Second
+
+	// workerStuckTimeout is how long a worker can sync a single EtcdStorage before it's considered stuck.
+	workerStuckTimeout = 10 * time.Minute
+)
+
+// healthState keeps track of the controller state reported by health checks.
+type healthState struct {
+	lock sync.Mutex
+
+	// running is true once the controller is started. Replicas waiting to become the leader are not running.
+	running bool
+	// activeSyncs contains the start time of EtcdStorage syncs in progress.
+	activeSyncs map[string]time.Time
+	// coreEtcdErr is the result of the last core etcd connectivity check.
+	coreEtcdErr error
+}
+
+func newHealthState() *healthState {
+	return &healthState{
+		activeSyncs: map[string]time.Time{},
+		coreEtcdErr: fmt.Errorf("core etcd connectivity not checked yet"),
+	}
+}
+
+func (h *healthState) setRunning(running bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.running = running
+}
+
+func (h *healthState) syncStarted(key string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.activeSyncs[key] = time.Now()
+}
+
+func (h *healthState) syncFinished(key string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.activeSyncs, key)
+}
+
+func (h *healthState) setCoreEtcdErr(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.coreEtcdErr = err
+}
+
+// coreEtcdStatus returns is the controller running and the result of the last core etcd connectivity check.
+func (h *healthState) coreEtcdStatus() (bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.running, h.coreEtcdErr
+}
+
+// HealthChecks returns liveness checks of the controller. The controller is live as long as none of workers is
+// stuck syncing an EtcdStorage.
+func (c *EtcdProxyController) HealthChecks() []healthz.Check {
+	return []healthz.Check{
+		{Name: "workers", Check: c.checkWorkers},
+	}
+}
+
+// ReadinessChecks returns readiness checks of the controller. The controller is ready once informer caches are
+// synced. Replicas waiting to become the leader are always ready, so they don't block rollouts of the controller
+// Deployment.
+//
+// The core etcd connectivity doesn't gate readiness, as the webhook Service only selects ready pods, and a core etcd
+// outage would make the validating and conversion webhooks unavailable. It's exposed as a metric instead.
+func (c *EtcdProxyController) ReadinessChecks() []healthz.Check {
+	return []healthz.Check{
+		{Name: "informers", Check: c.checkInformersSynced},
+	}
+}
+
+// checkWorkers checks are workers syncing EtcdStorages in time.
+func (c *EtcdProxyController) checkWorkers() error {
+	c.health.lock.Lock()
+	defer c.health.lock.Unlock()
+	if !c.health.running {
+		return nil
+	}
+
+	for key, started := range c.health.activeSyncs {
+		if time.Since(started) > workerStuckTimeout {
+			return fmt.Errorf("worker syncing etcdstorage '%s' for %v", key, time.Since(started).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// checkInformersSynced checks are informer caches synced.
+func (c *EtcdProxyController) checkInformersSynced() error {
+	c.health.lock.Lock()
+	running := c.health.running
+	c.health.lock.Unlock()
+	if !running {
+		return nil
+	}
+
+	informers := []struct {
+		name   string
+		synced cache.InformerSynced
+	}{
+		{"deployments", c.deploymentsSynced},
+		{"services", c.servicesSynced},
+		{"endpoints", c.endpointsSynced},
+		{"configmaps", c.configMapsSynced},
+		{"etcdstorages", c.etcdstoragesSynced},
+	}
+	var errs []error
+	for _, informer := range informers {
+		if !informer.synced() {
+			errs = append(errs, fmt.Errorf("%s informer not synced", informer.name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// updateCoreEtcdHealth checks is the core etcd reachable, by requesting the status of each core etcd member.
+// The core etcd is considered reachable if at least one member responds. The check runs periodically instead of
+// on every probe, as it requires creating a new core etcd client.
+func (c *EtcdProxyController) updateCoreEtcdHealth() {
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		c.health.setCoreEtcdErr(fmt.Errorf("unable to create core etcd client: %v", err))
+		return
+	}
+	defer client.Close()
+
+	var errs []error
+	for _, url := range c.config.CoreEtcd.URLs {
+		ctx, cancel := context.WithTimeout(context.Background(), coreEtcdDialTimeout)
+		_, err := client.Status(ctx, url)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", url, err))
+			continue
+		}
+		c.health.setCoreEtcdErr(nil)
+		return
+	}
+
+	err = fmt.Errorf("core etcd unreachable: %v", utilerrors.NewAggregate(errs))
+	glog.Warning(err)
+	c.health.setCoreEtcdErr(err)
+}
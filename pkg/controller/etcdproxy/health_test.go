@@ -0,0 +1,119 @@
+package etcdproxy
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestHealthChecks(t *testing.T) {
+	synced := func() bool { return true }
+	notSynced := func() bool { return false }
+
+	tests := []struct {
+		name              string
+		running           bool
+		servicesSynced    func() bool
+		activeSync        time.Duration
+		coreEtcdErr       bool
+		expectedHealthy   bool
+		expectedReadiness bool
+	}{
+		{
+			name:              "waiting for leadership",
+			servicesSynced:    notSynced,
+			coreEtcdErr:       true,
+			expectedHealthy:   true,
+			expectedReadiness: true,
+		},
+		{
+			name:              "running",
+			running:           true,
+			servicesSynced:    synced,
+			activeSync:        time.Second,
+			expectedHealthy:   true,
+			expectedReadiness: true,
+		},
+		{
+			name:              "informers not synced",
+			running:           true,
+			servicesSynced:    notSynced,
+			expectedHealthy:   true,
+			expectedReadiness: false,
+		},
+		{
+			name:              "core etcd unreachable",
+			running:           true,
+			servicesSynced:    synced,
+			coreEtcdErr:       true,
+			expectedHealthy:   true,
+			expectedReadiness: true,
+		},
+		{
+			name:              "worker stuck",
+			running:           true,
+			servicesSynced:    synced,
+			activeSync:        workerStuckTimeout + time.Minute,
+			expectedHealthy:   false,
+			expectedReadiness: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newEtcdProxyControllerMock(&EtcdProxyControllerConfig{}, nil)
+			c.deploymentsSynced, c.endpointsSynced, c.configMapsSynced, c.etcdstoragesSynced = synced, synced, synced, synced
+			c.servicesSynced = tc.servicesSynced
+			c.health.setRunning(tc.running)
+			if !tc.coreEtcdErr {
+				c.health.setCoreEtcdErr(nil)
+			}
+			if tc.activeSync != 0 {
+				c.health.activeSyncs["test-1"] = time.Now().Add(-tc.activeSync)
+			}
+
+			for _, check := range c.HealthChecks() {
+				if err := check.Check(); (err == nil) != tc.expectedHealthy {
+					t.Fatalf("expected %s check healthy %t, but got %v", check.Name, tc.expectedHealthy, err)
+				}
+			}
+			ready := true
+			for _, check := range c.ReadinessChecks() {
+				if err := check.Check(); err != nil {
+					ready = false
+				}
+			}
+			if ready != tc.expectedReadiness {
+				t.Fatalf("expected readiness %t, but got %t", tc.expectedReadiness, ready)
+			}
+		})
+	}
+}
+
+func TestUpdateCoreEtcdHealth(t *testing.T) {
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, coreEtcd.Objects)
+	c.health.setRunning(true)
+	c.updateCoreEtcdHealth()
+	if _, err := c.health.coreEtcdStatus(); err != nil {
+		t.Fatalf("expected core etcd to be reachable, but got %v", err)
+	}
+
+	c = newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{})
+	c.health.setRunning(true)
+	c.updateCoreEtcdHealth()
+	if _, err := c.health.coreEtcdStatus(); err == nil {
+		t.Fatal("expected core etcd check to fail without client certificates")
+	}
+}
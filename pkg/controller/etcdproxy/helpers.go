@@ -6,32 +6,37 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 
-	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
 )
 
 // newDeployment creates a new Deployment for a EtcdStorage resource. It also sets
 // the appropriate OwnerReferences on the resource so handleObject can discover
-// the EtcdStorage resource that 'owns' it.
-func newDeployment(etcdstorage *etcdstoragev1alpha1.EtcdStorage,
+// the EtcdStorage resource that 'owns' it. The certificatesHash is stamped into
+// the pod template, so changing certificates triggers a rolling update. The
+// EtcdStorage ProxyTemplate, if provided, is applied to the Deployment.
+func newDeployment(etcdstorage *etcdstoragev1beta1.EtcdStorage,
 	etcdControllerNamespace, etcdProxyNamespace, etcdProxyImage,
-	etcdCoreCAConfigMapName, etcdCoreCertSecretName string, etcdCoreURLs []string) *appsv1.Deployment {
+	etcdCoreCAConfigMapName, etcdCoreCertSecretName string, etcdCoreURLs []string, certificatesHash string,
+	defaultPodTemplate *corev1.PodTemplateSpec) *appsv1.Deployment {
 	labels := map[string]string{
 		"apiserver": etcdstorage.Name,
 	}
 	replicas := int32(3)
 
-	return &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentName(etcdstorage),
 			Namespace: etcdControllerNamespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(etcdstorage, etcdstoragev1alpha1.SchemeGroupVersion.WithKind("EtcdStorage")),
+				*metav1.NewControllerRef(etcdstorage, etcdstoragev1beta1.SchemeGroupVersion.WithKind("EtcdStorage")),
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -42,6 +47,9 @@ func newDeployment(etcdstorage *etcdstoragev1alpha1.EtcdStorage,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						ProxyCertificatesHashAnnotation: certificatesHash,
+					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -149,9 +157,140 @@ func newDeployment(etcdstorage *etcdstoragev1alpha1.EtcdStorage,
 			},
 		},
 	}
+	applyDefaultPodTemplate(deployment, defaultPodTemplate)
+	applyProxyTemplate(deployment, etcdstorage.Spec.ProxyTemplate)
+
+	return deployment
+}
+
+// applyProxyTemplate sets fields from the EtcdStorage ProxyTemplate on the etcd-proxy Deployment. Labels and
+// annotations set by the controller take precedence over additional labels and annotations from the template.
+func applyProxyTemplate(deployment *appsv1.Deployment, template *etcdstoragev1beta1.ProxyTemplate) {
+	if template == nil {
+		return
+	}
+
+	if template.Replicas != nil {
+		replicas := *template.Replicas
+		deployment.Spec.Replicas = &replicas
+	}
+
+	podTemplate := &deployment.Spec.Template
+	for k, v := range template.Labels {
+		if _, ok := podTemplate.Labels[k]; !ok {
+			podTemplate.Labels[k] = v
+		}
+	}
+	for k, v := range template.Annotations {
+		if _, ok := podTemplate.Annotations[k]; !ok {
+			podTemplate.Annotations[k] = v
+		}
+	}
+
+	if len(template.NodeSelector) != 0 {
+		podTemplate.Spec.NodeSelector = template.NodeSelector
+	}
+	if len(template.Tolerations) != 0 {
+		podTemplate.Spec.Tolerations = template.Tolerations
+	}
+	if template.Affinity != nil {
+		podTemplate.Spec.Affinity = template.Affinity
+	}
+	if template.PriorityClassName != "" {
+		podTemplate.Spec.PriorityClassName = template.PriorityClassName
+	}
+	if len(template.Resources.Limits) != 0 || len(template.Resources.Requests) != 0 {
+		podTemplate.Spec.Containers[0].Resources = defaultResourceRequests(template.Resources)
+	}
+}
+
+// applyEtcdCredentials provides the core etcd user credentials stored in the Secret in the controller namespace to
+// the etcd-proxy container. The credentials are mounted in the /etc/coreetcd-credentials directory and exposed
+// through the ETCD_USERNAME and ETCD_PASSWORD environment variables.
+func applyEtcdCredentials(deployment *appsv1.Deployment, credentialsSecretName string) {
+	podSpec := &deployment.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != "etcdproxy" {
+			continue
+		}
+		container := &podSpec.Containers[i]
+		container.Env = append(container.Env,
+			corev1.EnvVar{
+				Name: "ETCD_USERNAME",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecretName},
+						Key:                  EtcdCredentialsUsernameKey,
+					},
+				},
+			},
+			corev1.EnvVar{
+				Name: "ETCD_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecretName},
+						Key:                  EtcdCredentialsPasswordKey,
+					},
+				},
+			},
+		)
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      credentialsSecretName,
+			MountPath: "/etc/coreetcd-credentials",
+			ReadOnly:  true,
+		})
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: credentialsSecretName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: credentialsSecretName,
+			},
+		},
+	})
+}
+
+// defaultResourceRequests returns a copy of the resource requirements with requests defaulted to limits, as done by
+// the API server, so the Deployment doesn't drift from the desired state.
+func defaultResourceRequests(requirements corev1.ResourceRequirements) corev1.ResourceRequirements {
+	resources := *requirements.DeepCopy()
+	for name, limit := range resources.Limits {
+		if _, ok := resources.Requests[name]; !ok {
+			if resources.Requests == nil {
+				resources.Requests = corev1.ResourceList{}
+			}
+			resources.Requests[name] = limit
+		}
+	}
+	return resources
 }
 
-func newService(etcdstorage *etcdstoragev1alpha1.EtcdStorage, etcdControllerNamespace string) *corev1.Service {
+// newPodDisruptionBudget creates a new PodDisruptionBudget for etcd-proxy pods of a EtcdStorage resource. At most
+// one etcd-proxy pod can be unavailable because of voluntary disruptions, such as draining nodes.
+func newPodDisruptionBudget(etcdstorage *etcdstoragev1beta1.EtcdStorage, etcdControllerNamespace string) *policyv1beta1.PodDisruptionBudget {
+	labels := map[string]string{
+		"apiserver": etcdstorage.Name,
+	}
+	maxUnavailable := intstr.FromInt(1)
+
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podDisruptionBudgetName(etcdstorage),
+			Namespace: etcdControllerNamespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(etcdstorage, etcdstoragev1beta1.SchemeGroupVersion.WithKind("EtcdStorage")),
+			},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+func newService(etcdstorage *etcdstoragev1beta1.EtcdStorage, etcdControllerNamespace string) *corev1.Service {
 	labels := map[string]string{
 		"apiserver": etcdstorage.Name,
 	}
@@ -161,7 +300,7 @@ func newService(etcdstorage *etcdstoragev1alpha1.EtcdStorage, etcdControllerName
 			Name:      serviceName(etcdstorage),
 			Namespace: etcdControllerNamespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(etcdstorage, etcdstoragev1alpha1.SchemeGroupVersion.WithKind("EtcdStorage")),
+				*metav1.NewControllerRef(etcdstorage, etcdstoragev1beta1.SchemeGroupVersion.WithKind("EtcdStorage")),
 			},
 		},
 		Spec: corev1.ServiceSpec{
@@ -178,30 +317,128 @@ func newService(etcdstorage *etcdstoragev1alpha1.EtcdStorage, etcdControllerName
 }
 
 // deploymentName calculates name to be used to create a Deployment.
-func deploymentName(etcdstorage *etcdstoragev1alpha1.EtcdStorage) string {
+func deploymentName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
 	return fmt.Sprintf("etcd-%s", etcdstorage.ObjectMeta.Name)
 }
 
 // serviceName calculates name to be used to create a Deployment.
-func serviceName(etcdstorage *etcdstoragev1alpha1.EtcdStorage) string {
+func serviceName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("etcd-%s", etcdstorage.ObjectMeta.Name)
+}
+
+// podDisruptionBudgetName calculates name to be used to create a PodDisruptionBudget.
+func podDisruptionBudgetName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
 	return fmt.Sprintf("etcd-%s", etcdstorage.ObjectMeta.Name)
 }
 
 // etcdProxyCAConfigMapName calculates name to be used to create a etcdproxy CA ConfigMap.
-func etcdProxyCAConfigMapName(etcdstorage *etcdstoragev1alpha1.EtcdStorage) string {
+func etcdProxyCAConfigMapName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
 	return fmt.Sprintf("%s-ca-cert", etcdstorage.Name)
 }
 
 // etcdProxyServerCertsSecret calculates name to be used to create a etcdproxy server certs Secret.
-func etcdProxyServerCertsSecret(etcdstorage *etcdstoragev1alpha1.EtcdStorage) string {
+func etcdProxyServerCertsSecret(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
 	return fmt.Sprintf("%s-server-cert", etcdstorage.Name)
 }
 
+// etcdProxyClientSignerSecretName calculates name to be used to create a Secret in the controller namespace
+// for storing the self-generated Client signing certificate/key pair.
+func etcdProxyClientSignerSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("%s-client-signer", etcdstorage.Name)
+}
+
+// etcdProxyServerSignerSecretName calculates name to be used to create a Secret in the controller namespace
+// for storing the self-generated Server signing certificate/key pair.
+func etcdProxyServerSignerSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("%s-server-signer", etcdstorage.Name)
+}
+
+// etcdDataSnapshotSecretName calculates name to be used to create a Secret with the chunk of the exported
+// core etcd data.
+func etcdDataSnapshotSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage, chunk int) string {
+	return fmt.Sprintf("%s-data-snapshot-%d", etcdstorage.Name, chunk)
+}
+
+// etcdCredentialsSecretName calculates name to be used to create a Secret with the core etcd user credentials.
+func etcdCredentialsSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("%s-etcd-credentials", etcdstorage.Name)
+}
+
+// etcdClientCertSecretName calculates name to be used to create a Secret with the core etcd client certificate
+// issued for the EtcdStorage.
+func etcdClientCertSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("%s-etcd-client-cert", etcdstorage.Name)
+}
+
+// etcdUserName calculates name of the core etcd user used by etcd-proxy pods.
+func etcdUserName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("etcdproxy-%s", etcdstorage.Name)
+}
+
+// etcdRoleName calculates name of the core etcd role granting access to the EtcdStorage prefix.
+func etcdRoleName(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("etcdproxy-%s", etcdstorage.Name)
+}
+
+// etcdPrefix calculates the core etcd prefix under which etcd-proxy stores data for the EtcdStorage.
+func etcdPrefix(etcdstorage *etcdstoragev1beta1.EtcdStorage) string {
+	return fmt.Sprintf("/%s/", etcdstorage.Name)
+}
+
+// keyAlgorithm returns the algorithm used to generate private keys of the EtcdStorage certificates.
+func keyAlgorithm(etcdstorage *etcdstoragev1beta1.EtcdStorage) certs.KeyAlgorithm {
+	return certs.KeyAlgorithm(etcdstorage.Spec.KeyAlgorithm)
+}
+
 // flagfromString returns double dash prefixed flag calculated from provided key and value.
 func flagfromString(key, value string) string {
 	return fmt.Sprintf("--%s=%s", key, value)
 }
 
+// deploymentRolledOut checks are all pods of the etcd-proxy Deployment updated to use certificates
+// with the provided hash and available.
+func deploymentRolledOut(deployment *appsv1.Deployment, certificatesHash string) bool {
+	if deployment.Spec.Template.Annotations[ProxyCertificatesHashAnnotation] != certificatesHash {
+		return false
+	}
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// hasFinalizer checks is the finalizer present in the provided slice of finalizers.
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeControllerAnnotations removes annotations set by the controller on Secrets and ConfigMaps.
+// It returns true if any annotation is removed.
+func removeControllerAnnotations(meta *metav1.ObjectMeta) bool {
+	modified := false
+	for _, annotation := range []string{ProxyCertificateExpiryAnnotation, ProxyCertificateSignedBy, ProxyCertificateSerialNumber,
+		CreatedByControllerAnnotation} {
+		if _, ok := meta.Annotations[annotation]; ok {
+			delete(meta.Annotations, annotation)
+			modified = true
+		}
+	}
+	return modified
+}
+
 // ensureConfigMap ensures provided ConfigMap exists as it is provided. If ConfigMap is not found, it will be created.
 func ensureConfigMap(kubeclientset kubernetes.Interface, required *corev1.ConfigMap) error {
 	existing, err := kubeclientset.CoreV1().ConfigMaps(required.Namespace).Get(required.Name, metav1.GetOptions{})
@@ -3,13 +3,16 @@ package etcdproxy
 import (
 	"testing"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 )
 
 func TestGetDeploymentName(t *testing.T) {
-	es := &v1alpha1.EtcdStorage{
+	es := &v1beta1.EtcdStorage{
 		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
 	}
 
@@ -21,7 +24,7 @@ func TestGetDeploymentName(t *testing.T) {
 }
 
 func TestGetServiceName(t *testing.T) {
-	es := &v1alpha1.EtcdStorage{
+	es := &v1beta1.EtcdStorage{
 		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
 	}
 
@@ -33,7 +36,7 @@ func TestGetServiceName(t *testing.T) {
 }
 
 func TestEtcdProxyCAConfigMapName(t *testing.T) {
-	es := &v1alpha1.EtcdStorage{
+	es := &v1beta1.EtcdStorage{
 		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
 	}
 
@@ -45,7 +48,7 @@ func TestEtcdProxyCAConfigMapName(t *testing.T) {
 }
 
 func TestEtcdProxyServerCertsSecret(t *testing.T) {
-	es := &v1alpha1.EtcdStorage{
+	es := &v1beta1.EtcdStorage{
 		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
 	}
 
@@ -92,3 +95,144 @@ func TestGetFlagFromString(t *testing.T) {
 		})
 	}
 }
+
+func TestDeploymentRolledOut(t *testing.T) {
+	deployment := func(hash string, generation, observedGeneration int64, replicas, updatedReplicas, availableReplicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "etcd-test-1",
+				Generation: generation,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{
+							ProxyCertificatesHashAnnotation: hash,
+						},
+					},
+				},
+			},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: observedGeneration,
+				Replicas:           replicas,
+				UpdatedReplicas:    updatedReplicas,
+				AvailableReplicas:  availableReplicas,
+			},
+		}
+	}
+
+	cases := []struct {
+		name             string
+		deployment       *appsv1.Deployment
+		certificatesHash string
+		expectedResult   bool
+	}{
+		{
+			name:             "all replicas updated and available",
+			deployment:       deployment("hash-1", 2, 2, 3, 3, 3),
+			certificatesHash: "hash-1",
+			expectedResult:   true,
+		},
+		{
+			name:             "pod template contains old hash",
+			deployment:       deployment("hash-1", 2, 2, 3, 3, 3),
+			certificatesHash: "hash-2",
+			expectedResult:   false,
+		},
+		{
+			name:             "new generation not observed yet",
+			deployment:       deployment("hash-1", 3, 2, 3, 3, 3),
+			certificatesHash: "hash-1",
+			expectedResult:   false,
+		},
+		{
+			name:             "rollout in progress",
+			deployment:       deployment("hash-1", 2, 2, 3, 1, 3),
+			certificatesHash: "hash-1",
+			expectedResult:   false,
+		},
+		{
+			name:             "updated replicas not available",
+			deployment:       deployment("hash-1", 2, 2, 3, 3, 2),
+			certificatesHash: "hash-1",
+			expectedResult:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := deploymentRolledOut(tc.deployment, tc.certificatesHash)
+			if res != tc.expectedResult {
+				t.Fatalf("expected %v but got %v instead", tc.expectedResult, res)
+			}
+		})
+	}
+}
+
+func TestNewDeploymentProxyTemplate(t *testing.T) {
+	replicas := int32(1)
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			ProxyTemplate: &v1beta1.ProxyTemplate{
+				Replicas: &replicas,
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("128Mi"),
+					},
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("100m"),
+					},
+				},
+				NodeSelector: map[string]string{"node-role": "storage"},
+				Tolerations: []corev1.Toleration{
+					{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "storage", Effect: corev1.TaintEffectNoSchedule},
+				},
+				Affinity: &corev1.Affinity{
+					PodAntiAffinity: &corev1.PodAntiAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+							{
+								LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"apiserver": "test-1"}},
+								TopologyKey:   "failure-domain.beta.kubernetes.io/zone",
+							},
+						},
+					},
+				},
+				PriorityClassName: "system-cluster-critical",
+				Labels:            map[string]string{"team": "storage", "apiserver": "other"},
+				Annotations:       map[string]string{"example.com/owner": "storage", ProxyCertificatesHashAnnotation: "other"},
+			},
+		},
+	}
+
+	d := newDeployment(es, "test-storage", es.Name, "quay.io/coreos/etcd:v3.2.24", "etcd-coreserving-ca",
+		"etcd-coreserving-cert", []string{"https://test.etcd.svc:2379"}, "hash", nil)
+
+	if *d.Spec.Replicas != replicas {
+		t.Fatalf("expected %d replicas, but got %d", replicas, *d.Spec.Replicas)
+	}
+	podTemplate := d.Spec.Template
+	if podTemplate.Labels["apiserver"] != "test-1" || podTemplate.Labels["team"] != "storage" {
+		t.Fatalf("expected controller labels to take precedence over template labels, but got %v", podTemplate.Labels)
+	}
+	if podTemplate.Annotations[ProxyCertificatesHashAnnotation] != "hash" || podTemplate.Annotations["example.com/owner"] != "storage" {
+		t.Fatalf("expected controller annotations to take precedence over template annotations, but got %v", podTemplate.Annotations)
+	}
+	if podTemplate.Spec.NodeSelector["node-role"] != "storage" || len(podTemplate.Spec.Tolerations) != 1 ||
+		podTemplate.Spec.Affinity == nil || podTemplate.Spec.PriorityClassName != "system-cluster-critical" {
+		t.Fatalf("expected scheduling constraints to be set, but got %+v", podTemplate.Spec)
+	}
+
+	resources := podTemplate.Spec.Containers[0].Resources
+	if cpu := resources.Requests[corev1.ResourceCPU]; cpu.String() != "100m" {
+		t.Fatalf("expected cpu request '100m', but got '%s'", cpu.String())
+	}
+	if memory := resources.Requests[corev1.ResourceMemory]; memory.String() != "128Mi" {
+		t.Fatalf("expected memory request to default to limit '128Mi', but got '%s'", memory.String())
+	}
+	if _, ok := es.Spec.ProxyTemplate.Resources.Requests[corev1.ResourceMemory]; ok {
+		t.Fatal("expected proxy template not to be modified")
+	}
+}
@@ -0,0 +1,171 @@
+package etcdproxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const (
+	// clientCertificate is the type label of the certificate expiry metric for Client certificates.
+	clientCertificate = "client"
+	// serverCertificate is the type label of the certificate expiry metric for Server certificates.
+	serverCertificate = "server"
+	// coreClientCertificate is the type label of the certificate expiry metric for core etcd client certificates.
+	coreClientCertificate = "core-client"
+)
+
+var (
+	syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "etcdproxy",
+		Name:      "sync_duration_seconds",
+		Help:      "How long syncing an EtcdStorage takes.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	syncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcdproxy",
+		Name:      "sync_errors_total",
+		Help:      "Total number of failed EtcdStorage syncs.",
+	})
+
+	etcdstorageConditionDesc = prometheus.NewDesc(
+		"etcdproxy_etcdstorage_condition",
+		"Number of EtcdStorages per condition type and status.",
+		[]string{"condition", "status"}, nil,
+	)
+	certificateExpiryDesc = prometheus.NewDesc(
+		"etcdproxy_certificate_expiry_timestamp_seconds",
+		"Expiry date of certificates managed by the controller, as set in the certificate expiry date annotation.",
+		[]string{"etcdstorage", "type", "namespace", "secret"}, nil,
+	)
+	coreEtcdUpDesc = prometheus.NewDesc(
+		"etcdproxy_core_etcd_up",
+		"Whether the core etcd was reachable in the last connectivity check of the leader.",
+		nil, nil,
+	)
+)
+
+// certificateKey identifies a certificate managed by the controller.
+type certificateKey struct {
+	etcdstorage     string
+	certificateType string
+	namespace       string
+	secret          string
+}
+
+// certificateExpiryTracker keeps track of expiry dates of certificates managed by the controller, so they can be
+// exposed as metrics without reading Secrets on every scrape.
+type certificateExpiryTracker struct {
+	lock   sync.Mutex
+	expiry map[certificateKey]time.Time
+}
+
+// observe records the expiry date from the annotation of the Secret containing a certificate.
+func (t *certificateExpiryTracker) observe(etcdstorage *etcdstoragev1beta1.EtcdStorage, certificateType string, secret *corev1.Secret) {
+	expiry, ok := secret.Annotations[ProxyCertificateExpiryAnnotation]
+	if !ok {
+		return
+	}
+	certExpiry, err := time.Parse(time.RFC3339, expiry)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to parse expiry date of secret %s/%s: %v", secret.Namespace, secret.Name, err))
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.expiry == nil {
+		t.expiry = map[certificateKey]time.Time{}
+	}
+	t.expiry[certificateKey{
+		etcdstorage:     etcdstorage.Name,
+		certificateType: certificateType,
+		namespace:       secret.Namespace,
+		secret:          secret.Name,
+	}] = certExpiry
+}
+
+// forget removes expiry dates of all certificates of the EtcdStorage.
+func (t *certificateExpiryTracker) forget(etcdstorageName string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key := range t.expiry {
+		if key.etcdstorage == etcdstorageName {
+			delete(t.expiry, key)
+		}
+	}
+}
+
+// metricsCollector collects metrics about EtcdStorages and certificates managed by the controller.
+type metricsCollector struct {
+	controller *EtcdProxyController
+}
+
+// Describe implements the prometheus.Collector interface.
+func (m metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- etcdstorageConditionDesc
+	ch <- certificateExpiryDesc
+	ch <- coreEtcdUpDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (m metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	etcdstorages, err := m.controller.etcdstoragesLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to list etcdstorages: %v", err))
+	}
+
+	conditions := map[etcdstoragev1beta1.EtcdStorageConditionType]map[etcdstoragev1beta1.ConditionStatus]int{}
+	for _, etcdstorage := range etcdstorages {
+		for _, condition := range etcdstorage.Status.Conditions {
+			if conditions[condition.Type] == nil {
+				conditions[condition.Type] = map[etcdstoragev1beta1.ConditionStatus]int{
+					etcdstoragev1beta1.ConditionTrue:    0,
+					etcdstoragev1beta1.ConditionFalse:   0,
+					etcdstoragev1beta1.ConditionUnknown: 0,
+				}
+			}
+			conditions[condition.Type][condition.Status]++
+		}
+	}
+	for conditionType, statuses := range conditions {
+		for status, count := range statuses {
+			ch <- prometheus.MustNewConstMetric(etcdstorageConditionDesc, prometheus.GaugeValue, float64(count),
+				string(conditionType), string(status))
+		}
+	}
+
+	// Only the leader checks the core etcd connectivity, so other replicas don't report it.
+	if running, err := m.controller.health.coreEtcdStatus(); running {
+		up := 1.0
+		if err != nil {
+			up = 0
+		}
+		ch <- prometheus.MustNewConstMetric(coreEtcdUpDesc, prometheus.GaugeValue, up)
+	}
+
+	tracker := m.controller.certificateExpiry
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	for key, expiry := range tracker.expiry {
+		ch <- prometheus.MustNewConstMetric(certificateExpiryDesc, prometheus.GaugeValue, float64(expiry.Unix()),
+			key.etcdstorage, key.certificateType, key.namespace, key.secret)
+	}
+}
+
+// RegisterMetrics registers metrics about syncs, EtcdStorages and certificates managed by the controller.
+func (c *EtcdProxyController) RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{syncDuration, syncErrors, metricsCollector{controller: c}} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
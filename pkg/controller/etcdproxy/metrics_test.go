@@ -0,0 +1,83 @@
+package etcdproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	etcdStorage := func(name string, deployed v1beta1.ConditionStatus) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1beta1.EtcdStorageStatus{
+				Conditions: []v1beta1.EtcdStorageCondition{
+					{Type: v1beta1.Deployed, Status: deployed},
+				},
+			},
+		}
+	}
+	expiry := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-client-cert",
+			Namespace: "k8s-sample-apiserver",
+			Annotations: map[string]string{
+				ProxyCertificateExpiryAnnotation: expiry.Format(time.RFC3339),
+			},
+		},
+	}
+
+	c := newEtcdProxyControllerMock(&EtcdProxyControllerConfig{}, []runtime.Object{
+		etcdStorage("test-1", v1beta1.ConditionTrue),
+		etcdStorage("test-2", v1beta1.ConditionTrue),
+		etcdStorage("test-3", v1beta1.ConditionFalse),
+	})
+	c.certificateExpiry.observe(etcdStorage("test-1", v1beta1.ConditionTrue), clientCertificate, secret)
+	c.certificateExpiry.observe(etcdStorage("test-2", v1beta1.ConditionTrue), clientCertificate, secret)
+	c.certificateExpiry.forget("test-2")
+	c.health.setRunning(true)
+	c.health.setCoreEtcdErr(nil)
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metricsCollector{controller: c}); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "," + label.GetName() + "=" + label.GetValue()
+			}
+			values[name] = metric.GetGauge().GetValue()
+		}
+	}
+
+	expected := map[string]float64{
+		"etcdproxy_etcdstorage_condition,condition=Deployed,status=True":                                                                       2,
+		"etcdproxy_etcdstorage_condition,condition=Deployed,status=False":                                                                      1,
+		"etcdproxy_etcdstorage_condition,condition=Deployed,status=Unknown":                                                                    0,
+		"etcdproxy_certificate_expiry_timestamp_seconds,etcdstorage=test-1,namespace=k8s-sample-apiserver,secret=etcd-client-cert,type=client": float64(expiry.Unix()),
+		"etcdproxy_core_etcd_up": 1,
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("expected metrics %v, but got %v", expected, values)
+	}
+	for name, value := range expected {
+		if got, ok := values[name]; !ok || got != value {
+			t.Fatalf("expected metric '%s' to be %v, but got %v", name, value, values)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package etcdproxy
+
+import (
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ensurePodDisruptionBudget ensures the required PodDisruptionBudget for etcd-proxy pods exists. The spec of
+// a PodDisruptionBudget can't be updated, so the PodDisruptionBudget is recreated if its spec has drifted.
+func (c *EtcdProxyController) ensurePodDisruptionBudget(required *policyv1beta1.PodDisruptionBudget) error {
+	existing, err := c.kubeclientset.PolicyV1beta1().PodDisruptionBudgets(required.Namespace).Get(required.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = c.kubeclientset.PolicyV1beta1().PodDisruptionBudgets(required.Namespace).Create(required)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec.Selector, required.Spec.Selector) &&
+		equality.Semantic.DeepEqual(existing.Spec.MaxUnavailable, required.Spec.MaxUnavailable) &&
+		existing.Spec.MinAvailable == nil {
+		return nil
+	}
+
+	err = c.kubeclientset.PolicyV1beta1().PodDisruptionBudgets(existing.Namespace).Delete(existing.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = c.kubeclientset.PolicyV1beta1().PodDisruptionBudgets(required.Namespace).Create(required)
+	return err
+}
@@ -0,0 +1,219 @@
+package etcdproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ProxyPodTemplateFailure is used as part of the Event reason when the default etcd-proxy pod template
+	// can't be loaded.
+	ProxyPodTemplateFailure = "ProxyPodTemplateFailure"
+
+	// ProxyPodTemplateKey is the key in the default etcd-proxy pod template ConfigMap where the pod template is stored.
+	ProxyPodTemplateKey = "template.yaml"
+
+	// ProxyPodTemplateHashAnnotation is the hash of the default etcd-proxy pod template the etcd-proxy Deployment is
+	// created from. When the default pod template changes, the pod template of the Deployment is replaced.
+	ProxyPodTemplateHashAnnotation = "etcd.xmudrii.com/proxy-pod-template-hash"
+)
+
+// proxyPodTemplateCache keeps the last default etcd-proxy pod template loaded successfully, so it can be used while
+// the default pod template ConfigMap can't be loaded.
+type proxyPodTemplateCache struct {
+	lock     sync.Mutex
+	template *corev1.PodTemplateSpec
+}
+
+// get returns the last default pod template loaded successfully, or nil if no pod template has been loaded.
+func (p *proxyPodTemplateCache) get() *corev1.PodTemplateSpec {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.template
+}
+
+// set records the default pod template loaded successfully.
+func (p *proxyPodTemplateCache) set(template *corev1.PodTemplateSpec) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.template = template
+}
+
+// defaultProxyPodTemplate returns the default etcd-proxy pod template from the ConfigMap in the controller namespace.
+// If the ConfigMap is not configured, nil is returned. If the ConfigMap can't be loaded, because it doesn't exist or
+// doesn't contain a valid pod template, the last pod template loaded successfully, or nil if there is none, is
+// returned along with the error, so a broken ConfigMap doesn't prevent EtcdStorages from being reconciled.
+func (c *EtcdProxyController) defaultProxyPodTemplate() (*corev1.PodTemplateSpec, error) {
+	if c.config.ProxyPodTemplateConfigMapName == "" {
+		return nil, nil
+	}
+
+	template, err := c.loadProxyPodTemplate()
+	if err != nil {
+		return c.proxyPodTemplate.get(), err
+	}
+	c.proxyPodTemplate.set(template)
+
+	return template, nil
+}
+
+// loadProxyPodTemplate reads the default etcd-proxy pod template from the ConfigMap in the controller namespace.
+func (c *EtcdProxyController) loadProxyPodTemplate() (*corev1.PodTemplateSpec, error) {
+
+	configMap, err := c.configMapsLister.ConfigMaps(c.config.ControllerNamespace).Get(c.config.ProxyPodTemplateConfigMapName)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := configMap.Data[ProxyPodTemplateKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s doesn't contain the %s key", configMap.Name, ProxyPodTemplateKey)
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := yaml.Unmarshal([]byte(data), template); err != nil {
+		return nil, fmt.Errorf("unable to parse pod template from configmap %s: %v", configMap.Name, err)
+	}
+
+	hash := sha256.Sum256([]byte(data))
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[ProxyPodTemplateHashAnnotation] = hex.EncodeToString(hash[:])
+
+	return template, nil
+}
+
+// applyDefaultPodTemplate layers the pod template of the etcd-proxy Deployment on top of the default pod template.
+// Fields set by the controller take precedence over the default pod template, while other fields, such as
+// environment variables, security contexts or additional containers and volumes, are taken from it.
+func applyDefaultPodTemplate(deployment *appsv1.Deployment, defaults *corev1.PodTemplateSpec) {
+	if defaults == nil {
+		return
+	}
+
+	generated := deployment.Spec.Template
+	podTemplate := defaults.DeepCopy()
+
+	podTemplate.Labels = layerStringMap(podTemplate.Labels, generated.Labels)
+	podTemplate.Annotations = layerStringMap(podTemplate.Annotations, generated.Annotations)
+
+	containers := []corev1.Container{}
+	for _, container := range generated.Spec.Containers {
+		for _, defaultContainer := range podTemplate.Spec.Containers {
+			if defaultContainer.Name == container.Name {
+				container = layerContainer(defaultContainer, container)
+			}
+		}
+		containers = append(containers, container)
+	}
+	for _, defaultContainer := range podTemplate.Spec.Containers {
+		if !hasContainer(generated.Spec.Containers, defaultContainer.Name) {
+			containers = append(containers, defaultContainer)
+		}
+	}
+	podTemplate.Spec.Containers = containers
+
+	volumes := append([]corev1.Volume{}, generated.Spec.Volumes...)
+	for _, defaultVolume := range podTemplate.Spec.Volumes {
+		if !hasVolume(generated.Spec.Volumes, defaultVolume.Name) {
+			volumes = append(volumes, defaultVolume)
+		}
+	}
+	podTemplate.Spec.Volumes = volumes
+
+	deployment.Spec.Template = *podTemplate
+}
+
+// layerContainer sets fields of the container generated by the controller on top of the default container.
+func layerContainer(defaultContainer, generated corev1.Container) corev1.Container {
+	container := *defaultContainer.DeepCopy()
+	container.Name = generated.Name
+	container.Image = generated.Image
+	container.Command = generated.Command
+	container.Args = generated.Args
+	container.Ports = generated.Ports
+	container.LivenessProbe = generated.LivenessProbe
+	container.Resources = defaultResourceRequests(container.Resources)
+
+	volumeMounts := append([]corev1.VolumeMount{}, generated.VolumeMounts...)
+	for _, defaultMount := range defaultContainer.VolumeMounts {
+		conflicting := false
+		for _, mount := range generated.VolumeMounts {
+			if mount.Name == defaultMount.Name || mount.MountPath == defaultMount.MountPath {
+				conflicting = true
+			}
+		}
+		if !conflicting {
+			volumeMounts = append(volumeMounts, defaultMount)
+		}
+	}
+	container.VolumeMounts = volumeMounts
+
+	return container
+}
+
+// layerStringMap returns a map containing entries from both maps. Entries from the top map take precedence.
+func layerStringMap(bottom, top map[string]string) map[string]string {
+	layered := map[string]string{}
+	for k, v := range bottom {
+		layered[k] = v
+	}
+	for k, v := range top {
+		layered[k] = v
+	}
+	return layered
+}
+
+// hasContainer checks is the container with the provided name present in the slice of containers.
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVolume checks is the volume with the provided name present in the slice of volumes.
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleProxyPodTemplate enqueues all EtcdStorage resources when the default etcd-proxy pod template ConfigMap
+// changes, so etcd-proxy Deployments are updated to use the new default pod template.
+func (c *EtcdProxyController) handleProxyPodTemplate(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("error decoding configmap, invalid type"))
+		return
+	}
+	if c.config.ProxyPodTemplateConfigMapName == "" || configMap.Name != c.config.ProxyPodTemplateConfigMapName {
+		return
+	}
+
+	etcdstorages, err := c.etcdstoragesLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to list etcdstorages: %v", err))
+		return
+	}
+	for _, etcdstorage := range etcdstorages {
+		c.enqueueEtcdStorage(etcdstorage)
+	}
+}
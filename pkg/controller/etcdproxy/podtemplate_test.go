@@ -0,0 +1,297 @@
+package etcdproxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const testProxyPodTemplate = `
+metadata:
+  labels:
+    team: storage
+    apiserver: overridden
+spec:
+  priorityClassName: system-cluster-critical
+  containers:
+  - name: etcdproxy
+    image: overridden
+    env:
+    - name: GOMAXPROCS
+      value: "2"
+    resources:
+      limits:
+        memory: 256Mi
+    volumeMounts:
+    - name: tmp
+      mountPath: /tmp
+  - name: sidecar
+    image: busybox
+  volumes:
+  - name: tmp
+    emptyDir: {}
+`
+
+func newTestProxyPodTemplateConfigMap(template string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-proxy-pod-template",
+			Namespace: "kube-apiserver-storage",
+		},
+		Data: map[string]string{
+			ProxyPodTemplateKey: template,
+		},
+	}
+}
+
+func TestDefaultProxyPodTemplate(t *testing.T) {
+	tests := []struct {
+		name          string
+		configMapName string
+		configMap     *v1.ConfigMap
+		expectedNil   bool
+		expectedErr   bool
+	}{
+		{
+			name:        "default pod template not configured",
+			expectedNil: true,
+		},
+		{
+			name:          "configmap not found",
+			configMapName: "etcd-proxy-pod-template",
+			expectedErr:   true,
+		},
+		{
+			name:          "invalid pod template",
+			configMapName: "etcd-proxy-pod-template",
+			configMap:     newTestProxyPodTemplateConfigMap("spec: [invalid"),
+			expectedErr:   true,
+		},
+		{
+			name:          "valid pod template",
+			configMapName: "etcd-proxy-pod-template",
+			configMap:     newTestProxyPodTemplateConfigMap(testProxyPodTemplate),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &EtcdProxyControllerConfig{
+				ControllerNamespace:           "kube-apiserver-storage",
+				ProxyPodTemplateConfigMapName: tc.configMapName,
+			}
+			var objs []runtime.Object
+			if tc.configMap != nil {
+				objs = append(objs, tc.configMap)
+			}
+			c := newEtcdProxyControllerMock(config, objs)
+
+			template, err := c.defaultProxyPodTemplate()
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, but got %v", tc.expectedErr, err)
+			}
+			if tc.expectedErr {
+				return
+			}
+			if (template == nil) != tc.expectedNil {
+				t.Fatalf("expected nil pod template %t, but got %+v", tc.expectedNil, template)
+			}
+			if template != nil && template.Annotations[ProxyPodTemplateHashAnnotation] == "" {
+				t.Fatal("expected pod template hash annotation to be set")
+			}
+		})
+	}
+}
+
+func TestNewDeploymentDefaultPodTemplate(t *testing.T) {
+	config := &EtcdProxyControllerConfig{
+		ControllerNamespace:           "kube-apiserver-storage",
+		ProxyPodTemplateConfigMapName: "etcd-proxy-pod-template",
+	}
+	c := newEtcdProxyControllerMock(config, []runtime.Object{newTestProxyPodTemplateConfigMap(testProxyPodTemplate)})
+	defaultPodTemplate, err := c.defaultProxyPodTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			ProxyTemplate: &v1beta1.ProxyTemplate{
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				},
+			},
+		},
+	}
+	d := newDeployment(es, "kube-apiserver-storage", es.Name, "quay.io/coreos/etcd:v3.2.24", "etcd-coreserving-ca",
+		"etcd-coreserving-cert", []string{"https://test.etcd.svc:2379"}, "hash", defaultPodTemplate)
+	podTemplate := d.Spec.Template
+
+	if podTemplate.Labels["team"] != "storage" || podTemplate.Labels["apiserver"] != es.Name {
+		t.Fatalf("expected default labels to be layered under controller labels, but got %v", podTemplate.Labels)
+	}
+	if podTemplate.Annotations[ProxyPodTemplateHashAnnotation] == "" || podTemplate.Annotations[ProxyCertificatesHashAnnotation] != "hash" {
+		t.Fatalf("expected pod template and certificates hash annotations, but got %v", podTemplate.Annotations)
+	}
+	if podTemplate.Spec.PriorityClassName != "system-cluster-critical" {
+		t.Fatalf("expected priority class from the default pod template, but got '%s'", podTemplate.Spec.PriorityClassName)
+	}
+	if len(podTemplate.Spec.Containers) != 2 || podTemplate.Spec.Containers[1].Name != "sidecar" {
+		t.Fatalf("expected etcdproxy and sidecar containers, but got %+v", podTemplate.Spec.Containers)
+	}
+
+	container := podTemplate.Spec.Containers[0]
+	if container.Image != "quay.io/coreos/etcd:v3.2.24" {
+		t.Fatalf("expected generated image to take precedence, but got '%s'", container.Image)
+	}
+	if len(container.Env) != 1 || container.Env[0].Name != "GOMAXPROCS" {
+		t.Fatalf("expected environment from the default pod template, but got %+v", container.Env)
+	}
+	if _, ok := container.Resources.Limits[v1.ResourceMemory]; ok {
+		t.Fatalf("expected ProxyTemplate resources to take precedence, but got %+v", container.Resources)
+	}
+	if container.VolumeMounts[len(container.VolumeMounts)-1].Name != "tmp" || !hasVolume(podTemplate.Spec.Volumes, "tmp") {
+		t.Fatal("expected volume and volume mount from the default pod template")
+	}
+}
+
+func TestSyncHandlerDefaultPodTemplate(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace:           "kube-apiserver-storage",
+		ProxyImage:                    "quay.io/coreos/etcd:v3.2.24",
+		ProxyPodTemplateConfigMapName: "etcd-proxy-pod-template",
+	}
+	// The Deployment was created before the default pod template was configured.
+	deployment := newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name,
+		etcdProxyConfig.ProxyImage, etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName,
+		etcdProxyConfig.CoreEtcd.URLs, "", nil)
+	configMap := newTestProxyPodTemplateConfigMap(testProxyPodTemplate)
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, deployment, configMap})
+	if err := c.syncHandler(etcdStorage.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.kubeclientset.AppsV1().Deployments(etcdProxyConfig.ControllerNamespace).Get(deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Spec.Template.Annotations[ProxyPodTemplateHashAnnotation] == "" {
+		t.Fatal("expected deployment to be updated with the default pod template")
+	}
+	if !hasContainer(d.Spec.Template.Spec.Containers, "sidecar") {
+		t.Fatalf("expected sidecar container from the default pod template, but got %+v", d.Spec.Template.Spec.Containers)
+	}
+
+	required := d.DeepCopy()
+	if _, drifted := mergeDeployment(d, required); len(drifted) != 0 {
+		t.Fatalf("expected deployment not to drift, but got '%v'", drifted)
+	}
+	required.Spec.Template.Annotations[ProxyPodTemplateHashAnnotation] = "new-hash"
+	required.Spec.Template.Spec.Containers = required.Spec.Template.Spec.Containers[:1]
+	merged, drifted := mergeDeployment(d, required)
+	if strings.Join(drifted, ", ") != "default pod template" {
+		t.Fatalf("expected default pod template to drift, but got '%v'", drifted)
+	}
+	if hasContainer(merged.Spec.Template.Spec.Containers, "sidecar") {
+		t.Fatal("expected pod template to be replaced")
+	}
+}
+
+func TestDefaultProxyPodTemplateFallback(t *testing.T) {
+	config := &EtcdProxyControllerConfig{
+		ControllerNamespace:           "kube-apiserver-storage",
+		ProxyPodTemplateConfigMapName: "etcd-proxy-pod-template",
+	}
+	c := newEtcdProxyControllerMock(config, []runtime.Object{newTestProxyPodTemplateConfigMap(testProxyPodTemplate)})
+
+	loaded, err := c.defaultProxyPodTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last pod template loaded successfully is used once the ConfigMap is removed.
+	c.configMapsLister = corelisters.NewConfigMapLister(cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{}))
+	template, err := c.defaultProxyPodTemplate()
+	if err == nil {
+		t.Fatal("expected error loading the removed default pod template")
+	}
+	if !equality.Semantic.DeepEqual(template, loaded) {
+		t.Fatalf("expected the last loaded pod template, but got %+v", template)
+	}
+}
+
+func TestSyncHandlerMissingProxyPodTemplate(t *testing.T) {
+	etcdStorage := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-1"},
+		Spec: v1beta1.EtcdStorageSpec{
+			SigningCertificateValidity: metav1.Duration{Duration: time.Hour * 24 * 60},
+			ServingCertificateValidity: metav1.Duration{Duration: time.Hour * 24 * 60},
+			ClientCertificateValidity:  metav1.Duration{Duration: time.Hour * 24 * 60},
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace:           "kube-apiserver-storage",
+		ProxyImage:                    "quay.io/coreos/etcd:v3.2.24",
+		ProxyPodTemplateConfigMapName: "etcd-proxy-pod-template",
+	}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	recorder := record.NewFakeRecorder(100)
+	c.recorder = recorder
+	if err := c.syncHandler(etcdStorage.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	// The EtcdStorage is reconciled without the default pod template.
+	d, err := c.kubeclientset.AppsV1().Deployments(etcdProxyConfig.ControllerNamespace).Get(deploymentName(etcdStorage), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Spec.Template.Annotations[ProxyPodTemplateHashAnnotation]; ok {
+		t.Fatal("expected deployment not to use a default pod template")
+	}
+	if _, err := c.kubeclientset.CoreV1().Services(etcdProxyConfig.ControllerNamespace).Get(serviceName(etcdStorage), metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected service to be created: %v", err)
+	}
+
+	found := false
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, ProxyPodTemplateFailure) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected %s warning event", ProxyPodTemplateFailure)
+	}
+}
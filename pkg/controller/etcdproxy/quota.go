@@ -0,0 +1,218 @@
+package etcdproxy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const (
+	// QuotaExceededEvent is used as part of the Event reason when the data stored in the core etcd exceeds
+	// the EtcdStorage quota.
+	QuotaExceededEvent = "QuotaExceeded"
+
+	// EtcdProxyScaledDown is used as part of the Event reason when the etcd-proxy Deployment is scaled to zero
+	// replicas because the EtcdStorage quota is exceeded.
+	EtcdProxyScaledDown = "EtcdProxyScaledDown"
+
+	// EtcdProxyScaledUp is used as part of the Event reason when the etcd-proxy Deployment is scaled back up
+	// after the EtcdStorage quota is not exceeded anymore.
+	EtcdProxyScaledUp = "EtcdProxyScaledUp"
+
+	// QuotaScaledDownReplicasAnnotation is the number of etcd-proxy Deployment replicas before the Deployment is
+	// scaled down because the EtcdStorage quota is exceeded.
+	QuotaScaledDownReplicasAnnotation = "etcd.xmudrii.com/quota-scaled-down-replicas"
+
+	// usageMeasurementPageSize is the maximum number of keys fetched from the core etcd in a single request
+	// while measuring the usage.
+	usageMeasurementPageSize = 1000
+)
+
+// measureUsage measures the usage of the core etcd for all EtcdStorages, and updates their status and
+// the QuotaExceeded condition.
+func (c *EtcdProxyController) measureUsage() {
+	etcdstorages, err := c.etcdstoragesLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to list etcdstorages: %v", err))
+		return
+	}
+	if len(etcdstorages) == 0 {
+		return
+	}
+
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to connect to the core etcd: %v", err))
+		return
+	}
+	defer client.Close()
+
+	for _, etcdstorage := range etcdstorages {
+		if !etcdstorage.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := c.updateUsage(client, etcdstorage); err != nil {
+			runtime.HandleError(fmt.Errorf("unable to measure usage of etcdstorage '%s': %v", etcdstorage.Name, err))
+		}
+	}
+}
+
+// updateUsage measures the usage of the core etcd under the EtcdStorage prefix and updates the EtcdStorage status.
+// A Warning Event is recorded when the EtcdStorage quota gets exceeded.
+func (c *EtcdProxyController) updateUsage(client *clientv3.Client, etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	usage, err := measureEtcdPrefix(client, etcdPrefix(etcdstorage))
+	if err != nil {
+		return err
+	}
+
+	etcdstorageCopy := etcdstorage.DeepCopy()
+	etcdstorageCopy.Status.Usage = usage
+	condition := quotaCondition(etcdstorage.Spec.Quota, usage)
+	// The QuotaExceeded condition is set only for EtcdStorages with a quota, or reset if the quota is removed.
+	if etcdstorage.Spec.Quota != nil ||
+		etcdstoragev1beta1.FindEtcdStorageCondition(etcdstorage, etcdstoragev1beta1.QuotaExceeded) != nil {
+		etcdstoragev1beta1.SetEtcdStorageCondition(etcdstorageCopy, condition)
+	}
+
+	if _, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().UpdateStatus(etcdstorageCopy); err != nil {
+		return err
+	}
+
+	if condition.Status == etcdstoragev1beta1.ConditionTrue &&
+		!etcdstoragev1beta1.IsEtcdStorageConditionTrue(etcdstorage, etcdstoragev1beta1.QuotaExceeded) {
+		c.recorder.Event(etcdstorage, corev1.EventTypeWarning, QuotaExceededEvent,
+			fmt.Sprintf("EtcdStorage %s exceeded its quota: %s", etcdstorage.Name, condition.Message))
+	}
+
+	return nil
+}
+
+// measureEtcdPrefix counts keys stored in the core etcd under the provided prefix, along with the approximate
+// size of keys and values. Keys are fetched in pages at the same revision, so the result is consistent.
+func measureEtcdPrefix(client *clientv3.Client, prefix string) (*etcdstoragev1beta1.StorageUsage, error) {
+	usage := &etcdstoragev1beta1.StorageUsage{
+		LastMeasuredTime: metav1.Now(),
+	}
+	key, end := prefix, clientv3.GetPrefixRangeEnd(prefix)
+	var revision int64
+
+	for {
+		opts := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithLimit(usageMeasurementPageSize)}
+		if revision != 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+		resp, err := client.Get(ctx, key, opts...)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		revision = resp.Header.Revision
+
+		for _, kv := range resp.Kvs {
+			usage.Keys++
+			usage.Bytes += int64(len(kv.Key) + len(kv.Value))
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return usage, nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// quotaCondition calculates the QuotaExceeded condition for the provided quota and usage.
+func quotaCondition(quota *etcdstoragev1beta1.StorageQuota, usage *etcdstoragev1beta1.StorageUsage) etcdstoragev1beta1.EtcdStorageCondition {
+	condition := etcdstoragev1beta1.EtcdStorageCondition{
+		Type:               etcdstoragev1beta1.QuotaExceeded,
+		Status:             etcdstoragev1beta1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "WithinQuota",
+		Message:            "usage is within the quota",
+	}
+	if quota == nil {
+		condition.Reason = "QuotaNotSet"
+		condition.Message = "quota is not set"
+		return condition
+	}
+
+	var exceeded []string
+	if quota.MaxKeys != nil && usage.Keys > *quota.MaxKeys {
+		exceeded = append(exceeded, fmt.Sprintf("%d keys stored, quota is %d keys", usage.Keys, *quota.MaxKeys))
+	}
+	if quota.MaxBytes != nil && usage.Bytes > quota.MaxBytes.Value() {
+		exceeded = append(exceeded, fmt.Sprintf("%d bytes stored, quota is %s", usage.Bytes, quota.MaxBytes.String()))
+	}
+	if len(exceeded) != 0 {
+		condition.Status = etcdstoragev1beta1.ConditionTrue
+		condition.Reason = "QuotaExceeded"
+		condition.Message = strings.Join(exceeded, ", ")
+	}
+
+	return condition
+}
+
+// quotaScaleDownRequired checks should the etcd-proxy Deployment be scaled to zero replicas, which is the case
+// when the quota is exceeded and the ScaleDown enforcement is used.
+func quotaScaleDownRequired(etcdstorage *etcdstoragev1beta1.EtcdStorage) bool {
+	return etcdstorage.Spec.Quota != nil &&
+		etcdstorage.Spec.Quota.Enforcement == etcdstoragev1beta1.QuotaEnforcementScaleDown &&
+		etcdstoragev1beta1.IsEtcdStorageConditionTrue(etcdstorage, etcdstoragev1beta1.QuotaExceeded)
+}
+
+// enforceQuota scales the etcd-proxy Deployment to zero replicas if required by the EtcdStorage quota. The number
+// of replicas is stored in an annotation, so the Deployment can be scaled back up once the quota is not exceeded.
+func (c *EtcdProxyController) enforceQuota(etcdstorage *etcdstoragev1beta1.EtcdStorage, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	scaledReplicas, scaledDown := deployment.Annotations[QuotaScaledDownReplicasAnnotation]
+	if quotaScaleDownRequired(etcdstorage) == scaledDown {
+		return deployment, nil
+	}
+
+	deploymentCopy := deployment.DeepCopy()
+	if !scaledDown {
+		replicas := int32(1)
+		if deploymentCopy.Spec.Replicas != nil {
+			replicas = *deploymentCopy.Spec.Replicas
+		}
+		if deploymentCopy.Annotations == nil {
+			deploymentCopy.Annotations = map[string]string{}
+		}
+		deploymentCopy.Annotations[QuotaScaledDownReplicasAnnotation] = strconv.Itoa(int(replicas))
+		replicas = 0
+		deploymentCopy.Spec.Replicas = &replicas
+	} else {
+		replicas, err := strconv.ParseInt(scaledReplicas, 10, 32)
+		if err != nil {
+			return deployment, fmt.Errorf("invalid number of replicas in annotation %s of deployment %s: %v",
+				QuotaScaledDownReplicasAnnotation, deployment.Name, err)
+		}
+		delete(deploymentCopy.Annotations, QuotaScaledDownReplicasAnnotation)
+		restored := int32(replicas)
+		deploymentCopy.Spec.Replicas = &restored
+	}
+
+	updated, err := c.kubeclientset.AppsV1().Deployments(deploymentCopy.Namespace).Update(deploymentCopy)
+	if err != nil {
+		return deployment, err
+	}
+
+	if !scaledDown {
+		c.recorder.Event(etcdstorage, corev1.EventTypeWarning, EtcdProxyScaledDown,
+			fmt.Sprintf("Scaled etcd-proxy Deployment %s to zero replicas because EtcdStorage quota is exceeded", deployment.Name))
+	} else {
+		c.recorder.Event(etcdstorage, corev1.EventTypeNormal, EtcdProxyScaledUp,
+			fmt.Sprintf("Scaled etcd-proxy Deployment %s back up because EtcdStorage quota is not exceeded", deployment.Name))
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,278 @@
+package etcdproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestMeasureUsage(t *testing.T) {
+	maxKeys := int64(2)
+	maxBytes := resource.MustParse("1Ki")
+	etcdStorage := func(name string, quota *v1beta1.StorageQuota) *v1beta1.EtcdStorage {
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: v1beta1.EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+				Quota:                      quota,
+			},
+		}
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	tests := []struct {
+		name                string
+		startingEtcdStorage *v1beta1.EtcdStorage
+		keys                int
+		valueSize           int
+		expectedCondition   v1beta1.ConditionStatus
+		expectedEvent       bool
+	}{
+		{
+			name:                "usage without quota",
+			startingEtcdStorage: etcdStorage("test-1", nil),
+			keys:                3,
+			valueSize:           10,
+		},
+		{
+			name: "quota removed",
+			startingEtcdStorage: func() *v1beta1.EtcdStorage {
+				es := etcdStorage("test-6", nil)
+				es.Status.Conditions = []v1beta1.EtcdStorageCondition{{Type: v1beta1.QuotaExceeded, Status: v1beta1.ConditionTrue}}
+				return es
+			}(),
+			keys:              3,
+			valueSize:         10,
+			expectedCondition: v1beta1.ConditionFalse,
+		},
+		{
+			name:                "usage within quota",
+			startingEtcdStorage: etcdStorage("test-2", &v1beta1.StorageQuota{MaxKeys: &maxKeys, MaxBytes: &maxBytes}),
+			keys:                2,
+			valueSize:           10,
+			expectedCondition:   v1beta1.ConditionFalse,
+		},
+		{
+			name:                "keys quota exceeded",
+			startingEtcdStorage: etcdStorage("test-3", &v1beta1.StorageQuota{MaxKeys: &maxKeys}),
+			keys:                3,
+			valueSize:           10,
+			expectedCondition:   v1beta1.ConditionTrue,
+			expectedEvent:       true,
+		},
+		{
+			name:                "bytes quota exceeded",
+			startingEtcdStorage: etcdStorage("test-4", &v1beta1.StorageQuota{MaxBytes: &maxBytes}),
+			keys:                1,
+			valueSize:           2048,
+			expectedCondition:   v1beta1.ConditionTrue,
+			expectedEvent:       true,
+		},
+		{
+			name:                "measured in multiple pages",
+			startingEtcdStorage: etcdStorage("test-5", &v1beta1.StorageQuota{MaxBytes: &maxBytes}),
+			keys:                usageMeasurementPageSize + 5,
+			expectedCondition:   v1beta1.ConditionTrue,
+			expectedEvent:       true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es := tc.startingEtcdStorage
+			c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es}, coreEtcd.Objects...))
+			recorder := record.NewFakeRecorder(10)
+			c.recorder = recorder
+
+			client, err := c.newCoreEtcdClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+			defer cancel()
+			value := strings.Repeat("x", tc.valueSize)
+			expectedUsage := v1beta1.StorageUsage{}
+			for i := 0; i < tc.keys; i++ {
+				key := fmt.Sprintf("%skey-%05d", etcdPrefix(es), i)
+				if _, err := client.Put(ctx, key, value); err != nil {
+					t.Fatal(err)
+				}
+				expectedUsage.Keys++
+				expectedUsage.Bytes += int64(len(key) + len(value))
+			}
+			// Keys of another EtcdStorage, whose name has the same prefix, must not be measured.
+			if _, err := client.Put(ctx, "/"+es.Name+"-other/foo", value); err != nil {
+				t.Fatal(err)
+			}
+
+			c.measureUsage()
+
+			updated, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			usage := updated.Status.Usage
+			if usage == nil || usage.Keys != expectedUsage.Keys || usage.Bytes != expectedUsage.Bytes {
+				t.Fatalf("expected usage %+v, but got %+v", expectedUsage, usage)
+			}
+			if usage.LastMeasuredTime.IsZero() {
+				t.Fatal("expected last measured time to be set")
+			}
+			if tc.expectedCondition == "" {
+				if cond := v1beta1.FindEtcdStorageCondition(updated, v1beta1.QuotaExceeded); cond != nil {
+					t.Fatalf("expected condition '%s' not to be set, but got %+v", v1beta1.QuotaExceeded, cond)
+				}
+			} else if !v1beta1.IsEtcdStorageConditionPresentAndEqual(updated, v1beta1.QuotaExceeded, tc.expectedCondition) {
+				t.Fatalf("expected condition '%s' to be '%s', but got %+v", v1beta1.QuotaExceeded, tc.expectedCondition, updated.Status.Conditions)
+			}
+			if tc.expectedEvent != (len(recorder.Events) != 0) {
+				t.Fatalf("expected quota exceeded event: %t, but got %d events", tc.expectedEvent, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestEnforceQuota(t *testing.T) {
+	etcdStorage := func(enforcement v1beta1.QuotaEnforcement, exceeded v1beta1.ConditionStatus) *v1beta1.EtcdStorage {
+		maxKeys := int64(10)
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-1",
+			},
+			Spec: v1beta1.EtcdStorageSpec{
+				Quota: &v1beta1.StorageQuota{
+					MaxKeys:     &maxKeys,
+					Enforcement: enforcement,
+				},
+			},
+			Status: v1beta1.EtcdStorageStatus{
+				Conditions: []v1beta1.EtcdStorageCondition{
+					{
+						Type:   v1beta1.QuotaExceeded,
+						Status: exceeded,
+					},
+				},
+			},
+		}
+	}
+	deployment := func(replicas int32, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "etcd-test-1",
+				Namespace:   "test-storage",
+				Annotations: annotations,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+			},
+		}
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+
+	tests := []struct {
+		name                string
+		startingEtcdStorage *v1beta1.EtcdStorage
+		startingDeployment  *appsv1.Deployment
+		expectedReplicas    int32
+		expectedAnnotation  string
+		expectedErr         bool
+	}{
+		{
+			name:                "report enforcement doesn't scale down",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementReport, v1beta1.ConditionTrue),
+			startingDeployment:  deployment(3, nil),
+			expectedReplicas:    3,
+		},
+		{
+			name:                "scale down when quota is exceeded",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementScaleDown, v1beta1.ConditionTrue),
+			startingDeployment:  deployment(3, nil),
+			expectedReplicas:    0,
+			expectedAnnotation:  "3",
+		},
+		{
+			name:                "keep scaled down while quota is exceeded",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementScaleDown, v1beta1.ConditionTrue),
+			startingDeployment:  deployment(0, map[string]string{QuotaScaledDownReplicasAnnotation: "3"}),
+			expectedReplicas:    0,
+			expectedAnnotation:  "3",
+		},
+		{
+			name:                "scale up when quota is not exceeded",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementScaleDown, v1beta1.ConditionFalse),
+			startingDeployment:  deployment(0, map[string]string{QuotaScaledDownReplicasAnnotation: "3"}),
+			expectedReplicas:    3,
+		},
+		{
+			name:                "scale up when enforcement is changed to report",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementReport, v1beta1.ConditionTrue),
+			startingDeployment:  deployment(0, map[string]string{QuotaScaledDownReplicasAnnotation: "2"}),
+			expectedReplicas:    2,
+		},
+		{
+			name:                "invalid replicas annotation",
+			startingEtcdStorage: etcdStorage(v1beta1.QuotaEnforcementScaleDown, v1beta1.ConditionFalse),
+			startingDeployment:  deployment(0, map[string]string{QuotaScaledDownReplicasAnnotation: "three"}),
+			expectedReplicas:    0,
+			expectedAnnotation:  "three",
+			expectedErr:         true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{tc.startingEtcdStorage, tc.startingDeployment})
+
+			_, err := c.enforceQuota(tc.startingEtcdStorage, tc.startingDeployment)
+			if tc.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %t, but got: %v", tc.expectedErr, err)
+			}
+
+			updated, err := c.kubeclientset.AppsV1().Deployments("test-storage").Get("etcd-test-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *updated.Spec.Replicas != tc.expectedReplicas {
+				t.Fatalf("expected %d replicas, but got %d", tc.expectedReplicas, *updated.Spec.Replicas)
+			}
+			if updated.Annotations[QuotaScaledDownReplicasAnnotation] != tc.expectedAnnotation {
+				t.Fatalf("expected annotation '%s' to be '%s', but got '%s'", QuotaScaledDownReplicasAnnotation,
+					tc.expectedAnnotation, updated.Annotations[QuotaScaledDownReplicasAnnotation])
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package etcdproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/etcd/clientv3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+const (
+	// DataRetentionFinalizer is used to enforce the data retention policy on the data stored in the core etcd
+	// before the EtcdStorage resource is deleted.
+	DataRetentionFinalizer = "etcd.xmudrii.com/data-retention"
+
+	// DataRetentionFailure is used as part of the Event reason when the data retention policy is not
+	// enforced successfully.
+	DataRetentionFailure = "DataRetentionFailure"
+
+	// DataSnapshotFailure is used as the reason of the DataSnapshotFailed condition when the data snapshot
+	// can't be stored.
+	DataSnapshotFailure = "DataSnapshotFailure"
+
+	// DataSnapshotKey is the key in the snapshot Secret where the exported chunk of data is stored.
+	DataSnapshotKey = "snapshot.json"
+
+	// DataSnapshotLabel is the label set to the EtcdStorage name on all Secrets with chunks of its data snapshot.
+	DataSnapshotLabel = "etcd.xmudrii.com/data-snapshot"
+
+	// DataSnapshotRevisionAnnotation is the core etcd revision at which the data snapshot is taken.
+	DataSnapshotRevisionAnnotation = "etcd.xmudrii.com/data-snapshot-revision"
+
+	// DataSnapshotChunksAnnotation is the number of Secrets the data snapshot is split across.
+	DataSnapshotChunksAnnotation = "etcd.xmudrii.com/data-snapshot-chunks"
+
+	// dataSnapshotPageSize is the maximum number of keys fetched from the core etcd in a single request
+	// while exporting the data.
+	dataSnapshotPageSize = 1000
+
+	// maxDataSnapshotChunkSize is the maximum size of encoded keys and values stored in a single snapshot Secret.
+	// It leaves room for the rest of the snapshot chunk below the maximum Secret size.
+	maxDataSnapshotChunkSize = corev1.MaxSecretSize - 64*1024
+)
+
+// etcdSnapshot is the format in which a chunk of the data stored under the EtcdStorage prefix is exported.
+type etcdSnapshot struct {
+	// Prefix is the core etcd prefix used by the EtcdStorage.
+	Prefix string `json:"prefix"`
+	// Revision is the core etcd revision at which the snapshot is taken.
+	Revision int64 `json:"revision"`
+	// Chunk is the index of the chunk, starting from zero.
+	Chunk int `json:"chunk"`
+	// Chunks is the number of chunks the snapshot is split into.
+	Chunks int `json:"chunks"`
+	// KVs contains keys and values stored under the prefix, in the order of keys, which belong to the chunk.
+	KVs []etcdSnapshotKeyValue `json:"kvs"`
+}
+
+// etcdSnapshotKeyValue is a key stored in the core etcd along with its value.
+type etcdSnapshotKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// needsDataRetentionFinalizer checks does the data retention policy require the controller to
+// handle the data in the core etcd when the EtcdStorage is deleted.
+func needsDataRetentionFinalizer(etcdstorage *etcdstoragev1beta1.EtcdStorage) bool {
+	policy := etcdstorage.Spec.DataRetentionPolicy
+	return policy == etcdstoragev1beta1.DataRetentionPolicyDelete || policy == etcdstoragev1beta1.DataRetentionPolicySnapshot
+}
+
+// enforceDataRetentionPolicy handles the data stored in the core etcd under the prefix of the EtcdStorage
+// being deleted, as defined by the EtcdStorage data retention policy.
+//
+// With the Delete policy, all keys under the prefix are deleted. With the Snapshot policy, keys are exported
+// to Secrets in the controller namespace before they're deleted. If the snapshot can't be stored, keys are not
+// deleted and the DataSnapshotFailed condition is set. With the Retain policy, data is not changed.
+func (c *EtcdProxyController) enforceDataRetentionPolicy(etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	if !needsDataRetentionFinalizer(etcdstorage) {
+		return nil
+	}
+
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if etcdstorage.Spec.DataRetentionPolicy == etcdstoragev1beta1.DataRetentionPolicySnapshot {
+		if err := c.snapshotEtcdPrefix(client, etcdstorage); err != nil {
+			return c.dataSnapshotFailed(etcdstorage, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	_, err = client.Delete(ctx, etcdPrefix(etcdstorage), clientv3.WithPrefix())
+
+	return err
+}
+
+// snapshotEtcdPrefix exports all keys stored under the EtcdStorage prefix to snapshot Secrets in the controller
+// namespace. The snapshot is split into chunks, each stored in its own numbered Secret, so it's not limited by
+// the maximum Secret size. Secrets of chunks left over from a previous, larger snapshot are removed.
+func (c *EtcdProxyController) snapshotEtcdPrefix(client *clientv3.Client, etcdstorage *etcdstoragev1beta1.EtcdStorage) error {
+	snapshot, err := exportEtcdPrefix(client, etcdPrefix(etcdstorage))
+	if err != nil {
+		return err
+	}
+	chunks, err := splitEtcdSnapshot(snapshot, maxDataSnapshotChunkSize)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if len(data) > corev1.MaxSecretSize {
+			return fmt.Errorf("chunk %d of the data snapshot has %d bytes, more than the maximum Secret size of %d bytes",
+				chunk.Chunk, len(data), corev1.MaxSecretSize)
+		}
+
+		// The snapshot Secrets are not owned by the EtcdStorage, so they're not garbage collected along with it.
+		err = ensureSecret(c.kubeclientset, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      etcdDataSnapshotSecretName(etcdstorage, chunk.Chunk),
+				Namespace: c.config.ControllerNamespace,
+				Labels: map[string]string{
+					"apiserver":       etcdstorage.Name,
+					DataSnapshotLabel: etcdstorage.Name,
+				},
+				Annotations: map[string]string{
+					DataSnapshotRevisionAnnotation: fmt.Sprintf("%d", snapshot.Revision),
+					DataSnapshotChunksAnnotation:   fmt.Sprintf("%d", len(chunks)),
+				},
+			},
+			Data: map[string][]byte{
+				DataSnapshotKey: data,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.removeStaleDataSnapshotChunks(etcdstorage, len(chunks))
+}
+
+// exportEtcdPrefix fetches all keys stored in the core etcd under the provided prefix. Keys are fetched in pages
+// at the same revision, so the snapshot is consistent.
+func exportEtcdPrefix(client *clientv3.Client, prefix string) (*etcdSnapshot, error) {
+	snapshot := &etcdSnapshot{
+		Prefix: prefix,
+		KVs:    []etcdSnapshotKeyValue{},
+	}
+	key, end := prefix, clientv3.GetPrefixRangeEnd(prefix)
+
+	for {
+		opts := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithLimit(dataSnapshotPageSize)}
+		if snapshot.Revision != 0 {
+			opts = append(opts, clientv3.WithRev(snapshot.Revision))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+		resp, err := client.Get(ctx, key, opts...)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Revision = resp.Header.Revision
+
+		for _, kv := range resp.Kvs {
+			snapshot.KVs = append(snapshot.KVs, etcdSnapshotKeyValue{
+				Key:   kv.Key,
+				Value: kv.Value,
+			})
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return snapshot, nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// splitEtcdSnapshot splits the snapshot into chunks whose keys and values, as encoded in the snapshot, don't
+// exceed the provided size. The snapshot is always split into at least one chunk, even if it has no keys.
+func splitEtcdSnapshot(snapshot *etcdSnapshot, maxChunkSize int) ([]etcdSnapshot, error) {
+	newChunk := func(index int) etcdSnapshot {
+		return etcdSnapshot{
+			Prefix:   snapshot.Prefix,
+			Revision: snapshot.Revision,
+			Chunk:    index,
+			KVs:      []etcdSnapshotKeyValue{},
+		}
+	}
+
+	chunks := []etcdSnapshot{newChunk(0)}
+	chunkSize := 0
+	for _, kv := range snapshot.KVs {
+		size := encodedKeyValueSize(kv)
+		if size > maxChunkSize {
+			return nil, fmt.Errorf("key '%s' has %d bytes when encoded, more than the maximum snapshot chunk size of %d bytes",
+				kv.Key, size, maxChunkSize)
+		}
+		if chunkSize+size > maxChunkSize {
+			chunks = append(chunks, newChunk(len(chunks)))
+			chunkSize = 0
+		}
+
+		chunk := &chunks[len(chunks)-1]
+		chunk.KVs = append(chunk.KVs, kv)
+		chunkSize += size
+	}
+
+	for i := range chunks {
+		chunks[i].Chunks = len(chunks)
+	}
+	return chunks, nil
+}
+
+// encodedKeyValueSize calculates the size of the key and value once encoded in the snapshot.
+func encodedKeyValueSize(kv etcdSnapshotKeyValue) int {
+	return len(`{"key":"","value":""},`) +
+		base64.StdEncoding.EncodedLen(len(kv.Key)) +
+		base64.StdEncoding.EncodedLen(len(kv.Value))
+}
+
+// removeStaleDataSnapshotChunks deletes snapshot Secrets of the EtcdStorage for chunks beyond the provided number
+// of chunks, so a snapshot can't be mixed with chunks of a previous snapshot.
+func (c *EtcdProxyController) removeStaleDataSnapshotChunks(etcdstorage *etcdstoragev1beta1.EtcdStorage, chunks int) error {
+	current := map[string]bool{}
+	for i := 0; i < chunks; i++ {
+		current[etcdDataSnapshotSecretName(etcdstorage, i)] = true
+	}
+
+	secrets, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).List(metav1.ListOptions{
+		LabelSelector: labels.Set{DataSnapshotLabel: etcdstorage.Name}.String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets.Items {
+		if current[secret.Name] {
+			continue
+		}
+		err := c.kubeclientset.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dataSnapshotFailed sets the DataSnapshotFailed condition, so it's visible on the EtcdStorage why its deletion
+// is blocked, and returns the error that prevented storing the data snapshot.
+func (c *EtcdProxyController) dataSnapshotFailed(etcdstorage *etcdstoragev1beta1.EtcdStorage, err error) error {
+	err = fmt.Errorf("unable to store data snapshot: %v", err)
+	_, updateErr := c.updateEtcdStorageStatus(etcdstorage, &etcdstorage.Status, etcdstoragev1beta1.EtcdStorageCondition{
+		Type:               etcdstoragev1beta1.DataSnapshotFailed,
+		Status:             etcdstoragev1beta1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             DataSnapshotFailure,
+		Message:            err.Error(),
+	})
+	if updateErr != nil {
+		runtime.HandleError(fmt.Errorf("unable to update status of etcdstorage '%s': %v", etcdstorage.Name, updateErr))
+	}
+
+	return err
+}
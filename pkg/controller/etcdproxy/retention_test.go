@@ -0,0 +1,430 @@
+package etcdproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestEnforceDataRetentionPolicy(t *testing.T) {
+	etcdStorage := func(name string, policy v1beta1.DataRetentionPolicy) *v1beta1.EtcdStorage {
+		deletionTimestamp := metav1.NewTime(time.Now())
+		return &v1beta1.EtcdStorage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				DeletionTimestamp: &deletionTimestamp,
+				Finalizers:        []string{DataRetentionFinalizer},
+			},
+			Spec: v1beta1.EtcdStorageSpec{
+				SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 60},
+				ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 60},
+				DataRetentionPolicy:        policy,
+			},
+		}
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	tests := []struct {
+		name                string
+		startingEtcdStorage *v1beta1.EtcdStorage
+		expectDeleted       bool
+		expectSnapshot      bool
+	}{
+		{
+			name:                "default policy retains data",
+			startingEtcdStorage: etcdStorage("test-1", ""),
+		},
+		{
+			name:                "retain policy retains data",
+			startingEtcdStorage: etcdStorage("test-2", v1beta1.DataRetentionPolicyRetain),
+		},
+		{
+			name:                "delete policy deletes data",
+			startingEtcdStorage: etcdStorage("test-3", v1beta1.DataRetentionPolicyDelete),
+			expectDeleted:       true,
+		},
+		{
+			name:                "snapshot policy exports and deletes data",
+			startingEtcdStorage: etcdStorage("test-4", v1beta1.DataRetentionPolicySnapshot),
+			expectDeleted:       true,
+			expectSnapshot:      true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es := tc.startingEtcdStorage
+			c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es}, coreEtcd.Objects...))
+
+			client, err := c.newCoreEtcdClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			// Keys of another EtcdStorage, whose name has the same prefix, must never be touched.
+			keys := map[string]string{
+				"/" + es.Name + "/foo":       "foo",
+				"/" + es.Name + "/bar/baz":   "baz",
+				"/" + es.Name + "-other/foo": "other",
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+			defer cancel()
+			for k, v := range keys {
+				if _, err := client.Put(ctx, k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = c.syncHandler(es.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Get(ctx, etcdPrefix(es), clientv3.WithPrefix(), clientv3.WithCountOnly())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectDeleted && resp.Count != 0 {
+				t.Fatalf("expected keys under prefix '%s' to be deleted, but found %d keys", etcdPrefix(es), resp.Count)
+			}
+			if !tc.expectDeleted && resp.Count != 2 {
+				t.Fatalf("expected keys under prefix '%s' to be retained, but found %d keys", etcdPrefix(es), resp.Count)
+			}
+
+			resp, err = client.Get(ctx, "/"+es.Name+"-other/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Count != 1 {
+				t.Fatalf("expected keys of other EtcdStorage to be retained, but found %d keys", resp.Count)
+			}
+
+			secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdDataSnapshotSecretName(es, 0), metav1.GetOptions{})
+			if !tc.expectSnapshot {
+				if !errors.IsNotFound(err) {
+					t.Fatalf("expected snapshot secret not to be created, but got: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var snapshot etcdSnapshot
+				if err := json.Unmarshal(secret.Data[DataSnapshotKey], &snapshot); err != nil {
+					t.Fatal(err)
+				}
+				if snapshot.Prefix != etcdPrefix(es) || snapshot.Chunk != 0 || snapshot.Chunks != 1 {
+					t.Fatalf("expected single chunk snapshot of prefix '%s', but got prefix '%s' and chunk %d of %d",
+						etcdPrefix(es), snapshot.Prefix, snapshot.Chunk, snapshot.Chunks)
+				}
+				if len(snapshot.KVs) != 2 {
+					t.Fatalf("expected 2 keys in snapshot, but got %d", len(snapshot.KVs))
+				}
+				for _, kv := range snapshot.KVs {
+					if keys[string(kv.Key)] != string(kv.Value) {
+						t.Fatalf("unexpected key '%s' with value '%s' in snapshot", kv.Key, kv.Value)
+					}
+				}
+			}
+
+			updated, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer(updated.Finalizers, DataRetentionFinalizer) {
+				t.Fatalf("expected finalizer '%s' to be removed", DataRetentionFinalizer)
+			}
+		})
+	}
+}
+
+func TestEnforceDataRetentionPolicyFailure(t *testing.T) {
+	deletionTimestamp := metav1.NewTime(time.Now())
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-1",
+			DeletionTimestamp: &deletionTimestamp,
+			Finalizers:        []string{DataRetentionFinalizer},
+		},
+		Spec: v1beta1.EtcdStorageSpec{
+			DataRetentionPolicy: v1beta1.DataRetentionPolicyDelete,
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{es})
+	if err := c.syncHandler(es.Name); err == nil {
+		t.Fatal("expected error when data retention policy can't be enforced")
+	}
+
+	updated, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasFinalizer(updated.Finalizers, DataRetentionFinalizer) {
+		t.Fatalf("expected finalizer '%s' to be kept", DataRetentionFinalizer)
+	}
+}
+
+func TestSnapshotEtcdPrefixChunks(t *testing.T) {
+	deletionTimestamp := metav1.NewTime(time.Now())
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-1",
+			DeletionTimestamp: &deletionTimestamp,
+			Finalizers:        []string{DataRetentionFinalizer},
+		},
+		Spec: v1beta1.EtcdStorageSpec{
+			DataRetentionPolicy: v1beta1.DataRetentionPolicySnapshot,
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	// A chunk left over from a previous snapshot must be removed.
+	staleChunk := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdDataSnapshotSecretName(es, 5),
+			Namespace: etcdProxyConfig.ControllerNamespace,
+			Labels:    map[string]string{DataSnapshotLabel: es.Name},
+		},
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es, staleChunk}, coreEtcd.Objects...))
+
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// More keys than fit a single page, and values that don't fit a single Secret.
+	keys := map[string][]byte{}
+	for i := 0; i < dataSnapshotPageSize+10; i++ {
+		keys[fmt.Sprintf("/%s/small/%04d", es.Name, i)] = []byte(fmt.Sprintf("value-%d", i))
+	}
+	for i := 0; i < 3; i++ {
+		keys[fmt.Sprintf("/%s/large/%d", es.Name, i)] = bytes.Repeat([]byte{byte('a' + i)}, 400*1024)
+	}
+	for k, v := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+		_, err := client.Put(ctx, k, string(v))
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.syncHandler(es.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).List(metav1.ListOptions{
+		LabelSelector: DataSnapshotLabel + "=" + es.Name,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) < 2 {
+		t.Fatalf("expected snapshot to be split across multiple secrets, but got %d secrets", len(secrets.Items))
+	}
+
+	exported := map[string][]byte{}
+	for i := range secrets.Items {
+		secret, err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdDataSnapshotSecretName(es, i), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secret.Data[DataSnapshotKey]) > corev1.MaxSecretSize {
+			t.Fatalf("expected secret '%s' to be within the maximum secret size, but it has %d bytes", secret.Name, len(secret.Data[DataSnapshotKey]))
+		}
+
+		var snapshot etcdSnapshot
+		if err := json.Unmarshal(secret.Data[DataSnapshotKey], &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.Chunk != i || snapshot.Chunks != len(secrets.Items) {
+			t.Fatalf("expected chunk %d of %d in secret '%s', but got chunk %d of %d", i, len(secrets.Items), secret.Name, snapshot.Chunk, snapshot.Chunks)
+		}
+		for _, kv := range snapshot.KVs {
+			exported[string(kv.Key)] = kv.Value
+		}
+	}
+	if !reflect.DeepEqual(exported, keys) {
+		t.Fatalf("expected all %d keys to be exported, but got %d keys", len(keys), len(exported))
+	}
+}
+
+func TestSnapshotEtcdPrefixTooLarge(t *testing.T) {
+	deletionTimestamp := metav1.NewTime(time.Now())
+	es := &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-1",
+			DeletionTimestamp: &deletionTimestamp,
+			Finalizers:        []string{DataRetentionFinalizer},
+		},
+		Spec: v1beta1.EtcdStorageSpec{
+			DataRetentionPolicy: v1beta1.DataRetentionPolicySnapshot,
+		},
+	}
+	etcdProxyConfig := &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+	coreEtcd := startEmbeddedEtcd(t, etcdProxyConfig)
+	defer coreEtcd.Stop()
+	etcdProxyConfig.CoreEtcd.URLs = []string{coreEtcd.URL}
+
+	c := newEtcdProxyControllerMock(etcdProxyConfig, append([]runtime.Object{es}, coreEtcd.Objects...))
+	client, err := c.newCoreEtcdClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The value doesn't fit a single Secret once encoded in the snapshot.
+	ctx, cancel := context.WithTimeout(context.Background(), coreEtcdRequestTimeout)
+	defer cancel()
+	if _, err := client.Put(ctx, "/"+es.Name+"/foo", string(bytes.Repeat([]byte("a"), 800*1024))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.syncHandler(es.Name); err == nil {
+		t.Fatal("expected error when data snapshot can't be stored")
+	}
+
+	resp, err := client.Get(ctx, etcdPrefix(es), clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 1 {
+		t.Fatalf("expected keys under prefix '%s' to be retained, but found %d keys", etcdPrefix(es), resp.Count)
+	}
+
+	updated, err := c.etcdProxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasFinalizer(updated.Finalizers, DataRetentionFinalizer) {
+		t.Fatalf("expected finalizer '%s' to be kept", DataRetentionFinalizer)
+	}
+	if !v1beta1.IsEtcdStorageConditionTrue(updated, v1beta1.DataSnapshotFailed) {
+		t.Fatalf("expected DataSnapshotFailed condition to be true, but got %+v", updated.Status.Conditions)
+	}
+}
+
+func TestSplitEtcdSnapshot(t *testing.T) {
+	kv := func(key, value string) etcdSnapshotKeyValue {
+		return etcdSnapshotKeyValue{Key: []byte(key), Value: []byte(value)}
+	}
+	snapshot := &etcdSnapshot{
+		Prefix:   "/test/",
+		Revision: 10,
+		KVs:      []etcdSnapshotKeyValue{kv("/test/a", "aaaa"), kv("/test/b", "bbbb"), kv("/test/c", "cccc")},
+	}
+	size := encodedKeyValueSize(snapshot.KVs[0])
+
+	tests := []struct {
+		name           string
+		snapshot       *etcdSnapshot
+		maxChunkSize   int
+		expectedChunks [][]etcdSnapshotKeyValue
+		expectError    bool
+	}{
+		{
+			name:           "empty snapshot",
+			snapshot:       &etcdSnapshot{Prefix: "/test/", Revision: 10},
+			maxChunkSize:   size,
+			expectedChunks: [][]etcdSnapshotKeyValue{{}},
+		},
+		{
+			name:           "all keys in a single chunk",
+			snapshot:       snapshot,
+			maxChunkSize:   3 * size,
+			expectedChunks: [][]etcdSnapshotKeyValue{snapshot.KVs},
+		},
+		{
+			name:           "keys split across chunks",
+			snapshot:       snapshot,
+			maxChunkSize:   2*size + 1,
+			expectedChunks: [][]etcdSnapshotKeyValue{snapshot.KVs[:2], snapshot.KVs[2:]},
+		},
+		{
+			name:         "key larger than a chunk",
+			snapshot:     snapshot,
+			maxChunkSize: size - 1,
+			expectError:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks, err := splitEtcdSnapshot(tc.snapshot, tc.maxChunkSize)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected error splitting the snapshot")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(chunks) != len(tc.expectedChunks) {
+				t.Fatalf("expected %d chunks, but got %d", len(tc.expectedChunks), len(chunks))
+			}
+			for i, chunk := range chunks {
+				if chunk.Prefix != tc.snapshot.Prefix || chunk.Revision != tc.snapshot.Revision || chunk.Chunk != i || chunk.Chunks != len(chunks) {
+					t.Fatalf("unexpected chunk %d: %+v", i, chunk)
+				}
+				if !reflect.DeepEqual(chunk.KVs, tc.expectedChunks[i]) {
+					t.Fatalf("expected keys %v in chunk %d, but got %v", tc.expectedChunks[i], i, chunk.KVs)
+				}
+			}
+		})
+	}
+}
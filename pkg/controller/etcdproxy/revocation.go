@@ -0,0 +1,96 @@
+package etcdproxy
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// ClientCertificatesRevoked is used as part of the Event reason when the Client signer is rotated to revoke
+	// Client certificates.
+	ClientCertificatesRevoked = "ClientCertificatesRevoked"
+)
+
+// revokeClientCertificates checks does the self-generated Client signer have to be rotated to revoke Client certificates.
+// etcd-proxy can't check certificate revocation lists, so Client certificates are revoked by rotating the Client
+// signer instead: the rotation reissues Client certificates for all Secrets from the EtcdStorage Spec using the new
+// Client signer, and once it's done, removes all previous signers from the Client CA bundle. Revoked certificates,
+// whether issued by the current or any previous signer, are rejected by etcd-proxy pods afterwards.
+//
+// The Client signer is rotated if the Spec revokes Client certificates not revoked by the rotation recorded in
+// the EtcdStorage status, unless that rotation is still in progress. In that case, they are revoked by the next
+// rotation, once the current one is done.
+//
+// Client certificates issued by the Issuer or using CertificateSigningRequests can't be revoked, as the controller
+// can't rotate their signer.
+//
+// The rotation doesn't reissue Client certificates to Secrets still holding a revoked certificate, so a compromised
+// namespace doesn't get a certificate from the new signer. The Secret should be removed from the EtcdStorage Spec too,
+// as the controller issues a new certificate if the Secret is deleted.
+func (c *EtcdProxyController) revokeClientCertificates(etcdstorage *etcdstoragev1beta1.EtcdStorage) (bool, error) {
+	recorded := etcdstorage.Status.ClientCertificates
+	pending, err := pendingRevocations(etcdstorage.Spec.RevokedClientCertificates, recorded)
+	if err != nil || len(pending) == 0 {
+		return false, err
+	}
+	if etcdstorage.Spec.Issuer != nil {
+		return false, fmt.Errorf("client certificates signed by the issuer can't be revoked")
+	}
+	if c.useCSR(etcdstorage) {
+		return false, fmt.Errorf("client certificates issued using certificate signing requests can't be revoked")
+	}
+	if recorded != nil && recorded.Phase != "" && recorded.Phase != etcdstoragev1beta1.CertificateRotationOldCARemoved {
+		return false, nil
+	}
+
+	c.recorder.Event(etcdstorage, v1.EventTypeNormal, ClientCertificatesRevoked,
+		fmt.Sprintf("Rotating Client signing certificate to revoke Client certificates %s", strings.Join(pending, ", ")))
+	return true, nil
+}
+
+// pendingRevocations returns serial numbers of revoked Client certificates that are not revoked by the recorded
+// Client signer rotation.
+func pendingRevocations(revoked []etcdstoragev1beta1.RevokedCertificate, recorded *etcdstoragev1beta1.CertificateRotation) ([]string, error) {
+	revokedByRotation := map[string]bool{}
+	if recorded != nil {
+		for _, r := range recorded.RevokedCertificates {
+			serialNumber, err := certs.ParseSerialNumber(r.SerialNumber)
+			if err != nil {
+				return nil, err
+			}
+			revokedByRotation[serialNumber.String()] = true
+		}
+	}
+
+	var pending []string
+	for _, r := range revoked {
+		serialNumber, err := certs.ParseSerialNumber(r.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		if !revokedByRotation[serialNumber.String()] {
+			pending = append(pending, certs.FormatSerialNumber(serialNumber))
+		}
+	}
+
+	return pending, nil
+}
+
+// revokedSerialNumbers returns the set of serial numbers of revoked Client certificates, in decimal notation.
+func revokedSerialNumbers(revoked []etcdstoragev1beta1.RevokedCertificate) (map[string]bool, error) {
+	serialNumbers := map[string]bool{}
+	for _, r := range revoked {
+		serialNumber, err := certs.ParseSerialNumber(r.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		serialNumbers[serialNumber.String()] = true
+	}
+
+	return serialNumbers, nil
+}
@@ -0,0 +1,186 @@
+package etcdproxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+func TestRevokeClientCertificates(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("revocation-test-1")
+	etcdStorage.Spec.ClientCertSecrets = append(etcdStorage.Spec.ClientCertSecrets, v1beta1.ClientCertificateDestination{
+		Name:      "etcd-client-cert",
+		Namespace: "k8s-other-apiserver",
+	})
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	// rollOut simulates etcd-proxy pods picking up the current certificates.
+	rollOut := func() {
+		certificatesHash, err := c.proxyCertificatesHash(etcdStorage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deploymentIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
+		deploymentIndexer.Add(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      deploymentName(etcdStorage),
+				Namespace: etcdProxyConfig.ControllerNamespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name, etcdProxyConfig.ProxyImage,
+					etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName, etcdProxyConfig.CoreEtcd.URLs,
+					certificatesHash, nil).Spec.Template,
+			},
+			Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		})
+		c.deploymentsLister = dslisters.NewDeploymentLister(deploymentIndexer)
+	}
+	sync := func() {
+		if err := c.ensureClientCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ensureServerCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trusted := func(cert *certs.Certificate) bool {
+		clientCA := getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+		for _, ca := range clientCA.Certificates {
+			if cert.Certificates[0].CheckSignatureFrom(ca) == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	sync()
+	firstSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	revokedCert := getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert")
+
+	// Start a Client signer rotation, so the certificate to be revoked is signed by a previous signer in the bundle.
+	clock.step(time.Hour)
+	etcdStorage.Spec.SigningCertificateValidity = metav1.Duration{time.Hour * 24 * 200}
+	sync()
+	secondSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	if etcdStorage.Status.ClientCertificates.Phase != v1beta1.CertificateRotationCADistributed {
+		t.Fatalf("expected CADistributed rotation phase, but got %+v", etcdStorage.Status.ClientCertificates)
+	}
+
+	// Revocation is deferred while the rotation is in progress.
+	etcdStorage.Spec.RevokedClientCertificates = []v1beta1.RevokedCertificate{
+		{SerialNumber: certs.FormatSerialNumber(revokedCert.Certificates[0].SerialNumber)},
+	}
+	sync()
+	if signer := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage)); !signer.Certificates[0].Equal(secondSigner.Certificates[0]) {
+		t.Fatal("expected client signer not to be rotated while a rotation is in progress")
+	}
+
+	// Finish the rotation: it removes the first signer, but it doesn't revoke the certificate, as it started before.
+	// The Secret holding the revoked certificate is not reissued.
+	rollOut()
+	sync()
+	sync()
+	if etcdStorage.Status.ClientCertificates.Phase != v1beta1.CertificateRotationOldCARemoved {
+		t.Fatalf("expected OldCARemoved rotation phase, but got %+v", etcdStorage.Status.ClientCertificates)
+	}
+
+	// The next sync rotates the Client signer to revoke the certificate.
+	clock.step(time.Hour)
+	sync()
+	thirdSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	if thirdSigner.Certificates[0].Equal(secondSigner.Certificates[0]) {
+		t.Fatal("expected client signer to be rotated to revoke the client certificate")
+	}
+	rotation := etcdStorage.Status.ClientCertificates
+	if rotation.Phase != v1beta1.CertificateRotationCADistributed ||
+		!reflect.DeepEqual(rotation.RevokedCertificates, etcdStorage.Spec.RevokedClientCertificates) {
+		t.Fatalf("expected CADistributed rotation revoking %v, but got %+v", etcdStorage.Spec.RevokedClientCertificates, rotation)
+	}
+
+	// Further syncs don't rotate the Client signer again.
+	sync()
+	if signer := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage)); !signer.Certificates[0].Equal(thirdSigner.Certificates[0]) {
+		t.Fatal("expected client signer not to be rotated again")
+	}
+
+	// Once etcd-proxy pods trust the new signer, the other Client certificate is reissued, and previous signers
+	// are removed.
+	rollOut()
+	sync()
+	sync()
+	rotation = etcdStorage.Status.ClientCertificates
+	if rotation.Phase != v1beta1.CertificateRotationOldCARemoved {
+		t.Fatalf("expected OldCARemoved rotation phase, but got %+v", rotation)
+	}
+	if cert := getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert"); !cert.Certificates[0].Equal(revokedCert.Certificates[0]) {
+		t.Fatal("expected revoked client certificate not to be reissued")
+	}
+	clientCert := getSecretCertificate(t, c, "k8s-other-apiserver", "etcd-client-cert")
+	if err := clientCert.Certificates[0].CheckSignatureFrom(thirdSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected client certificate reissued by the new client signer: %v", err)
+	}
+	if !trusted(clientCert) {
+		t.Fatal("expected reissued client certificate to be trusted")
+	}
+	if trusted(revokedCert) {
+		t.Fatal("expected revoked client certificate not to be trusted")
+	}
+	clientCA := getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+	if containsCertificate(clientCA.Certificates, firstSigner.Certificates[0]) || containsCertificate(clientCA.Certificates, secondSigner.Certificates[0]) {
+		t.Fatal("expected previous client signers to be removed from the client CA bundle")
+	}
+
+	// Revoking the current certificate rotates the Client signer again, but the Secret holding it is not reissued,
+	// and the rotation isn't blocked by it.
+	etcdStorage.Spec.RevokedClientCertificates = append(etcdStorage.Spec.RevokedClientCertificates,
+		v1beta1.RevokedCertificate{SerialNumber: certs.FormatSerialNumber(clientCert.Certificates[0].SerialNumber)})
+	clock.step(time.Hour)
+	sync()
+	rollOut()
+	sync()
+	sync()
+	if rotation = etcdStorage.Status.ClientCertificates; rotation.Phase != v1beta1.CertificateRotationOldCARemoved {
+		t.Fatalf("expected OldCARemoved rotation phase, but got %+v", rotation)
+	}
+	if cert := getSecretCertificate(t, c, "k8s-other-apiserver", "etcd-client-cert"); !cert.Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected revoked client certificate not to be reissued")
+	}
+	if trusted(clientCert) {
+		t.Fatal("expected revoked client certificate not to be trusted")
+	}
+}
+
+func TestRevokeClientCertificatesUsingCSR(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("revocation-test-2")
+	etcdStorage.Spec.RevokedClientCertificates = []v1beta1.RevokedCertificate{{SerialNumber: "3F:2A:9C"}}
+	etcdStorage.Status.ClientCertificates = &v1beta1.CertificateRotation{Signer: "cluster-signer"}
+	etcdProxyConfig := newTestSignerConfig()
+	etcdProxyConfig.CSR = &CSRConfig{Enabled: true}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+
+	if _, err := c.revokeClientCertificates(etcdStorage); err == nil {
+		t.Fatal("expected error revoking client certificates issued using certificate signing requests")
+	}
+
+	// Serial numbers revoked by the recorded rotation are not revoked again.
+	etcdStorage.Status.ClientCertificates.RevokedCertificates = []v1beta1.RevokedCertificate{{SerialNumber: "3f2a9c"}}
+	rotate, err := c.revokeClientCertificates(etcdStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotate {
+		t.Fatal("expected no rotation for already revoked client certificates")
+	}
+}
@@ -0,0 +1,131 @@
+package etcdproxy
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// DefaultCertificateRenewalFraction is the default fraction of the certificate lifetime after which
+	// the certificate is renewed.
+	DefaultCertificateRenewalFraction = 0.5
+
+	// CertificateRenewed is used as part of the Event reason when an etcd-proxy certificate is issued or renewed.
+	CertificateRenewed = "CertificateRenewed"
+
+	// validityChangeTolerance is the maximum difference between the certificate lifetime and the validity from
+	// the EtcdStorage spec for which the validity is not considered changed.
+	validityChangeTolerance = time.Minute
+)
+
+// renewalFraction returns the fraction of the certificate lifetime after which the certificate is renewed.
+func (c *EtcdProxyController) renewalFraction() float64 {
+	if c.config.CertificateRenewalFraction <= 0 || c.config.CertificateRenewalFraction >= 1 {
+		return DefaultCertificateRenewalFraction
+	}
+	return c.config.CertificateRenewalFraction
+}
+
+// renewalReason checks does the certificate have to be renewed, based on its NotBefore and NotAfter dates rather
+// than on annotations. The certificate is renewed once the renewal fraction of its lifetime has passed, or
+// immediately if the validity in the EtcdStorage spec has changed, in case checkValidity is set. It returns
+// the reason for renewing the certificate, or an empty string if the certificate doesn't have to be renewed.
+func (c *EtcdProxyController) renewalReason(cert *x509.Certificate, validity time.Duration, checkValidity bool) string {
+	now := c.currentTime()
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+
+	if !now.Before(cert.NotAfter) {
+		return fmt.Sprintf("certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	// The certificate lifetime is one second longer than the validity, as certificates are backdated.
+	if diff := lifetime - validity; checkValidity && (diff > validityChangeTolerance || diff < -validityChangeTolerance) {
+		return fmt.Sprintf("certificate validity changed from %s to %s", lifetime.Round(time.Second), validity)
+	}
+	renewalTime := cert.NotBefore.Add(time.Duration(float64(lifetime) * c.renewalFraction()))
+	if !now.Before(renewalTime) {
+		return fmt.Sprintf("certificate reached its renewal time %s", renewalTime.Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+// signerRotation returns the rotation state for the current signing certificate, based on the rotation state
+// recorded in the EtcdStorage status. If the signing certificate has changed since, a new rotation is started
+// in the CADistributed phase, as the caller distributes the new signing certificate in CA bundles before
+// any certificate is reissued. The returned rotation state is a copy, so it can be modified by the caller.
+func (c *EtcdProxyController) signerRotation(recorded *etcdstoragev1beta1.CertificateRotation, signer *certs.Certificate) *etcdstoragev1beta1.CertificateRotation {
+	signerName := signer.Certificates[0].Subject.CommonName
+	if recorded == nil || recorded.Signer == "" {
+		return &etcdstoragev1beta1.CertificateRotation{Signer: signerName}
+	}
+	if recorded.Signer == signerName {
+		return recorded.DeepCopy()
+	}
+
+	return &etcdstoragev1beta1.CertificateRotation{
+		Phase:              etcdstoragev1beta1.CertificateRotationCADistributed,
+		Signer:             signerName,
+		PreviousSigner:     recorded.Signer,
+		LastTransitionTime: metav1.NewTime(c.currentTime()),
+	}
+}
+
+// setRotationPhase moves the rotation to the provided phase, if it's not in that phase already.
+func (c *EtcdProxyController) setRotationPhase(rotation *etcdstoragev1beta1.CertificateRotation, phase etcdstoragev1beta1.CertificateRotationPhase) {
+	if rotation.Phase == phase {
+		return
+	}
+	rotation.Phase = phase
+	rotation.LastTransitionTime = metav1.NewTime(c.currentTime())
+}
+
+// inRotationPhase checks was the rotation for the provided signing certificate in the provided phase, as recorded
+// in the EtcdStorage status by a previous sync.
+func inRotationPhase(recorded *etcdstoragev1beta1.CertificateRotation, signer *certs.Certificate, phase etcdstoragev1beta1.CertificateRotationPhase) bool {
+	return recorded != nil && recorded.Phase == phase && recorded.Signer == signer.Certificates[0].Subject.CommonName
+}
+
+// signedBy checks is the certificate signed by the signing certificate.
+func signedBy(cert *certs.Certificate, signer *certs.Certificate) bool {
+	return cert.Certificates[0].CheckSignatureFrom(signer.Certificates[0]) == nil
+}
+
+// proxyRolledOut checks are all etcd-proxy pods using the current certificates, including the Client CA bundle.
+func (c *EtcdProxyController) proxyRolledOut(etcdstorage *etcdstoragev1beta1.EtcdStorage) (bool, error) {
+	certificatesHash, err := c.proxyCertificatesHash(etcdstorage)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	deployment, err := c.deploymentsLister.Deployments(c.config.ControllerNamespace).Get(deploymentName(etcdstorage))
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return deploymentRolledOut(deployment, certificatesHash), nil
+}
+
+// updateCertificateSecret updates the Secret containing the certificate/key pair, or creates it if it doesn't exist.
+// Unlike ensureSecret, it overrides certificates issued by the controller, so they can be renewed.
+func updateCertificateSecret(kubeclientset kubernetes.Interface, secret *v1.Secret) error {
+	_, err := kubeclientset.CoreV1().Secrets(secret.Namespace).Update(secret)
+	if errors.IsNotFound(err) {
+		_, err = kubeclientset.CoreV1().Secrets(secret.Namespace).Create(secret)
+	}
+	return err
+}
@@ -0,0 +1,481 @@
+package etcdproxy
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// fakeClock is used to control the time used for issuing and renewing certificates.
+type fakeClock struct {
+	now time.Time
+}
+
+// newFakeClock returns a fakeClock starting at a fixed time, so tests don't depend on the wall clock.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) currentTime() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) step(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func getSecretCertificate(t *testing.T, c *EtcdProxyController, namespace, name string) *certs.Certificate {
+	secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func getConfigMapBundle(t *testing.T, c *EtcdProxyController, namespace, name, key string) *certs.Certificate {
+	configMap, err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := certs.ParseCertificateBytes([]byte(configMap.Data[key]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestRenewalReason(t *testing.T) {
+	notBefore := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		NotBefore: notBefore.Add(-1 * time.Second),
+		NotAfter:  notBefore.Add(time.Hour * 24 * 30),
+	}
+
+	tests := []struct {
+		name          string
+		fraction      float64
+		now           time.Time
+		validity      time.Duration
+		checkValidity bool
+		expectRenewal bool
+	}{
+		{
+			name:          "certificate just issued",
+			now:           notBefore.Add(time.Hour),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+		},
+		{
+			name:          "default renewal fraction not reached",
+			now:           notBefore.Add(time.Hour * 24 * 14),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+		},
+		{
+			name:          "default renewal fraction reached",
+			now:           notBefore.Add(time.Hour * 24 * 15),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+			expectRenewal: true,
+		},
+		{
+			name:          "configured renewal fraction not reached",
+			fraction:      0.8,
+			now:           notBefore.Add(time.Hour * 24 * 20),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+		},
+		{
+			name:          "configured renewal fraction reached",
+			fraction:      0.8,
+			now:           notBefore.Add(time.Hour * 24 * 25),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+			expectRenewal: true,
+		},
+		{
+			name:          "certificate expired",
+			fraction:      0.99,
+			now:           notBefore.Add(time.Hour * 24 * 31),
+			validity:      time.Hour * 24 * 30,
+			checkValidity: true,
+			expectRenewal: true,
+		},
+		{
+			name:          "validity changed",
+			now:           notBefore.Add(time.Hour),
+			validity:      time.Hour * 24 * 10,
+			checkValidity: true,
+			expectRenewal: true,
+		},
+		{
+			name:     "validity changed but not checked",
+			now:      notBefore.Add(time.Hour),
+			validity: time.Hour * 24 * 10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: tc.now}
+			c := &EtcdProxyController{
+				config:      &EtcdProxyControllerConfig{CertificateRenewalFraction: tc.fraction},
+				currentTime: clock.currentTime,
+			}
+
+			reason := c.renewalReason(cert, tc.validity, tc.checkValidity)
+			if (reason != "") != tc.expectRenewal {
+				t.Fatalf("expected renewal %t, but got reason '%s'", tc.expectRenewal, reason)
+			}
+		})
+	}
+}
+
+func TestCertificateRenewal(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("rotation-test-1")
+	// The Serving certificate validity is shorter than the Client certificate validity, so the Server certificate
+	// has to be renewed based on its own validity.
+	etcdStorage.Spec.ServingCertificateValidity = metav1.Duration{time.Hour * 24 * 20}
+	etcdStorage.Spec.ClientCertificateValidity = metav1.Duration{time.Hour * 24 * 60}
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	ensureCertificates := func() (*certs.Certificate, *certs.Certificate) {
+		if err := c.ensureClientCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ensureServerCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		return getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage)),
+			getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert")
+	}
+
+	serverCert, clientCert := ensureCertificates()
+	if !serverCert.Certificates[0].NotBefore.Equal(clock.now.Add(-1 * time.Second).Truncate(time.Second)) {
+		t.Fatalf("expected server certificate issued at %s, but got %s", clock.now, serverCert.Certificates[0].NotBefore)
+	}
+
+	// Certificates are not renewed before half of their lifetime passes.
+	clock.step(time.Hour * 24 * 9)
+	renewedServerCert, renewedClientCert := ensureCertificates()
+	if !renewedServerCert.Certificates[0].Equal(serverCert.Certificates[0]) || !renewedClientCert.Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected certificates not to be renewed")
+	}
+
+	// The Server certificate is renewed once half of its lifetime passes, while the Client certificate is not.
+	clock.step(time.Hour * 24 * 2)
+	renewedServerCert, renewedClientCert = ensureCertificates()
+	if renewedServerCert.Certificates[0].Equal(serverCert.Certificates[0]) {
+		t.Fatal("expected server certificate to be renewed")
+	}
+	if !renewedClientCert.Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected client certificate not to be renewed")
+	}
+	if !renewedServerCert.Certificates[0].NotAfter.After(clock.now.Add(etcdStorage.Spec.ServingCertificateValidity.Duration - time.Second)) {
+		t.Fatalf("expected renewed server certificate valid for %s, but it expires on %s",
+			etcdStorage.Spec.ServingCertificateValidity.Duration, renewedServerCert.Certificates[0].NotAfter)
+	}
+	serverCert = renewedServerCert
+
+	// Changing the Client certificate validity renews the Client certificate immediately.
+	etcdStorage.Spec.ClientCertificateValidity = metav1.Duration{time.Hour * 24 * 30}
+	renewedServerCert, renewedClientCert = ensureCertificates()
+	if !renewedServerCert.Certificates[0].Equal(serverCert.Certificates[0]) {
+		t.Fatal("expected server certificate not to be renewed")
+	}
+	if renewedClientCert.Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected client certificate to be renewed")
+	}
+	lifetime := renewedClientCert.Certificates[0].NotAfter.Sub(renewedClientCert.Certificates[0].NotBefore)
+	if lifetime-etcdStorage.Spec.ClientCertificateValidity.Duration > time.Minute {
+		t.Fatalf("expected renewed client certificate valid for %s, but got %s", etcdStorage.Spec.ClientCertificateValidity.Duration, lifetime)
+	}
+
+	// Renewing certificates doesn't rotate signers.
+	for _, rotation := range []*v1beta1.CertificateRotation{etcdStorage.Status.ServerCertificates, etcdStorage.Status.ClientCertificates} {
+		if rotation == nil || rotation.Signer == "" || rotation.Phase != "" {
+			t.Fatalf("expected signer without rotation phase in status, but got %+v", rotation)
+		}
+	}
+}
+
+func TestServerSignerRotationPhases(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("rotation-test-2")
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	if err := c.ensureServerCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	oldSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+	serverCert := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage))
+
+	// Changing the signing certificate validity rotates the Server signer. The new Server signer is distributed
+	// in the Serving CA bundle, while the Server certificate is still signed by the old Server signer.
+	clock.step(time.Hour)
+	etcdStorage.Spec.SigningCertificateValidity = metav1.Duration{time.Hour * 24 * 200}
+	if err := c.ensureServerCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	newSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+	if newSigner.Certificates[0].Equal(oldSigner.Certificates[0]) {
+		t.Fatal("expected server signer to be rotated")
+	}
+	rotation := etcdStorage.Status.ServerCertificates
+	if rotation.Phase != v1beta1.CertificateRotationCADistributed ||
+		rotation.Signer != newSigner.Certificates[0].Subject.CommonName ||
+		rotation.PreviousSigner != oldSigner.Certificates[0].Subject.CommonName {
+		t.Fatalf("expected CADistributed rotation phase, but got %+v", rotation)
+	}
+	if !getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage)).Certificates[0].Equal(serverCert.Certificates[0]) {
+		t.Fatal("expected server certificate not to be reissued before the new server signer is distributed")
+	}
+	servingCA := getConfigMapBundle(t, c, "k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt")
+	if !containsCertificate(servingCA.Certificates, oldSigner.Certificates[0]) || !containsCertificate(servingCA.Certificates, newSigner.Certificates[0]) {
+		t.Fatal("expected both old and new server signers in the serving CA bundle")
+	}
+
+	// Old CA certificates are not removed while the new Server signer is being distributed.
+	if err := c.removeStaleServingCAs(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	servingCA = getConfigMapBundle(t, c, "k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt")
+	if !containsCertificate(servingCA.Certificates, oldSigner.Certificates[0]) {
+		t.Fatal("expected old server signer to be kept in the serving CA bundle")
+	}
+
+	// The Server certificate is reissued using the new Server signer in the next sync.
+	clock.step(time.Minute)
+	if err := c.ensureServerCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	serverCert = getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage))
+	if err := serverCert.Certificates[0].CheckSignatureFrom(newSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected server certificate signed by the new server signer: %v", err)
+	}
+	if etcdStorage.Status.ServerCertificates.Phase != v1beta1.CertificateRotationLeafReissued {
+		t.Fatalf("expected LeafReissued rotation phase, but got %+v", etcdStorage.Status.ServerCertificates)
+	}
+
+	// Once etcd-proxy pods are rolled out, the old Server signer is removed from the Serving CA bundle.
+	if err := c.removeStaleServingCAs(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	servingCA = getConfigMapBundle(t, c, "k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt")
+	if containsCertificate(servingCA.Certificates, oldSigner.Certificates[0]) || !containsCertificate(servingCA.Certificates, newSigner.Certificates[0]) {
+		t.Fatal("expected only the new server signer in the serving CA bundle")
+	}
+	rotation = etcdStorage.Status.ServerCertificates
+	if rotation.Phase != v1beta1.CertificateRotationOldCARemoved || !rotation.LastTransitionTime.Time.Equal(clock.now) {
+		t.Fatalf("expected OldCARemoved rotation phase, but got %+v", rotation)
+	}
+}
+
+func TestClientSignerRotationPhases(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("rotation-test-3")
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ensureServerCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	oldSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	clientCert := getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert")
+
+	// Changing the signing certificate validity rotates the Client signer, which is distributed in the Client CA bundle.
+	clock.step(time.Hour)
+	etcdStorage.Spec.SigningCertificateValidity = metav1.Duration{time.Hour * 24 * 200}
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	newSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	if newSigner.Certificates[0].Equal(oldSigner.Certificates[0]) {
+		t.Fatal("expected client signer to be rotated")
+	}
+	if etcdStorage.Status.ClientCertificates.Phase != v1beta1.CertificateRotationCADistributed {
+		t.Fatalf("expected CADistributed rotation phase, but got %+v", etcdStorage.Status.ClientCertificates)
+	}
+	clientCA := getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+	if !containsCertificate(clientCA.Certificates, oldSigner.Certificates[0]) || !containsCertificate(clientCA.Certificates, newSigner.Certificates[0]) {
+		t.Fatal("expected both old and new client signers in the client CA bundle")
+	}
+
+	// The Client certificate is not reissued until etcd-proxy pods trusting the new Client signer are rolled out.
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	if !getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert").Certificates[0].Equal(clientCert.Certificates[0]) {
+		t.Fatal("expected client certificate not to be reissued before etcd-proxy pods are rolled out")
+	}
+
+	certificatesHash, err := c.proxyCertificatesHash(etcdStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
+	deploymentIndexer.Add(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName(etcdStorage),
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name, etcdProxyConfig.ProxyImage,
+				etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName, etcdProxyConfig.CoreEtcd.URLs,
+				certificatesHash, nil).Spec.Template,
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	})
+	c.deploymentsLister = dslisters.NewDeploymentLister(deploymentIndexer)
+
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	clientCert = getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert")
+	if err := clientCert.Certificates[0].CheckSignatureFrom(newSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected client certificate signed by the new client signer: %v", err)
+	}
+	if etcdStorage.Status.ClientCertificates.Phase != v1beta1.CertificateRotationLeafReissued {
+		t.Fatalf("expected LeafReissued rotation phase, but got %+v", etcdStorage.Status.ClientCertificates)
+	}
+
+	// The old Client signer is removed from the Client CA bundle in the next sync.
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+	clientCA = getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+	if containsCertificate(clientCA.Certificates, oldSigner.Certificates[0]) || !containsCertificate(clientCA.Certificates, newSigner.Certificates[0]) {
+		t.Fatal("expected only the new client signer in the client CA bundle")
+	}
+	rotation := etcdStorage.Status.ClientCertificates
+	if rotation.Phase != v1beta1.CertificateRotationOldCARemoved || rotation.PreviousSigner != oldSigner.Certificates[0].Subject.CommonName {
+		t.Fatalf("expected OldCARemoved rotation phase, but got %+v", rotation)
+	}
+}
+
+func TestSignerRotationAllPhases(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("rotation-test-4")
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	// Rotation phases are recorded as they change.
+	var serverPhases, clientPhases []v1beta1.CertificateRotationPhase
+	recordPhase := func(phases []v1beta1.CertificateRotationPhase, rotation *v1beta1.CertificateRotation) []v1beta1.CertificateRotationPhase {
+		if rotation.Phase != "" && (len(phases) == 0 || phases[len(phases)-1] != rotation.Phase) {
+			phases = append(phases, rotation.Phase)
+		}
+		return phases
+	}
+
+	// sync handles certificates in the same order as syncHandler. etcd-proxy pods are rolled out immediately
+	// whenever the certificates hash changes.
+	sync := func() {
+		if err := c.ensureClientCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ensureServerCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		serverPhases = recordPhase(serverPhases, etcdStorage.Status.ServerCertificates)
+		clientPhases = recordPhase(clientPhases, etcdStorage.Status.ClientCertificates)
+		certificatesHash, err := c.proxyCertificatesHash(etcdStorage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deploymentIndexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{})
+		deploymentIndexer.Add(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      deploymentName(etcdStorage),
+				Namespace: etcdProxyConfig.ControllerNamespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: newDeployment(etcdStorage, etcdProxyConfig.ControllerNamespace, etcdStorage.Name, etcdProxyConfig.ProxyImage,
+					etcdProxyConfig.CoreEtcd.CAConfigMapName, etcdProxyConfig.CoreEtcd.CertSecretName, etcdProxyConfig.CoreEtcd.URLs,
+					certificatesHash, nil).Spec.Template,
+			},
+			Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		})
+		c.deploymentsLister = dslisters.NewDeploymentLister(deploymentIndexer)
+		if err := c.removeStaleServingCAs(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		serverPhases = recordPhase(serverPhases, etcdStorage.Status.ServerCertificates)
+	}
+
+	sync()
+	oldClientSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	oldServerSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+
+	// Sync every day for 300 days, so half of the signing certificate lifetime passes and signers are rotated once,
+	// while Client and Server certificates are renewed on time.
+	for i := 0; i < 300; i++ {
+		clock.step(time.Hour * 24)
+		sync()
+	}
+
+	expectedPhases := []v1beta1.CertificateRotationPhase{
+		v1beta1.CertificateRotationCADistributed,
+		v1beta1.CertificateRotationLeafReissued,
+		v1beta1.CertificateRotationOldCARemoved,
+	}
+	if !reflect.DeepEqual(serverPhases, expectedPhases) {
+		t.Fatalf("expected server rotation phases %v, but got %v", expectedPhases, serverPhases)
+	}
+	if !reflect.DeepEqual(clientPhases, expectedPhases) {
+		t.Fatalf("expected client rotation phases %v, but got %v", expectedPhases, clientPhases)
+	}
+
+	clientSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	serverSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+	if etcdStorage.Status.ClientCertificates.PreviousSigner != oldClientSigner.Certificates[0].Subject.CommonName ||
+		etcdStorage.Status.ClientCertificates.Signer != clientSigner.Certificates[0].Subject.CommonName {
+		t.Fatalf("expected client rotation from the old to the new client signer, but got %+v", etcdStorage.Status.ClientCertificates)
+	}
+	if etcdStorage.Status.ServerCertificates.PreviousSigner != oldServerSigner.Certificates[0].Subject.CommonName ||
+		etcdStorage.Status.ServerCertificates.Signer != serverSigner.Certificates[0].Subject.CommonName {
+		t.Fatalf("expected server rotation from the old to the new server signer, but got %+v", etcdStorage.Status.ServerCertificates)
+	}
+
+	// CA bundles shrink back to the new signing certificates only.
+	clientCA := getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+	if len(clientCA.Certificates) != 1 || !clientCA.Certificates[0].Equal(clientSigner.Certificates[0]) {
+		t.Fatalf("expected only the new client signer in the client CA bundle, but got %d certificates", len(clientCA.Certificates))
+	}
+	servingCA := getConfigMapBundle(t, c, "k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt")
+	if len(servingCA.Certificates) != 1 || !servingCA.Certificates[0].Equal(serverSigner.Certificates[0]) {
+		t.Fatalf("expected only the new server signer in the serving CA bundle, but got %d certificates", len(servingCA.Certificates))
+	}
+
+	// Certificates in use are signed by the new signing certificates.
+	if err := getSecretCertificate(t, c, "k8s-sample-apiserver", "etcd-client-cert").Certificates[0].CheckSignatureFrom(clientSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected client certificate signed by the new client signer: %v", err)
+	}
+	if err := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage)).Certificates[0].CheckSignatureFrom(serverSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected server certificate signed by the new server signer: %v", err)
+	}
+}
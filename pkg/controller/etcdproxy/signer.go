@@ -0,0 +1,103 @@
+package etcdproxy
+
+import (
+	"crypto/x509/pkix"
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// SigningCertificateRotated is used as part of the Event reason when the self-generated signing certificate
+	// is rotated.
+	SigningCertificateRotated = "SigningCertificateRotated"
+)
+
+// signerKind represents kind of the self-generated signing certificate.
+type signerKind string
+
+const (
+	// clientSigner signs etcd-proxy Client certificates.
+	clientSigner signerKind = "client"
+	// serverSigner signs etcd-proxy Server certificates.
+	serverSigner signerKind = "server"
+)
+
+// signingCertKeyPair returns the self-generated signing certificate/key pair of the provided kind, stored in the Secret
+// named etcdstorageName-<kind>-signer in the controller namespace. The signing certificate is reused for issuing
+// certificates as long as the renewal fraction of its lifetime hasn't passed, the signing certificate validity in
+// the EtcdStorage spec hasn't changed, and it stays valid until certificates signed now are renewed, i.e. for
+// the renewal fraction of the provided validity of certificates to be signed. Certificates signed by it may expire
+// after it, but they are renewed before it expires.
+//
+// Otherwise, or if rotate is set, the signing certificate is rotated: a new signing certificate is generated and stored in the Secret,
+// replacing the previous one. Callers are responsible for distributing the new signing certificate in CA bundles.
+// Certificates signed by the previous signing certificate stay trusted until they are reissued, as it's kept in
+// CA bundles.
+func (c *EtcdProxyController) signingCertKeyPair(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind signerKind, validity time.Duration, rotate bool) (*certs.Certificate, error) {
+	currentTime := c.currentTime
+	secretName := signerSecretName(etcdstorage, kind)
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(c.config.ControllerNamespace).Get(secretName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && !rotate {
+		signer, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], secret.Data["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %s signer from secret %s: %v", kind, secretName, err)
+		}
+		renewalWindow := time.Duration(float64(validity) * c.renewalFraction())
+		if signer.Certificates[0].NotAfter.Sub(currentTime()) > renewalWindow &&
+			c.renewalReason(signer.Certificates[0], etcdstorage.Spec.SigningCertificateValidity.Duration, true) == "" {
+			return signer, nil
+		}
+	}
+
+	serviceUrl := fmt.Sprintf("%s.%s.svc", serviceName(etcdstorage), c.config.ControllerNamespace)
+	signer, err := certs.NewCACertificate(pkix.Name{
+		CommonName: fmt.Sprintf("%s-%s-signer-%v", serviceUrl, kind, currentTime().Unix()),
+	}, etcdstorage.Spec.SigningCertificateValidity, keyAlgorithm(etcdstorage), currentTime)
+	if err != nil {
+		return nil, err
+	}
+	signerCertBytes, signerKeyBytes, err := signer.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+	err = ensureSecret(c.kubeclientset, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: c.config.ControllerNamespace,
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": signerCertBytes,
+			"tls.key": signerKeyBytes,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.recorder.Event(etcdstorage, v1.EventTypeNormal, SigningCertificateRotated,
+		fmt.Sprintf("Generated new %s signing certificate %s valid until %s", kind, signer.Certificates[0].Subject.CommonName,
+			signer.Certificates[0].NotAfter.Format(time.RFC3339)))
+
+	return signer, nil
+}
+
+// signerSecretName calculates name to be used to create a Secret in the controller namespace for storing
+// the self-generated signing certificate/key pair of the provided kind.
+func signerSecretName(etcdstorage *etcdstoragev1beta1.EtcdStorage, kind signerKind) string {
+	if kind == clientSigner {
+		return etcdProxyClientSignerSecretName(etcdstorage)
+	}
+	return etcdProxyServerSignerSecretName(etcdstorage)
+}
@@ -0,0 +1,269 @@
+package etcdproxy
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+func newTestSignerEtcdStorage(name string) *v1beta1.EtcdStorage {
+	return &v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1beta1.EtcdStorageSpec{
+			CACertConfigMaps: []v1beta1.CABundleDestination{
+				{
+					Name:      "etcd-serving-ca",
+					Namespace: "k8s-sample-apiserver",
+				},
+			},
+			ClientCertSecrets: []v1beta1.ClientCertificateDestination{
+				{
+					Name:      "etcd-client-cert",
+					Namespace: "k8s-sample-apiserver",
+				},
+			},
+			SigningCertificateValidity: metav1.Duration{time.Hour * 24 * 365},
+			ServingCertificateValidity: metav1.Duration{time.Hour * 24 * 30},
+			ClientCertificateValidity:  metav1.Duration{time.Hour * 24 * 30},
+		},
+	}
+}
+
+func newTestSignerConfig() *EtcdProxyControllerConfig {
+	return &EtcdProxyControllerConfig{
+		CoreEtcd: &CoreEtcdConfig{
+			URLs:            []string{"https://test.etcd.svc:2379"},
+			CAConfigMapName: "etcd-coreserving-ca",
+			CertSecretName:  "etcd-coreserving-cert",
+		},
+		ControllerNamespace: "test-storage",
+		ProxyImage:          "quay.io/coreos/etcd:v3.2.18",
+	}
+}
+
+func TestSigningCertificatesReused(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("signer-test-1")
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	c.currentTime = newFakeClock().currentTime
+
+	getCertificate := func(namespace, name string) *certs.Certificate {
+		secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := certs.ParseCertificateBytes(secret.Data["tls.crt"], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	getBundle := func(namespace, name, key string) *certs.Certificate {
+		configMap, err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle, err := certs.ParseCertificateBytes([]byte(configMap.Data[key]), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bundle
+	}
+
+	// Issue certificates twice. Deleting the Secrets makes the controller issue new Server and Client certificates.
+	var clientCerts, serverCerts []*certs.Certificate
+	for i := 0; i < 2; i++ {
+		if err := c.ensureClientCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ensureServerCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		clientCerts = append(clientCerts, getCertificate("k8s-sample-apiserver", "etcd-client-cert"))
+		serverCerts = append(serverCerts, getCertificate(etcdProxyConfig.ControllerNamespace, etcdProxyServerCertsSecret(etcdStorage)))
+
+		if err := c.kubeclientset.CoreV1().Secrets("k8s-sample-apiserver").Delete("etcd-client-cert", &metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Delete(etcdProxyServerCertsSecret(etcdStorage), &metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if clientCerts[0].Certificates[0].Equal(clientCerts[1].Certificates[0]) || serverCerts[0].Certificates[0].Equal(serverCerts[1].Certificates[0]) {
+		t.Fatal("expected new server and client certificates to be issued")
+	}
+
+	// Both Client certificates are signed by the same stored Client signer, and the Client CA bundle is not grown.
+	clientSignerCert := getCertificate(etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	for _, clientCert := range clientCerts {
+		if err := clientCert.Certificates[0].CheckSignatureFrom(clientSignerCert.Certificates[0]); err != nil {
+			t.Fatalf("expected client certificate signed by the stored client signer: %v", err)
+		}
+	}
+	clientCA := getBundle(etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt")
+	if len(clientCA.Certificates) != 1 {
+		t.Fatalf("expected 1 certificate in the client CA bundle, but got %d", len(clientCA.Certificates))
+	}
+
+	// Both Server certificates are signed by the same stored Server signer, and the Serving CA bundle still contains
+	// only the first Server certificate and the Server signer.
+	serverSignerCert := getCertificate(etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+	for _, serverCert := range serverCerts {
+		if err := serverCert.Certificates[0].CheckSignatureFrom(serverSignerCert.Certificates[0]); err != nil {
+			t.Fatalf("expected server certificate signed by the stored server signer: %v", err)
+		}
+	}
+	servingCA := getBundle("k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt")
+	if len(servingCA.Certificates) != 2 {
+		t.Fatalf("expected 2 certificates (ca + server) in the serving CA bundle, but got %d", len(servingCA.Certificates))
+	}
+	if !containsCertificate(servingCA.Certificates, serverSignerCert.Certificates[0]) {
+		t.Fatal("expected server signer in the serving CA bundle")
+	}
+}
+
+func TestSigningCertificateRotation(t *testing.T) {
+	etcdStorage := newTestSignerEtcdStorage("signer-test-2")
+	etcdProxyConfig := newTestSignerConfig()
+
+	clock := newFakeClock()
+
+	// The stored Client signer expires before a new Client certificate would be renewed, so it has to be rotated.
+	oldSigner, err := certs.NewCACertificate(pkix.Name{CommonName: "old-client-signer"}, metav1.Duration{time.Hour * 24 * 10}, "", clock.currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSignerCertBytes, oldSignerKeyBytes, err := oldSigner.GetPEMBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdProxyClientSignerSecretName(etcdStorage),
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": oldSignerCertBytes,
+			"tls.key": oldSignerKeyBytes,
+		},
+	}
+	clientCAConfigMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdProxyCAConfigMapName(etcdStorage),
+			Namespace: etcdProxyConfig.ControllerNamespace,
+		},
+		Data: map[string]string{
+			"client-ca.crt": string(oldSignerCertBytes),
+		},
+	}
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage, signerSecret, clientCAConfigMap})
+	c.currentTime = clock.currentTime
+
+	if err := c.ensureClientCertificates(etcdStorage); err != nil {
+		t.Fatal(err)
+	}
+
+	signerSecret, err = c.kubeclientset.CoreV1().Secrets(etcdProxyConfig.ControllerNamespace).Get(etcdProxyClientSignerSecretName(etcdStorage), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSigner, err := certs.ParseCertificateBytes(signerSecret.Data["tls.crt"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSigner.Certificates[0].Equal(oldSigner.Certificates[0]) {
+		t.Fatal("expected client signer to be rotated")
+	}
+	if !newSigner.Certificates[0].NotAfter.After(clock.now.Add(etcdStorage.Spec.ClientCertificateValidity.Duration)) {
+		t.Fatal("expected new client signer to outlive client certificates")
+	}
+
+	// The new Client signer is distributed along with the old one, which stays trusted until it expires.
+	clientCAConfigMap, err = c.kubeclientset.CoreV1().ConfigMaps(etcdProxyConfig.ControllerNamespace).Get(etcdProxyCAConfigMapName(etcdStorage), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA, err := certs.ParseCertificateBytes([]byte(clientCAConfigMap.Data["client-ca.crt"]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsCertificate(clientCA.Certificates, newSigner.Certificates[0]) || !containsCertificate(clientCA.Certificates, oldSigner.Certificates[0]) {
+		t.Fatal("expected both old and new client signers in the client CA bundle")
+	}
+
+	clientSecret, err := c.kubeclientset.CoreV1().Secrets("k8s-sample-apiserver").Get("etcd-client-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := certs.ParseCertificateBytes(clientSecret.Data["tls.crt"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clientCert.Certificates[0].CheckSignatureFrom(newSigner.Certificates[0]); err != nil {
+		t.Fatalf("expected client certificate signed by the new client signer: %v", err)
+	}
+}
+
+func TestSigningCertificateReusedWithEqualValidities(t *testing.T) {
+	// The signing certificate validity is the same as the Serving and Client certificate validities,
+	// like in the example EtcdStorage.
+	etcdStorage := newTestSignerEtcdStorage("signer-test-3")
+	etcdStorage.Spec.SigningCertificateValidity = metav1.Duration{time.Hour * 730}
+	etcdStorage.Spec.ServingCertificateValidity = metav1.Duration{time.Hour * 730}
+	etcdStorage.Spec.ClientCertificateValidity = metav1.Duration{time.Hour * 730}
+	etcdProxyConfig := newTestSignerConfig()
+	c := newEtcdProxyControllerMock(etcdProxyConfig, []runtime.Object{etcdStorage})
+	clock := newFakeClock()
+	c.currentTime = clock.currentTime
+
+	ensureCertificates := func() {
+		if err := c.ensureClientCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ensureServerCertificates(etcdStorage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ensureCertificates()
+	clientSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage))
+	serverSigner := getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage))
+
+	// Signing certificates are reused on every sync until the renewal fraction of their lifetime passes,
+	// so CA bundles don't grow.
+	for _, step := range []time.Duration{0, time.Second, time.Hour, time.Hour * 100, time.Hour * 200} {
+		clock.step(step)
+		ensureCertificates()
+
+		if !getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage)).Certificates[0].Equal(clientSigner.Certificates[0]) {
+			t.Fatalf("expected client signer to be reused at %s", clock.now)
+		}
+		if !getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage)).Certificates[0].Equal(serverSigner.Certificates[0]) {
+			t.Fatalf("expected server signer to be reused at %s", clock.now)
+		}
+		if clientCA := getConfigMapBundle(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyCAConfigMapName(etcdStorage), "client-ca.crt"); len(clientCA.Certificates) != 1 {
+			t.Fatalf("expected 1 certificate in the client CA bundle at %s, but got %d", clock.now, len(clientCA.Certificates))
+		}
+		if servingCA := getConfigMapBundle(t, c, "k8s-sample-apiserver", "etcd-serving-ca", "serving-ca.crt"); len(servingCA.Certificates) != 2 {
+			t.Fatalf("expected 2 certificates (ca + server) in the serving CA bundle at %s, but got %d", clock.now, len(servingCA.Certificates))
+		}
+	}
+
+	// Once half of the signing certificate lifetime passes, signing certificates are rotated.
+	clock.step(time.Hour * 70)
+	ensureCertificates()
+	if getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyClientSignerSecretName(etcdStorage)).Certificates[0].Equal(clientSigner.Certificates[0]) {
+		t.Fatal("expected client signer to be rotated")
+	}
+	if getSecretCertificate(t, c, etcdProxyConfig.ControllerNamespace, etcdProxyServerSignerSecretName(etcdStorage)).Certificates[0].Equal(serverSigner.Certificates[0]) {
+		t.Fatal("expected server signer to be rotated")
+	}
+}
@@ -0,0 +1,200 @@
+package etcdproxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// ValidateEtcdStorage validates the EtcdStorage against rules that can't be expressed by the CRD schema:
+// * Serving and Client certificates must not be valid longer than the signing certificate.
+// * CA bundle and Client certificate destinations must be unique among all EtcdStorages.
+// * Destinations must not conflict with the CA bundle ConfigMaps and Server certificate Secrets created by
+// the controller in the controller namespace, for this or any other EtcdStorage.
+// * The core etcd prefix of the EtcdStorage must not overlap with prefixes of other EtcdStorages.
+// * Serial numbers of revoked Client certificates must be valid and unique, and Client certificates can't be revoked
+// if the Issuer is set, as the controller can't rotate the issuer CA certificate.
+// The etcdstorages argument contains all existing EtcdStorages. The EtcdStorage with the same name as the validated
+// one is skipped, so updates can be validated as well.
+func ValidateEtcdStorage(etcdstorage *etcdstoragev1beta1.EtcdStorage, etcdstorages []etcdstoragev1beta1.EtcdStorage,
+	controllerNamespace string) field.ErrorList {
+	var others []etcdstoragev1beta1.EtcdStorage
+	for _, other := range etcdstorages {
+		if other.Name != etcdstorage.Name {
+			others = append(others, other)
+		}
+	}
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateCertificateValidity(&etcdstorage.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateRevokedClientCertificates(&etcdstorage.Spec, field.NewPath("spec", "revokedClientCertificates"))...)
+	allErrs = append(allErrs, validateDestinations(etcdstorage, others, controllerNamespace, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateEtcdStorageName(etcdstorage, others, controllerNamespace, field.NewPath("metadata", "name"))...)
+
+	return allErrs
+}
+
+// validateCertificateValidity checks are certificate validities non-negative and are Serving and Client certificates
+// valid shorter than the signing certificate.
+func validateCertificateValidity(spec *etcdstoragev1beta1.EtcdStorageSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	signing := spec.SigningCertificateValidity.Duration
+	if signing < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("signingCertificateValidity"), signing.String(), "must not be negative"))
+	}
+
+	validities := []struct {
+		name     string
+		validity time.Duration
+	}{
+		{"servingCertificateValidity", spec.ServingCertificateValidity.Duration},
+		{"clientCertificateValidity", spec.ClientCertificateValidity.Duration},
+	}
+	for _, v := range validities {
+		switch {
+		case v.validity < 0:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(v.name), v.validity.String(), "must not be negative"))
+		case v.validity > signing:
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(v.name), v.validity.String(),
+				fmt.Sprintf("must not be longer than signingCertificateValidity (%s)", signing)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateRevokedClientCertificates checks are serial numbers of revoked Client certificates valid hexadecimal
+// numbers, and is each of them revoked only once. Client certificates signed by the Issuer can't be revoked.
+func validateRevokedClientCertificates(spec *etcdstoragev1beta1.EtcdStorageSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(spec.RevokedClientCertificates) != 0 && spec.Issuer != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "client certificates signed by the issuer can't be revoked, the issuer has to be rotated instead"))
+	}
+
+	serialNumbers := map[string]bool{}
+	for i, r := range spec.RevokedClientCertificates {
+		idxPath := fldPath.Index(i).Child("serialNumber")
+		serialNumber, err := certs.ParseSerialNumber(r.SerialNumber)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(idxPath, r.SerialNumber, "must be a positive hexadecimal number"))
+			continue
+		}
+		if serialNumbers[serialNumber.String()] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, r.SerialNumber))
+		}
+		serialNumbers[serialNumber.String()] = true
+	}
+
+	return allErrs
+}
+
+// validateDestinations checks are CA bundle and Client certificate destinations unique, both within the EtcdStorage
+// and among all EtcdStorages, and do they conflict with ConfigMaps and Secrets created by the controller in
+// the controller namespace.
+func validateDestinations(etcdstorage *etcdstoragev1beta1.EtcdStorage, others []etcdstoragev1beta1.EtcdStorage,
+	controllerNamespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	etcdstorages := append([]etcdstoragev1beta1.EtcdStorage{*etcdstorage}, others...)
+	controllerConfigMaps := map[string]string{}
+	controllerSecrets := map[string]string{}
+	for i := range etcdstorages {
+		controllerConfigMaps[etcdProxyCAConfigMapName(&etcdstorages[i])] = etcdstorages[i].Name
+		controllerSecrets[etcdProxyServerCertsSecret(&etcdstorages[i])] = etcdstorages[i].Name
+		controllerSecrets[etcdProxyClientSignerSecretName(&etcdstorages[i])] = etcdstorages[i].Name
+		controllerSecrets[etcdProxyServerSignerSecretName(&etcdstorages[i])] = etcdstorages[i].Name
+	}
+
+	// Destinations of other EtcdStorages, as the controller would overwrite them with certificates of each EtcdStorage.
+	otherConfigMaps := map[string]string{}
+	otherSecrets := map[string]string{}
+	for _, other := range others {
+		for _, dest := range other.Spec.CACertConfigMaps {
+			otherConfigMaps[dest.Namespace+"/"+dest.Name] = other.Name
+		}
+		for _, dest := range other.Spec.ClientCertSecrets {
+			otherSecrets[dest.Namespace+"/"+dest.Name] = other.Name
+		}
+	}
+
+	configMaps := map[string]bool{}
+	for i, dest := range etcdstorage.Spec.CACertConfigMaps {
+		idxPath := fldPath.Child("caCertConfigMaps").Index(i)
+		key := dest.Namespace + "/" + dest.Name
+		if configMaps[key] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, key))
+		}
+		configMaps[key] = true
+
+		if owner, ok := otherConfigMaps[key]; ok {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, fmt.Sprintf("already used by the EtcdStorage '%s'", owner)))
+		}
+
+		if owner, ok := controllerConfigMaps[dest.Name]; ok && dest.Namespace == controllerNamespace {
+			allErrs = append(allErrs, field.Invalid(idxPath, key,
+				fmt.Sprintf("conflicts with the CA bundle ConfigMap of the EtcdStorage '%s'", owner)))
+		}
+	}
+
+	secrets := map[string]bool{}
+	for i, dest := range etcdstorage.Spec.ClientCertSecrets {
+		idxPath := fldPath.Child("clientCertSecrets").Index(i)
+		key := dest.Namespace + "/" + dest.Name
+		if secrets[key] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, key))
+		}
+		secrets[key] = true
+
+		if owner, ok := otherSecrets[key]; ok {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, fmt.Sprintf("already used by the EtcdStorage '%s'", owner)))
+		}
+
+		if owner, ok := controllerSecrets[dest.Name]; ok && dest.Namespace == controllerNamespace {
+			allErrs = append(allErrs, field.Invalid(idxPath, key,
+				fmt.Sprintf("conflicts with the Server certificate Secret of the EtcdStorage '%s'", owner)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateEtcdStorageName checks do the ConfigMaps and Secrets created by the controller for the EtcdStorage conflict
+// with destinations of other EtcdStorages, and does the core etcd prefix overlap with prefixes of other EtcdStorages.
+func validateEtcdStorageName(etcdstorage *etcdstoragev1beta1.EtcdStorage, others []etcdstoragev1beta1.EtcdStorage,
+	controllerNamespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	caConfigMapName := etcdProxyCAConfigMapName(etcdstorage)
+	serverCertsSecretName := etcdProxyServerCertsSecret(etcdstorage)
+	prefix := etcdPrefix(etcdstorage)
+	for i := range others {
+		other := &others[i]
+		for _, dest := range other.Spec.CACertConfigMaps {
+			if dest.Namespace == controllerNamespace && dest.Name == caConfigMapName {
+				allErrs = append(allErrs, field.Invalid(fldPath, etcdstorage.Name,
+					fmt.Sprintf("CA bundle ConfigMap '%s/%s' conflicts with a destination of the EtcdStorage '%s'", dest.Namespace, dest.Name, other.Name)))
+			}
+		}
+		for _, dest := range other.Spec.ClientCertSecrets {
+			if dest.Namespace == controllerNamespace && dest.Name == serverCertsSecretName {
+				allErrs = append(allErrs, field.Invalid(fldPath, etcdstorage.Name,
+					fmt.Sprintf("Server certificate Secret '%s/%s' conflicts with a destination of the EtcdStorage '%s'", dest.Namespace, dest.Name, other.Name)))
+			}
+		}
+
+		otherPrefix := etcdPrefix(other)
+		if strings.HasPrefix(prefix, otherPrefix) || strings.HasPrefix(otherPrefix, prefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath, etcdstorage.Name,
+				fmt.Sprintf("core etcd prefix '%s' overlaps with the prefix '%s' of the EtcdStorage '%s'", prefix, otherPrefix, other.Name)))
+		}
+	}
+
+	return allErrs
+}
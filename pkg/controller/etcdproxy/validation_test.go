@@ -0,0 +1,164 @@
+package etcdproxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func newTestValidationEtcdStorage(name string, configMaps []v1beta1.CABundleDestination, secrets []v1beta1.ClientCertificateDestination) v1beta1.EtcdStorage {
+	return v1beta1.EtcdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1beta1.EtcdStorageSpec{
+			CACertConfigMaps:           configMaps,
+			ClientCertSecrets:          secrets,
+			SigningCertificateValidity: metav1.Duration{Duration: 24 * time.Hour},
+			ServingCertificateValidity: metav1.Duration{Duration: 8 * time.Hour},
+			ClientCertificateValidity:  metav1.Duration{Duration: 8 * time.Hour},
+		},
+	}
+}
+
+func TestValidateEtcdStorage(t *testing.T) {
+	configMap := func(namespace, name string) []v1beta1.CABundleDestination {
+		return []v1beta1.CABundleDestination{{Name: name, Namespace: namespace}}
+	}
+	secret := func(namespace, name string) []v1beta1.ClientCertificateDestination {
+		return []v1beta1.ClientCertificateDestination{{Name: name, Namespace: namespace}}
+	}
+
+	longServingValidity := newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client"))
+	longServingValidity.Spec.ServingCertificateValidity.Duration = 48 * time.Hour
+	negativeClientValidity := newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client"))
+	negativeClientValidity.Spec.ClientCertificateValidity.Duration = -time.Hour
+	invalidRevocations := newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client"))
+	invalidRevocations.Spec.RevokedClientCertificates = []v1beta1.RevokedCertificate{
+		{SerialNumber: "3F:2A:9C"}, {SerialNumber: "not-a-serial"}, {SerialNumber: "3f2a9c"},
+	}
+	issuerRevocations := newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client"))
+	issuerRevocations.Spec.Issuer = &v1beta1.IssuerReference{Name: "intermediate-ca", Namespace: "security"}
+	issuerRevocations.Spec.RevokedClientCertificates = []v1beta1.RevokedCertificate{{SerialNumber: "3F2A9C"}}
+
+	tests := []struct {
+		name           string
+		etcdstorage    v1beta1.EtcdStorage
+		etcdstorages   []v1beta1.EtcdStorage
+		expectedErrors []string
+	}{
+		{
+			name:        "valid etcdstorage",
+			etcdstorage: newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+				newTestValidationEtcdStorage("test-2", configMap("p2", "etcd-ca"), secret("p2", "etcd-client")),
+			},
+		},
+		{
+			name:           "serving certificate valid longer than signing certificate",
+			etcdstorage:    longServingValidity,
+			expectedErrors: []string{"spec.servingCertificateValidity: Invalid value: \"48h0m0s\": must not be longer than signingCertificateValidity (24h0m0s)"},
+		},
+		{
+			name:           "negative client certificate validity",
+			etcdstorage:    negativeClientValidity,
+			expectedErrors: []string{"spec.clientCertificateValidity: Invalid value: \"-1h0m0s\": must not be negative"},
+		},
+		{
+			name:        "invalid and duplicate revoked serial numbers",
+			etcdstorage: invalidRevocations,
+			expectedErrors: []string{
+				"spec.revokedClientCertificates[1].serialNumber: Invalid value: \"not-a-serial\": must be a positive hexadecimal number",
+				"spec.revokedClientCertificates[2].serialNumber: Duplicate value: \"3f2a9c\"",
+			},
+		},
+		{
+			name:        "revoked client certificates signed by the issuer",
+			etcdstorage: issuerRevocations,
+			expectedErrors: []string{
+				"spec.revokedClientCertificates: Forbidden: client certificates signed by the issuer can't be revoked, the issuer has to be rotated instead",
+			},
+		},
+		{
+			name: "duplicate destinations",
+			etcdstorage: newTestValidationEtcdStorage("test-1",
+				append(configMap("p1", "etcd-ca"), configMap("p1", "etcd-ca")...),
+				append(secret("p1", "etcd-client"), secret("p1", "etcd-client")...)),
+			expectedErrors: []string{
+				"spec.caCertConfigMaps[1]: Duplicate value: \"p1/etcd-ca\"",
+				"spec.clientCertSecrets[1]: Duplicate value: \"p1/etcd-client\"",
+			},
+		},
+		{
+			name:        "destinations used by another etcdstorage",
+			etcdstorage: newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("test-2", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			},
+			expectedErrors: []string{
+				"spec.caCertConfigMaps[0]: Invalid value: \"p1/etcd-ca\": already used by the EtcdStorage 'test-2'",
+				"spec.clientCertSecrets[0]: Invalid value: \"p1/etcd-client\": already used by the EtcdStorage 'test-2'",
+			},
+		},
+		{
+			name:        "destinations conflict with controller objects",
+			etcdstorage: newTestValidationEtcdStorage("test-1", configMap("test-storage", "test-1-ca-cert"), secret("test-storage", "test-2-server-cert")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("test-2", configMap("p2", "etcd-ca"), secret("p2", "etcd-client")),
+			},
+			expectedErrors: []string{
+				"spec.caCertConfigMaps[0]: Invalid value: \"test-storage/test-1-ca-cert\": conflicts with the CA bundle ConfigMap of the EtcdStorage 'test-1'",
+				"spec.clientCertSecrets[0]: Invalid value: \"test-storage/test-2-server-cert\": conflicts with the Server certificate Secret of the EtcdStorage 'test-2'",
+			},
+		},
+		{
+			name:           "destinations with controller object names in other namespaces",
+			etcdstorage:    newTestValidationEtcdStorage("test-1", configMap("p1", "test-1-ca-cert"), secret("p1", "test-1-server-cert")),
+			expectedErrors: nil,
+		},
+		{
+			name:        "controller objects conflict with destinations of another etcdstorage",
+			etcdstorage: newTestValidationEtcdStorage("test-1", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("test-2", configMap("test-storage", "test-1-ca-cert"), secret("p2", "etcd-client")),
+			},
+			expectedErrors: []string{
+				"metadata.name: Invalid value: \"test-1\": CA bundle ConfigMap 'test-storage/test-1-ca-cert' conflicts with a destination of the EtcdStorage 'test-2'",
+			},
+		},
+		{
+			name:        "overlapping core etcd prefix",
+			etcdstorage: newTestValidationEtcdStorage("foo", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("foo/bar", configMap("p2", "etcd-ca"), secret("p2", "etcd-client")),
+			},
+			expectedErrors: []string{
+				"metadata.name: Invalid value: \"foo\": core etcd prefix '/foo/' overlaps with the prefix '/foo/bar/' of the EtcdStorage 'foo/bar'",
+			},
+		},
+		{
+			name:        "non-overlapping core etcd prefix",
+			etcdstorage: newTestValidationEtcdStorage("foo", configMap("p1", "etcd-ca"), secret("p1", "etcd-client")),
+			etcdstorages: []v1beta1.EtcdStorage{
+				newTestValidationEtcdStorage("foobar", configMap("p2", "etcd-ca"), secret("p2", "etcd-client")),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := ValidateEtcdStorage(&tc.etcdstorage, tc.etcdstorages, "test-storage")
+
+			var errStrings []string
+			for _, err := range errs {
+				errStrings = append(errStrings, err.Error())
+			}
+			if strings.Join(errStrings, "\n") != strings.Join(tc.expectedErrors, "\n") {
+				t.Fatalf("expected errors:\n%s\nbut got:\n%s", strings.Join(tc.expectedErrors, "\n"), strings.Join(errStrings, "\n"))
+			}
+		})
+	}
+}
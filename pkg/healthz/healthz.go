@@ -0,0 +1,70 @@
+package healthz
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// Check is a named health check. The check is healthy if the Check function returns no error.
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Handler returns the HTTP handler running all provided checks. The handler responds with the status of each
+// check, and with the 500 status code if any of checks failed.
+func Handler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var output bytes.Buffer
+		failed := false
+		for _, check := range checks {
+			if err := check.Check(); err != nil {
+				fmt.Fprintf(&output, "[-]%s failed: %v\n", check.Name, err)
+				failed = true
+				continue
+			}
+			fmt.Fprintf(&output, "[+]%s ok\n", check.Name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if failed {
+			glog.V(2).Infof("%s check failed:\n%s", r.URL.Path, output.String())
+			w.WriteHeader(http.StatusInternalServerError)
+			output.WriteString("failed\n")
+		} else {
+			output.WriteString("ok\n")
+		}
+		output.WriteTo(w)
+	})
+}
+
+// Serve starts the HTTP server serving liveness checks on the /healthz path and readiness checks on the /readyz path.
+// The server is stopped once the stopCh is closed.
+func Serve(address string, healthChecks, readinessChecks []Check, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", Handler(healthChecks...))
+	mux.Handle("/readyz", Handler(readinessChecks...))
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+
+	go func() {
+		glog.Infof("Serving health checks on %s", address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("unable to serve health checks: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		if err := server.Close(); err != nil {
+			glog.Errorf("unable to stop health checks server: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	healthy := Check{Name: "healthy", Check: func() error { return nil }}
+	unhealthy := Check{Name: "unhealthy", Check: func() error { return fmt.Errorf("not synced") }}
+
+	tests := []struct {
+		name           string
+		checks         []Check
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "no checks",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok\n",
+		},
+		{
+			name:           "healthy",
+			checks:         []Check{healthy},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[+]healthy ok\nok\n",
+		},
+		{
+			name:           "unhealthy",
+			checks:         []Check{healthy, unhealthy},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "[+]healthy ok\n[-]unhealthy failed: not synced\nfailed\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Handler(tc.checks...).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, but got %d", tc.expectedStatus, w.Code)
+			}
+			if body := w.Body.String(); body != tc.expectedBody {
+				t.Fatalf("expected body '%s', but got '%s'", tc.expectedBody, body)
+			}
+		})
+	}
+}
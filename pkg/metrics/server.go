@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve starts the HTTP server exposing metrics from the provided gatherer on the /metrics path.
+// The server is stopped once the stopCh is closed.
+func Serve(address string, gatherer prometheus.Gatherer, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+
+	go func() {
+		glog.Infof("Serving metrics on %s", address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("unable to serve metrics: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		if err := server.Close(); err != nil {
+			glog.Errorf("unable to stop metrics server: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// workqueueMetricsProvider implements the workqueue.MetricsProvider interface, exposing metrics of named
+// workqueues as Prometheus metrics. The name of the workqueue is set as the 'name' label.
+type workqueueMetricsProvider struct {
+	registerer prometheus.Registerer
+}
+
+// RegisterWorkqueueMetrics sets the Prometheus metrics provider for workqueues. It must be called before
+// workqueues are created, as workqueues created earlier don't expose metrics.
+func RegisterWorkqueueMetrics(registerer prometheus.Registerer) {
+	workqueue.SetProvider(workqueueMetricsProvider{registerer: registerer})
+}
+
+func (p workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	depth := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "etcdproxy",
+		Subsystem:   "workqueue",
+		Name:        "depth",
+		Help:        "Current depth of the workqueue.",
+		ConstLabels: prometheus.Labels{"name": name},
+	})
+	p.register(depth)
+	return depth
+}
+
+func (p workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	adds := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   "etcdproxy",
+		Subsystem:   "workqueue",
+		Name:        "adds_total",
+		Help:        "Total number of adds handled by the workqueue.",
+		ConstLabels: prometheus.Labels{"name": name},
+	})
+	p.register(adds)
+	return adds
+}
+
+func (p workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	latency := prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   "etcdproxy",
+		Subsystem:   "workqueue",
+		Name:        "queue_latency_microseconds",
+		Help:        "How long an item stays in the workqueue before being requested.",
+		ConstLabels: prometheus.Labels{"name": name},
+	})
+	p.register(latency)
+	return latency
+}
+
+func (p workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	workDuration := prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   "etcdproxy",
+		Subsystem:   "workqueue",
+		Name:        "work_duration_microseconds",
+		Help:        "How long processing an item from the workqueue takes.",
+		ConstLabels: prometheus.Labels{"name": name},
+	})
+	p.register(workDuration)
+	return workDuration
+}
+
+func (p workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	retries := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   "etcdproxy",
+		Subsystem:   "workqueue",
+		Name:        "retries_total",
+		Help:        "Total number of retries handled by the workqueue.",
+		ConstLabels: prometheus.Labels{"name": name},
+	})
+	p.register(retries)
+	return retries
+}
+
+// register registers the metric, logging failures instead of panicking, so a metric failing to register
+// doesn't stop the workqueue from working.
+func (p workqueueMetricsProvider) register(collector prometheus.Collector) {
+	if err := p.registerer.Register(collector); err != nil {
+		glog.Errorf("unable to register workqueue metric: %v", err)
+	}
+}
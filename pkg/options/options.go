@@ -2,8 +2,10 @@ package options
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/pflag"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	"github.com/xmudrii/etcdproxy-controller/pkg/controller/etcdproxy"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/clientcmd"
@@ -21,6 +23,77 @@ type CoreEtcdOptions struct {
 	// CertSecretName is the name of the Secret in the controller namespace where Client certificate and key for
 	// the core etcd are stored.
 	CertSecretName string
+
+	// AuthSecretName is the name of the Secret in the controller namespace where the user name and password of
+	// the core etcd user allowed to manage users and roles are stored. If empty, the core etcd authentication is not used.
+	AuthSecretName string
+
+	// SignerSecretName is the name of the Secret in the controller namespace where the core etcd CA certificate and
+	// key are stored. If empty, etcd-proxy pods use the shared core etcd client certificate.
+	SignerSecretName string
+}
+
+// CertificateValidityDefaultsOptions type is used to configure certificate validities used if validities are not
+// set in the EtcdStorage spec.
+type CertificateValidityDefaultsOptions struct {
+	// Signing is the default validity of signing certificates.
+	Signing time.Duration
+
+	// Serving is the default validity of serving certificates.
+	Serving time.Duration
+
+	// Client is the default validity of client certificates.
+	Client time.Duration
+}
+
+// LeaderElectionOptions type is used to configure leader election among multiple controller replicas.
+type LeaderElectionOptions struct {
+	// LeaderElect enables leader election. Only the leader runs the controller workers.
+	LeaderElect bool
+
+	// LockName is the name of the ConfigMap in the controller namespace used as the leader election lock.
+	LockName string
+
+	// LeaseDuration is the duration that non-leader candidates wait before forcing to acquire leadership.
+	LeaseDuration time.Duration
+
+	// RenewDeadline is the duration that the leader retries refreshing leadership before giving up.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is the duration candidates wait between tries of acquiring or renewing leadership.
+	RetryPeriod time.Duration
+}
+
+// WebhookOptions type is used to configure the EtcdStorage validating and conversion webhooks.
+type WebhookOptions struct {
+	// Address is the address on which the validating and conversion webhooks are served.
+	Address string
+
+	// ServiceName is the name of the Service in the controller namespace exposing the webhooks.
+	ServiceName string
+
+	// ConfigurationName is the name of the ValidatingWebhookConfiguration registering the validating webhook.
+	ConfigurationName string
+
+	// CertSecretName is the name of the Secret in the controller namespace where the webhook CA and serving
+	// certificates are stored.
+	CertSecretName string
+
+	// CertificateValidity is how long the webhook CA and serving certificates are valid.
+	CertificateValidity time.Duration
+}
+
+// CSROptions type is used to configure issuing etcd-proxy certificates using the Kubernetes CSR API.
+type CSROptions struct {
+	// Enabled enables issuing certificates using CertificateSigningRequests.
+	Enabled bool
+
+	// SignerCAConfigMapName is the name of the ConfigMap in the controller namespace where the CA certificate of
+	// the cluster signer is stored.
+	SignerCAConfigMapName string
+
+	// AutoApprove enables approving CertificateSigningRequests created by the controller.
+	AutoApprove bool
 }
 
 // EtcdProxyControllerOptions type is used to pass information from cli to the controller.
@@ -36,6 +109,34 @@ type EtcdProxyControllerOptions struct {
 
 	// ProxyImage is name of the etcd image to be used for etcd-proxy Deployments creation.
 	ProxyImage string
+
+	// ProxyPodTemplateConfigMapName is the name of the ConfigMap in the controller namespace containing the default
+	// pod template for etcd-proxy Deployments.
+	ProxyPodTemplateConfigMapName string
+
+	// CertificateValidityDefaults contains certificate validities used if validities are not set in the EtcdStorage spec.
+	CertificateValidityDefaults *CertificateValidityDefaultsOptions
+
+	// CertificateRenewalFraction is the fraction of the certificate lifetime after which the certificate is renewed.
+	CertificateRenewalFraction float64
+
+	// UsageMeasurementPeriod is how often the usage of the core etcd is measured.
+	UsageMeasurementPeriod time.Duration
+
+	// MetricsAddress is the address on which Prometheus metrics are served.
+	MetricsAddress string
+
+	// HealthAddress is the address on which health and readiness checks are served.
+	HealthAddress string
+
+	// LeaderElection contains information needed to elect the leader among multiple controller replicas.
+	LeaderElection *LeaderElectionOptions
+
+	// Webhook contains information needed to serve the EtcdStorage validating and conversion webhooks.
+	Webhook *WebhookOptions
+
+	// CSR contains information needed to issue etcd-proxy certificates using the Kubernetes CSR API.
+	CSR *CSROptions
 }
 
 // NewCoreEtcdOptions returns CoreEtcdOptions struct filled with default values.
@@ -47,13 +148,61 @@ func NewCoreEtcdOptions() *CoreEtcdOptions {
 	}
 }
 
+// NewCertificateValidityDefaultsOptions returns CertificateValidityDefaultsOptions struct filled with default values.
+func NewCertificateValidityDefaultsOptions() *CertificateValidityDefaultsOptions {
+	return &CertificateValidityDefaultsOptions{
+		Signing: etcdstoragev1beta1.DefaultSigningCertificateValidity,
+		Serving: etcdstoragev1beta1.DefaultServingCertificateValidity,
+		Client:  etcdstoragev1beta1.DefaultClientCertificateValidity,
+	}
+}
+
+// NewLeaderElectionOptions returns LeaderElectionOptions struct filled with default values.
+func NewLeaderElectionOptions() *LeaderElectionOptions {
+	return &LeaderElectionOptions{
+		LeaderElect:   true,
+		LockName:      "etcdproxy-controller-leader",
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+}
+
+// NewWebhookOptions returns WebhookOptions struct filled with default values.
+func NewWebhookOptions() *WebhookOptions {
+	return &WebhookOptions{
+		Address:             ":8443",
+		ServiceName:         "etcdproxy-controller-webhook",
+		ConfigurationName:   "etcdproxy-controller",
+		CertSecretName:      "etcdproxy-controller-webhook-cert",
+		CertificateValidity: 365 * 24 * time.Hour,
+	}
+}
+
+// NewCSROptions returns CSROptions struct filled with default values.
+func NewCSROptions() *CSROptions {
+	return &CSROptions{
+		Enabled:               false,
+		SignerCAConfigMapName: "etcdproxy-csr-signer-ca",
+		AutoApprove:           false,
+	}
+}
+
 // NewEtcdProxyControllerOptions returns EtcdProxyControllerOptions struct filled with default values.
 func NewEtcdProxyControllerOptions() *EtcdProxyControllerOptions {
 	return &EtcdProxyControllerOptions{
-		CoreEtcd:            NewCoreEtcdOptions(),
-		ControllerNamespace: "kube-apiserver-storage",
-		KubeconfigPath:      "",
-		ProxyImage:          "quay.io/coreos/etcd:v3.2.24",
+		CoreEtcd:                    NewCoreEtcdOptions(),
+		ControllerNamespace:         "kube-apiserver-storage",
+		KubeconfigPath:              "",
+		ProxyImage:                  "quay.io/coreos/etcd:v3.2.24",
+		CertificateValidityDefaults: NewCertificateValidityDefaultsOptions(),
+		CertificateRenewalFraction:  etcdproxy.DefaultCertificateRenewalFraction,
+		UsageMeasurementPeriod:      5 * time.Minute,
+		MetricsAddress:              ":9090",
+		HealthAddress:               ":8080",
+		LeaderElection:              NewLeaderElectionOptions(),
+		Webhook:                     NewWebhookOptions(),
+		CSR:                         NewCSROptions(),
 	}
 }
 
@@ -62,10 +211,41 @@ func (e *EtcdProxyControllerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVarP(&e.CoreEtcd.URLs, "etcd-core-url", "u", e.CoreEtcd.URLs, "The address of the core etcd server.")
 	fs.StringVar(&e.CoreEtcd.CAConfigMapName, "etcd-core-ca-configmap", e.CoreEtcd.CAConfigMapName, "The name of the ConfigMap where CA is stored.")
 	fs.StringVar(&e.CoreEtcd.CertSecretName, "etcd-core-certs-secret", e.CoreEtcd.CertSecretName, "The name of the Secret where client certificates are stored.")
+	fs.StringVar(&e.CoreEtcd.AuthSecretName, "etcd-core-auth-secret", e.CoreEtcd.AuthSecretName, "The name of the Secret where the user name and password of the core etcd user allowed to manage users and roles are stored. If set, a core etcd user and role restricted to the EtcdStorage prefix are provisioned for each EtcdStorage.")
+	fs.StringVar(&e.CoreEtcd.SignerSecretName, "etcd-core-signer-secret", e.CoreEtcd.SignerSecretName, "The name of the Secret where the core etcd CA certificate and key are stored. If set, a core etcd client certificate authenticating as the user restricted to the EtcdStorage prefix is issued for each EtcdStorage.")
 
 	fs.StringVarP(&e.ControllerNamespace, "namespace", "n", e.ControllerNamespace, "Name of the namespace where controller is deployed.")
 	fs.StringVarP(&e.KubeconfigPath, "kubeconfig", "k", e.KubeconfigPath, "Path to kubeconfig (required only if running out-of-cluster).")
 	fs.StringVar(&e.ProxyImage, "etcd-proxy-image", e.ProxyImage, "The image to be used for creating etcd proxy pods.")
+	fs.StringVar(&e.ProxyPodTemplateConfigMapName, "proxy-pod-template-configmap", e.ProxyPodTemplateConfigMapName,
+		"The name of the ConfigMap in the controller namespace containing the default pod template for etcd proxy pods under the template.yaml key.")
+	fs.DurationVar(&e.CertificateValidityDefaults.Signing, "default-signing-certificate-validity", e.CertificateValidityDefaults.Signing,
+		"The signing certificate validity used if not set in the EtcdStorage spec.")
+	fs.DurationVar(&e.CertificateValidityDefaults.Serving, "default-serving-certificate-validity", e.CertificateValidityDefaults.Serving,
+		"The serving certificate validity used if not set in the EtcdStorage spec.")
+	fs.DurationVar(&e.CertificateValidityDefaults.Client, "default-client-certificate-validity", e.CertificateValidityDefaults.Client,
+		"The client certificate validity used if not set in the EtcdStorage spec.")
+	fs.Float64Var(&e.CertificateRenewalFraction, "certificate-renewal-fraction", e.CertificateRenewalFraction,
+		"The fraction of the certificate lifetime after which etcd-proxy certificates and signing certificates are renewed.")
+	fs.DurationVar(&e.UsageMeasurementPeriod, "usage-measurement-period", e.UsageMeasurementPeriod, "How often the usage of the core etcd is measured.")
+	fs.StringVar(&e.MetricsAddress, "metrics-address", e.MetricsAddress, "The address on which Prometheus metrics are served. Empty to disable serving metrics.")
+	fs.StringVar(&e.HealthAddress, "health-address", e.HealthAddress, "The address on which /healthz and /readyz checks are served. Empty to disable serving checks.")
+
+	fs.BoolVar(&e.LeaderElection.LeaderElect, "leader-elect", e.LeaderElection.LeaderElect, "Elect a leader before running workers. Required when running multiple controller replicas.")
+	fs.StringVar(&e.LeaderElection.LockName, "leader-elect-lock-name", e.LeaderElection.LockName, "The name of the ConfigMap in the controller namespace used as the leader election lock.")
+	fs.DurationVar(&e.LeaderElection.LeaseDuration, "leader-elect-lease-duration", e.LeaderElection.LeaseDuration, "The duration that non-leader candidates wait before forcing to acquire leadership.")
+	fs.DurationVar(&e.LeaderElection.RenewDeadline, "leader-elect-renew-deadline", e.LeaderElection.RenewDeadline, "The duration that the leader retries refreshing leadership before giving up.")
+	fs.DurationVar(&e.LeaderElection.RetryPeriod, "leader-elect-retry-period", e.LeaderElection.RetryPeriod, "The duration candidates wait between tries of acquiring or renewing leadership.")
+
+	fs.StringVar(&e.Webhook.Address, "webhook-address", e.Webhook.Address, "The address on which the EtcdStorage validating and conversion webhooks are served.")
+	fs.StringVar(&e.Webhook.ServiceName, "webhook-service", e.Webhook.ServiceName, "The name of the Service in the controller namespace exposing the webhooks.")
+	fs.StringVar(&e.Webhook.ConfigurationName, "webhook-configuration", e.Webhook.ConfigurationName, "The name of the ValidatingWebhookConfiguration registering the validating webhook.")
+	fs.StringVar(&e.Webhook.CertSecretName, "webhook-cert-secret", e.Webhook.CertSecretName, "The name of the Secret in the controller namespace where the webhook certificates are stored.")
+	fs.DurationVar(&e.Webhook.CertificateValidity, "webhook-certificate-validity", e.Webhook.CertificateValidity, "How long the webhook CA and serving certificates are valid.")
+
+	fs.BoolVar(&e.CSR.Enabled, "csr-signing", e.CSR.Enabled, "Issue etcd-proxy server and client certificates using the Kubernetes certificates.k8s.io CertificateSigningRequests instead of self-generated CA certificates.")
+	fs.StringVar(&e.CSR.SignerCAConfigMapName, "csr-signer-ca-configmap", e.CSR.SignerCAConfigMapName, "The name of the ConfigMap in the controller namespace where the CA certificate of the cluster signer is stored under the ca.crt key.")
+	fs.BoolVar(&e.CSR.AutoApprove, "csr-auto-approve", e.CSR.AutoApprove, "Approve CertificateSigningRequests created by the controller.")
 }
 
 // ApplyTo applies provided Options struct to the provided Config struct.
@@ -76,9 +256,40 @@ func (e *EtcdProxyControllerOptions) ApplyTo(c *etcdproxy.EtcdProxyControllerCon
 	c.CoreEtcd.URLs = append([]string{}, e.CoreEtcd.URLs...)
 	c.CoreEtcd.CAConfigMapName = e.CoreEtcd.CAConfigMapName
 	c.CoreEtcd.CertSecretName = e.CoreEtcd.CertSecretName
+	c.CoreEtcd.AuthSecretName = e.CoreEtcd.AuthSecretName
+	c.CoreEtcd.SignerSecretName = e.CoreEtcd.SignerSecretName
 
 	c.ControllerNamespace = e.ControllerNamespace
 	c.ProxyImage = e.ProxyImage
+	c.ProxyPodTemplateConfigMapName = e.ProxyPodTemplateConfigMapName
+	c.CertificateValidityDefaults = &etcdproxy.CertificateValidityDefaultsConfig{}
+	c.CertificateValidityDefaults.Signing = e.CertificateValidityDefaults.Signing
+	c.CertificateValidityDefaults.Serving = e.CertificateValidityDefaults.Serving
+	c.CertificateValidityDefaults.Client = e.CertificateValidityDefaults.Client
+	c.CertificateRenewalFraction = e.CertificateRenewalFraction
+
+	c.UsageMeasurementPeriod = e.UsageMeasurementPeriod
+	c.MetricsAddress = e.MetricsAddress
+	c.HealthAddress = e.HealthAddress
+
+	c.LeaderElection = &etcdproxy.LeaderElectionConfig{}
+	c.LeaderElection.LeaderElect = e.LeaderElection.LeaderElect
+	c.LeaderElection.LockName = e.LeaderElection.LockName
+	c.LeaderElection.LeaseDuration = e.LeaderElection.LeaseDuration
+	c.LeaderElection.RenewDeadline = e.LeaderElection.RenewDeadline
+	c.LeaderElection.RetryPeriod = e.LeaderElection.RetryPeriod
+
+	c.Webhook = &etcdproxy.WebhookConfig{}
+	c.Webhook.Address = e.Webhook.Address
+	c.Webhook.ServiceName = e.Webhook.ServiceName
+	c.Webhook.ConfigurationName = e.Webhook.ConfigurationName
+	c.Webhook.CertSecretName = e.Webhook.CertSecretName
+	c.Webhook.CertificateValidity = e.Webhook.CertificateValidity
+
+	c.CSR = &etcdproxy.CSRConfig{}
+	c.CSR.Enabled = e.CSR.Enabled
+	c.CSR.SignerCAConfigMapName = e.CSR.SignerCAConfigMapName
+	c.CSR.AutoApprove = e.CSR.AutoApprove
 
 	c.Kubeconfig, err = clientcmd.BuildConfigFromFlags("", e.KubeconfigPath)
 	if err != nil {
@@ -93,6 +304,10 @@ func (e *EtcdProxyControllerOptions) Validate() error {
 	errors := []error{}
 
 	errors = append(errors, e.CoreEtcd.Validate())
+	errors = append(errors, e.CertificateValidityDefaults.Validate())
+	errors = append(errors, e.LeaderElection.Validate())
+	errors = append(errors, e.Webhook.Validate())
+	errors = append(errors, e.CSR.Validate())
 
 	if e.ControllerNamespace == "" {
 		errors = append(errors, fmt.Errorf("controller namespace name empty"))
@@ -102,6 +317,14 @@ func (e *EtcdProxyControllerOptions) Validate() error {
 		errors = append(errors, fmt.Errorf("etcd proxy image name empty"))
 	}
 
+	if e.CertificateRenewalFraction <= 0 || e.CertificateRenewalFraction >= 1 {
+		errors = append(errors, fmt.Errorf("certificate renewal fraction must be greater than 0 and less than 1"))
+	}
+
+	if e.UsageMeasurementPeriod <= 0 {
+		errors = append(errors, fmt.Errorf("usage measurement period must be positive"))
+	}
+
 	return utilerrors.NewAggregate(errors)
 }
 
@@ -123,3 +346,92 @@ func (c *CoreEtcdOptions) Validate() error {
 
 	return utilerrors.NewAggregate(errors)
 }
+
+// Validate verifies is CertificateValidityDefaultsOptions struct correctly populated.
+func (c *CertificateValidityDefaultsOptions) Validate() error {
+	errors := []error{}
+
+	if c.Signing <= 0 {
+		errors = append(errors, fmt.Errorf("default signing certificate validity must be positive"))
+	}
+
+	if c.Serving <= 0 || c.Serving > c.Signing {
+		errors = append(errors, fmt.Errorf("default serving certificate validity must be positive and not longer than signing certificate validity"))
+	}
+
+	if c.Client <= 0 || c.Client > c.Signing {
+		errors = append(errors, fmt.Errorf("default client certificate validity must be positive and not longer than signing certificate validity"))
+	}
+
+	return utilerrors.NewAggregate(errors)
+}
+
+// Validate verifies is LeaderElectionOptions struct correctly populated.
+func (l *LeaderElectionOptions) Validate() error {
+	if !l.LeaderElect {
+		return nil
+	}
+
+	errors := []error{}
+
+	if l.LockName == "" {
+		errors = append(errors, fmt.Errorf("leader election lock name empty"))
+	}
+
+	if l.LeaseDuration <= l.RenewDeadline {
+		errors = append(errors, fmt.Errorf("leader election lease duration must be greater than renew deadline"))
+	}
+
+	if l.RenewDeadline <= l.RetryPeriod {
+		errors = append(errors, fmt.Errorf("leader election renew deadline must be greater than retry period"))
+	}
+
+	if l.RetryPeriod <= 0 {
+		errors = append(errors, fmt.Errorf("leader election retry period must be positive"))
+	}
+
+	return utilerrors.NewAggregate(errors)
+}
+
+// Validate verifies is WebhookOptions struct correctly populated.
+func (w *WebhookOptions) Validate() error {
+	errors := []error{}
+
+	// The EtcdStorage CRD uses the conversion webhook to serve both API versions, so the webhooks can't be disabled.
+	if w.Address == "" {
+		errors = append(errors, fmt.Errorf("webhook address empty, the conversion webhook is required to serve EtcdStorages"))
+	}
+
+	if w.ServiceName == "" {
+		errors = append(errors, fmt.Errorf("webhook service name empty"))
+	}
+
+	if w.ConfigurationName == "" {
+		errors = append(errors, fmt.Errorf("webhook configuration name empty"))
+	}
+
+	if w.CertSecretName == "" {
+		errors = append(errors, fmt.Errorf("webhook certificates secret name empty"))
+	}
+
+	if w.CertificateValidity <= 0 {
+		errors = append(errors, fmt.Errorf("webhook certificate validity must be positive"))
+	}
+
+	return utilerrors.NewAggregate(errors)
+}
+
+// Validate verifies is CSROptions struct correctly populated.
+func (c *CSROptions) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	errors := []error{}
+
+	if c.SignerCAConfigMapName == "" {
+		errors = append(errors, fmt.Errorf("csr signer ca configmap name empty"))
+	}
+
+	return utilerrors.NewAggregate(errors)
+}
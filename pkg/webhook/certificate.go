@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+const (
+	// caCertificateKey is the key in the serving certificate Secret containing the CA certificate.
+	caCertificateKey = "ca.crt"
+
+	// certificateCheckPeriod is how often the serving certificate is checked for renewal and reloaded from the Secret.
+	certificateCheckPeriod = time.Minute
+)
+
+// CertificateRotator provides the serving certificate to the webhook server and keeps it up to date. The serving
+// certificate is periodically ensured, so it's renewed while the controller is running, and certificates renewed
+// by other controller replicas are picked up.
+type CertificateRotator struct {
+	// Ensure returns the current CA bundle and serving certificate, renewing them if needed.
+	Ensure func() ([]byte, *certs.Certificate, error)
+
+	// Register registers the webhooks using the provided CA bundle.
+	Register func(caBundle []byte) error
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	caBundle    []byte
+}
+
+// Check ensures the serving certificate and registers the webhooks using its CA bundle, if the CA bundle has changed.
+// The serving certificate is served only once the webhooks are registered using a CA bundle trusting it, so the API
+// server doesn't reject it. The previous serving certificate is served until then.
+func (r *CertificateRotator) Check() error {
+	caBundle, servingCertificate, err := r.Ensure()
+	if err != nil {
+		return fmt.Errorf("unable to ensure webhook serving certificate: %v", err)
+	}
+	certBytes, keyBytes, err := servingCertificate.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+	keyPair, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	registered := bytes.Equal(r.caBundle, caBundle)
+	r.lock.RUnlock()
+	if !registered {
+		if err := r.Register(caBundle); err != nil {
+			return fmt.Errorf("unable to register webhooks: %v", err)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.certificate = &keyPair
+	r.caBundle = caBundle
+	return nil
+}
+
+// Run checks the serving certificate every certificateCheckPeriod until the stopCh is closed.
+func (r *CertificateRotator) Run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := r.Check(); err != nil {
+			glog.Errorf("unable to rotate webhook serving certificate: %v", err)
+		}
+	}, certificateCheckPeriod, stopCh)
+}
+
+// GetCertificate returns the serving certificate loaded by the last successful check. It's used as
+// the tls.Config GetCertificate function.
+func (r *CertificateRotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.certificate == nil {
+		return nil, fmt.Errorf("webhook serving certificate is not loaded")
+	}
+	return r.certificate, nil
+}
+
+// EnsureServingCertificate returns the CA bundle and the serving certificate for the webhook Service. Certificates are
+// stored in the Secret in the controller namespace, so all controller replicas serve the webhook using the same
+// certificate. If the Secret doesn't exist, or the serving certificate expires in less than half of its validity,
+// new self-signed CA and serving certificates are generated and saved in the Secret. CA certificates from the previous
+// CA bundle are kept in the new CA bundle until they expire, so certificates served by replicas that haven't loaded
+// the new serving certificate yet stay trusted.
+func EnsureServingCertificate(kubeClient kubernetes.Interface, namespace, secretName, serviceName string,
+	validity time.Duration, currentTime func() time.Time) ([]byte, *certs.Certificate, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = nil
+		err = nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if secret != nil {
+		caBundle, servingCertificate, err := parseServingCertificate(secret)
+		if err == nil && servingCertificate.Certificates[0].NotAfter.Add(-validity/2).After(currentTime()) {
+			return caBundle, servingCertificate, nil
+		}
+	}
+
+	data, err := generateServingCertificate(namespace, serviceName, validity, currentTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret != nil {
+		if data[caCertificateKey], err = appendPreviousCAs(data[caCertificateKey], secret.Data[caCertificateKey], currentTime); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if secret != nil {
+		secret.Data = data
+		if secret, err = kubeClient.CoreV1().Secrets(namespace).Update(secret); err != nil {
+			return nil, nil, err
+		}
+		return parseServingCertificate(secret)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	_, err = kubeClient.CoreV1().Secrets(namespace).Create(secret)
+	if errors.IsAlreadyExists(err) {
+		// Another controller replica created the Secret in the meantime, so its certificates are used instead.
+		secret, err = kubeClient.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return parseServingCertificate(secret)
+}
+
+// generateServingCertificate generates new self-signed CA and serving certificate for the webhook Service and returns
+// them as the Secret data.
+func generateServingCertificate(namespace, serviceName string, validity time.Duration, currentTime func() time.Time) (map[string][]byte, error) {
+	serviceURL := fmt.Sprintf("%s.%s.svc", serviceName, namespace)
+
+	ca, err := certs.NewCACertificate(pkix.Name{
+		CommonName: fmt.Sprintf("%s-webhook-signer-%v", serviceURL, currentTime().Unix()),
+	}, metav1.Duration{Duration: validity}, certs.RSA2048, currentTime)
+	if err != nil {
+		return nil, err
+	}
+
+	servingCertificate, err := ca.NewServerCertificate(pkix.Name{CommonName: serviceURL},
+		[]string{serviceName, fmt.Sprintf("%s.%s", serviceName, namespace), serviceURL},
+		metav1.Duration{Duration: validity}, certs.RSA2048, currentTime)
+	if err != nil {
+		return nil, err
+	}
+
+	caBytes, _, err := ca.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+	certBytes, keyBytes, err := servingCertificate.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		caCertificateKey:        caBytes,
+		corev1.TLSCertKey:       certBytes,
+		corev1.TLSPrivateKeyKey: keyBytes,
+	}, nil
+}
+
+// appendPreviousCAs appends CA certificates from the previous CA bundle that are not expired to the new CA bundle.
+// The previous CA bundle is dropped if it can't be parsed.
+func appendPreviousCAs(caBundle, previousCABundle []byte, currentTime func() time.Time) ([]byte, error) {
+	previous, err := certs.ParseCertificateBytes(previousCABundle, nil)
+	if err != nil {
+		return caBundle, nil
+	}
+	bundle, err := certs.ParseCertificateBytes(caBundle, nil)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Certificates = append(bundle.Certificates, certs.FilterExpiredCerts(currentTime, previous.Certificates...)...)
+
+	caBundle, _, err = bundle.GetPEMBytes()
+	return caBundle, err
+}
+
+// parseServingCertificate returns the CA bundle and the serving certificate stored in the Secret.
+func parseServingCertificate(secret *corev1.Secret) ([]byte, *certs.Certificate, error) {
+	caBundle, ok := secret.Data[caCertificateKey]
+	if !ok || len(caBundle) == 0 {
+		return nil, nil, fmt.Errorf("secret '%s/%s' contains no ca certificate", secret.Namespace, secret.Name)
+	}
+
+	servingCertificate, err := certs.ParseCertificateBytes(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse serving certificate from secret '%s/%s': %v", secret.Namespace, secret.Name, err)
+	}
+	if len(servingCertificate.Certificates) == 0 || servingCertificate.Key == nil {
+		return nil, nil, fmt.Errorf("secret '%s/%s' contains no serving certificate", secret.Namespace, secret.Name)
+	}
+
+	return caBundle, servingCertificate, nil
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/xmudrii/etcdproxy-controller/pkg/certs"
+)
+
+// fakeClock is used to control the time used for issuing and renewing certificates.
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) currentTime() time.Time {
+	return f.now
+}
+
+func TestEnsureServingCertificate(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	clock := &fakeClock{now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	caBundle, servingCertificate, err := EnsureServingCertificate(kubeClient, "test-storage", "webhook-cert", "webhook", time.Hour, clock.currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := certs.ParseCertificateBytes(caBundle, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := servingCertificate.Certificates[0].CheckSignatureFrom(ca.Certificates[0]); err != nil {
+		t.Fatalf("expected serving certificate to be signed by the ca: %v", err)
+	}
+	if err := servingCertificate.Certificates[0].VerifyHostname("webhook.test-storage.svc"); err != nil {
+		t.Fatalf("expected serving certificate to be valid for the service: %v", err)
+	}
+
+	// The certificate stored in the Secret is reused.
+	reusedCABundle, reusedCertificate, err := EnsureServingCertificate(kubeClient, "test-storage", "webhook-cert", "webhook", time.Hour, clock.currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(caBundle, reusedCABundle) || !reusedCertificate.Certificates[0].Equal(servingCertificate.Certificates[0]) {
+		t.Fatal("expected the stored certificates to be reused")
+	}
+
+	// The certificate is regenerated if it expires in less than half of the validity.
+	renewedCABundle, _, err := EnsureServingCertificate(kubeClient, "test-storage", "webhook-cert", "webhook", 4*time.Hour, clock.currentTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(caBundle, renewedCABundle) {
+		t.Fatal("expected the certificates to be regenerated")
+	}
+	// The previous CA certificate is kept in the CA bundle until it expires.
+	renewedCA, err := certs.ParseCertificateBytes(renewedCABundle, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renewedCA.Certificates) != 2 || !renewedCA.Certificates[1].Equal(ca.Certificates[0]) {
+		t.Fatalf("expected the new and the previous ca certificates in the ca bundle, but got %d certificates", len(renewedCA.Certificates))
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets("test-storage").Get("webhook-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.Data[caCertificateKey], renewedCABundle) {
+		t.Fatal("expected the regenerated certificates to be stored in the secret")
+	}
+}
+
+func TestEnsureValidatingWebhookConfiguration(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+
+	for _, caBundle := range [][]byte{[]byte("ca-1"), []byte("ca-2")} {
+		if err := EnsureValidatingWebhookConfiguration(kubeClient, "etcdproxy-controller", "test-storage", "webhook", caBundle); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get("etcdproxy-controller", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.Webhooks) != 1 {
+			t.Fatalf("expected one webhook, but got %d", len(config.Webhooks))
+		}
+		clientConfig := config.Webhooks[0].ClientConfig
+		if !bytes.Equal(clientConfig.CABundle, caBundle) {
+			t.Fatalf("expected ca bundle '%s', but got '%s'", caBundle, clientConfig.CABundle)
+		}
+		if clientConfig.Service.Namespace != "test-storage" || clientConfig.Service.Name != "webhook" || *clientConfig.Service.Path != ValidatePath {
+			t.Fatalf("unexpected webhook service: %+v", clientConfig.Service)
+		}
+	}
+}
+
+func TestCertificateRotator(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	clock := &fakeClock{now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var registered [][]byte
+	var registerErr error
+	var rotator *CertificateRotator
+	served := func() *x509.Certificate {
+		keyPair, err := rotator.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	trusted := func(caBundle []byte, cert *x509.Certificate) bool {
+		ca, err := certs.ParseCertificateBytes(caBundle, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range ca.Certificates {
+			if cert.CheckSignatureFrom(c) == nil {
+				return true
+			}
+		}
+		return false
+	}
+	rotator = &CertificateRotator{
+		Ensure: func() ([]byte, *certs.Certificate, error) {
+			return EnsureServingCertificate(kubeClient, "test-storage", "webhook-cert", "webhook", 4*time.Hour, clock.currentTime)
+		},
+		Register: func(caBundle []byte) error {
+			if registerErr != nil {
+				return registerErr
+			}
+			// The certificate served while registering must be trusted by the new CA bundle as well.
+			if len(registered) != 0 && !trusted(caBundle, served()) {
+				t.Fatal("expected the served certificate to be trusted by the new ca bundle")
+			}
+			registered = append(registered, caBundle)
+			return nil
+		},
+	}
+
+	if _, err := rotator.GetCertificate(nil); err == nil {
+		t.Fatal("expected error getting the certificate before the first check")
+	}
+	if err := rotator.Check(); err != nil {
+		t.Fatal(err)
+	}
+	initial := served()
+	if len(registered) != 1 || !trusted(registered[0], initial) {
+		t.Fatal("expected the webhooks to be registered using the ca bundle trusting the served certificate")
+	}
+
+	// Checks don't register the webhooks again if the certificate isn't renewed.
+	clock.now = clock.now.Add(time.Hour)
+	if err := rotator.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 1 || !served().Equal(initial) {
+		t.Fatal("expected the certificate not to be renewed")
+	}
+
+	// The renewed certificate is not served until the webhooks are registered using the new CA bundle.
+	clock.now = clock.now.Add(2 * time.Hour)
+	registerErr = fmt.Errorf("test error")
+	if err := rotator.Check(); err == nil {
+		t.Fatal("expected registering error")
+	}
+	if !served().Equal(initial) {
+		t.Fatal("expected the previous certificate to be served until the webhooks are registered")
+	}
+	registerErr = nil
+	if err := rotator.Check(); err != nil {
+		t.Fatal(err)
+	}
+	renewed := served()
+	if renewed.Equal(initial) {
+		t.Fatal("expected the renewed certificate to be served")
+	}
+	if len(registered) != 2 || !trusted(registered[1], initial) || !trusted(registered[1], renewed) {
+		t.Fatal("expected the new ca bundle to trust both the previous and the renewed certificate")
+	}
+
+	// The previous CA certificate is removed from the CA bundle once it expires.
+	clock.now = clock.now.Add(3 * time.Hour)
+	if err := rotator.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 3 || trusted(registered[2], initial) || !trusted(registered[2], served()) {
+		t.Fatal("expected the expired ca certificate to be removed from the ca bundle")
+	}
+}
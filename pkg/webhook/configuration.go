@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// webhookName is the name of the EtcdStorage validating webhook in the ValidatingWebhookConfiguration.
+const webhookName = "etcdstorages.etcd.xmudrii.com"
+
+// EnsureValidatingWebhookConfiguration creates or updates the ValidatingWebhookConfiguration registering
+// the EtcdStorage validating webhook, served by the provided Service and trusted using the provided CA bundle.
+func EnsureValidatingWebhookConfiguration(kubeClient kubernetes.Interface, name, namespace, serviceName string, caBundle []byte) error {
+	required := newValidatingWebhookConfiguration(name, namespace, serviceName, caBundle)
+
+	existing, err := kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Create(required)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	existing.Webhooks = required.Webhooks
+	_, err = kubeClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Update(existing)
+	return err
+}
+
+// newValidatingWebhookConfiguration returns the ValidatingWebhookConfiguration validating EtcdStorages on create and update.
+func newValidatingWebhookConfiguration(name, namespace, serviceName string, caBundle []byte) *admissionregistrationv1beta1.ValidatingWebhookConfiguration {
+	path := ValidatePath
+	failurePolicy := admissionregistrationv1beta1.Fail
+
+	return &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Webhooks: []admissionregistrationv1beta1.Webhook{
+			{
+				Name: webhookName,
+				ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{
+					Service: &admissionregistrationv1beta1.ServiceReference{
+						Namespace: namespace,
+						Name:      serviceName,
+						Path:      &path,
+					},
+					CABundle: caBundle,
+				},
+				Rules: []admissionregistrationv1beta1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1beta1.OperationType{
+							admissionregistrationv1beta1.Create,
+							admissionregistrationv1beta1.Update,
+						},
+						Rule: admissionregistrationv1beta1.Rule{
+							APIGroups:   []string{etcdstoragev1beta1.SchemeGroupVersion.Group},
+							APIVersions: []string{etcdstoragev1beta1.SchemeGroupVersion.Version, etcdstoragev1alpha1.SchemeGroupVersion.Version},
+							Resources:   []string{"etcdstorages"},
+						},
+					},
+				},
+				FailurePolicy: &failurePolicy,
+			},
+		},
+	}
+}
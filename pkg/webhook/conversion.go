@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+
+	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// ConvertPath is the path on which the EtcdStorage conversion webhook is served.
+const ConvertPath = "/convert"
+
+// crdName is the name of the EtcdStorage CustomResourceDefinition.
+const crdName = "etcdstorages.etcd.xmudrii.com"
+
+// conversionScheme knows about all EtcdStorage versions and conversions between them.
+var conversionScheme = runtime.NewScheme()
+
+func init() {
+	etcdstoragev1alpha1.AddToScheme(conversionScheme)
+	etcdstoragev1beta1.AddToScheme(conversionScheme)
+}
+
+// ConversionReview describes a conversion request and response sent to and from the conversion webhook.
+// The type mirrors apiextensions.k8s.io/v1beta1 ConversionReview, which is not available in the vendored
+// apiextensions version.
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *ConversionRequest  `json:"request,omitempty"`
+	Response        *ConversionResponse `json:"response,omitempty"`
+}
+
+// ConversionRequest contains the objects to be converted and the version they should be converted to.
+type ConversionRequest struct {
+	UID               types.UID              `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+// ConversionResponse contains the converted objects and the result of the conversion.
+type ConversionResponse struct {
+	UID              types.UID              `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+// ConversionHandler returns the HTTP handler converting EtcdStorages between API versions.
+func ConversionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		review := &ConversionReview{}
+		if err := json.Unmarshal(body, review); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode conversion review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "conversion review contains no request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = convert(review.Request)
+		review.Response.UID = review.Request.UID
+		review.Request = nil
+
+		resp, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to encode conversion review: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	})
+}
+
+// convert converts all objects from the conversion request to the desired API version.
+func convert(request *ConversionRequest) *ConversionResponse {
+	desiredGV, err := schema.ParseGroupVersion(request.DesiredAPIVersion)
+	if err != nil {
+		return conversionFailed(fmt.Sprintf("unable to parse desired api version: %v", err))
+	}
+
+	var convertedObjects []runtime.RawExtension
+	for _, object := range request.Objects {
+		converted, err := convertEtcdStorage(object.Raw, desiredGV)
+		if err != nil {
+			glog.Errorf("unable to convert etcdstorage: %v", err)
+			return conversionFailed(fmt.Sprintf("unable to convert etcdstorage: %v", err))
+		}
+		raw, err := json.Marshal(converted)
+		if err != nil {
+			return conversionFailed(fmt.Sprintf("unable to encode etcdstorage: %v", err))
+		}
+		convertedObjects = append(convertedObjects, runtime.RawExtension{Raw: raw})
+	}
+
+	return &ConversionResponse{
+		ConvertedObjects: convertedObjects,
+		Result:           metav1.Status{Status: metav1.StatusSuccess},
+	}
+}
+
+// conversionFailed returns the conversion response failing the request with the provided message.
+func conversionFailed(message string) *ConversionResponse {
+	return &ConversionResponse{
+		Result: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+		},
+	}
+}
+
+// decodeEtcdStorage decodes the raw EtcdStorage object of any served API version.
+func decodeEtcdStorage(raw []byte, gv schema.GroupVersion) (runtime.Object, error) {
+	in, err := conversionScheme.New(gv.WithKind("EtcdStorage"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, in); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// convertEtcdStorage converts the raw EtcdStorage object to the desired API version.
+func convertEtcdStorage(raw []byte, desiredGV schema.GroupVersion) (runtime.Object, error) {
+	typeMeta := &metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, typeMeta); err != nil {
+		return nil, err
+	}
+	gv, err := schema.ParseGroupVersion(typeMeta.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	if typeMeta.Kind != "EtcdStorage" {
+		return nil, fmt.Errorf("unexpected kind '%s'", typeMeta.Kind)
+	}
+
+	in, err := decodeEtcdStorage(raw, gv)
+	if err != nil {
+		return nil, err
+	}
+	out, err := conversionScheme.New(desiredGV.WithKind("EtcdStorage"))
+	if err != nil {
+		return nil, err
+	}
+	if err := conversionScheme.Convert(in, out, nil); err != nil {
+		return nil, err
+	}
+	out.GetObjectKind().SetGroupVersionKind(desiredGV.WithKind("EtcdStorage"))
+	return out, nil
+}
+
+// EnsureCustomResourceConversion configures the EtcdStorage CustomResourceDefinition to convert EtcdStorages
+// using the conversion webhook, served by the provided Service and trusted using the provided CA bundle.
+// The CustomResourceDefinition is patched using the provided REST client, as the apiextensions clientset is not vendored.
+func EnsureCustomResourceConversion(restClient rest.Interface, namespace, serviceName string, caBundle []byte) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"conversion": map[string]interface{}{
+				"strategy": "Webhook",
+				"webhookClientConfig": map[string]interface{}{
+					"caBundle": caBundle,
+					"service": map[string]interface{}{
+						"namespace": namespace,
+						"name":      serviceName,
+						"path":      ConvertPath,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return restClient.Patch(types.MergePatchType).
+		AbsPath("/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions", crdName).
+		Body(patch).
+		Do().
+		Error()
+}
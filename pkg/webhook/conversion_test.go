@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	etcdstoragev1alpha1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestConversionHandler(t *testing.T) {
+	v1alpha1Object := `{"apiVersion":"etcd.xmudrii.com/v1alpha1","kind":"EtcdStorage","metadata":{"name":"test"},` +
+		`"spec":{"caCertConfigMap":[{"name":"etcd-ca","namespace":"p1"}],"clientCertSecret":[{"name":"etcd-client","namespace":"p1"}]}}`
+	v1beta1Object := `{"apiVersion":"etcd.xmudrii.com/v1beta1","kind":"EtcdStorage","metadata":{"name":"test"},` +
+		`"spec":{"caCertConfigMaps":[{"name":"etcd-ca","namespace":"p1"}],"clientCertSecrets":[{"name":"etcd-client","namespace":"p1"}]}}`
+
+	tests := []struct {
+		name              string
+		desiredAPIVersion string
+		object            string
+		expectedStatus    string
+	}{
+		{
+			name:              "v1alpha1 to v1beta1",
+			desiredAPIVersion: "etcd.xmudrii.com/v1beta1",
+			object:            v1alpha1Object,
+			expectedStatus:    metav1.StatusSuccess,
+		},
+		{
+			name:              "v1beta1 to v1alpha1",
+			desiredAPIVersion: "etcd.xmudrii.com/v1alpha1",
+			object:            v1beta1Object,
+			expectedStatus:    metav1.StatusSuccess,
+		},
+		{
+			name:              "same version",
+			desiredAPIVersion: "etcd.xmudrii.com/v1beta1",
+			object:            v1beta1Object,
+			expectedStatus:    metav1.StatusSuccess,
+		},
+		{
+			name:              "unknown version",
+			desiredAPIVersion: "etcd.xmudrii.com/v2",
+			object:            v1beta1Object,
+			expectedStatus:    metav1.StatusFailure,
+		},
+		{
+			name:              "unknown kind",
+			desiredAPIVersion: "etcd.xmudrii.com/v1beta1",
+			object:            `{"apiVersion":"etcd.xmudrii.com/v1alpha1","kind":"Unknown","metadata":{"name":"test"}}`,
+			expectedStatus:    metav1.StatusFailure,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			review := &ConversionReview{
+				Request: &ConversionRequest{
+					UID:               "test-uid",
+					DesiredAPIVersion: tc.desiredAPIVersion,
+					Objects:           []runtime.RawExtension{{Raw: []byte(tc.object)}},
+				},
+			}
+			body, err := json.Marshal(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			ConversionHandler().ServeHTTP(w, httptest.NewRequest("POST", ConvertPath, bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			resp := &ConversionReview{}
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Response == nil {
+				t.Fatal("expected conversion response, but got none")
+			}
+			if resp.Response.UID != "test-uid" {
+				t.Fatalf("expected response uid 'test-uid', but got '%s'", resp.Response.UID)
+			}
+			if resp.Response.Result.Status != tc.expectedStatus {
+				t.Fatalf("expected status '%s', but got '%s': %s", tc.expectedStatus, resp.Response.Result.Status, resp.Response.Result.Message)
+			}
+			if tc.expectedStatus != metav1.StatusSuccess {
+				return
+			}
+			if len(resp.Response.ConvertedObjects) != 1 {
+				t.Fatalf("expected one converted object, but got %d", len(resp.Response.ConvertedObjects))
+			}
+
+			raw := resp.Response.ConvertedObjects[0].Raw
+			switch tc.desiredAPIVersion {
+			case etcdstoragev1beta1.SchemeGroupVersion.String():
+				etcdstorage := &etcdstoragev1beta1.EtcdStorage{}
+				if err := json.Unmarshal(raw, etcdstorage); err != nil {
+					t.Fatal(err)
+				}
+				if etcdstorage.APIVersion != tc.desiredAPIVersion || etcdstorage.Name != "test" ||
+					len(etcdstorage.Spec.CACertConfigMaps) != 1 || len(etcdstorage.Spec.ClientCertSecrets) != 1 {
+					t.Fatalf("unexpected converted etcdstorage: %s", raw)
+				}
+			case etcdstoragev1alpha1.SchemeGroupVersion.String():
+				etcdstorage := &etcdstoragev1alpha1.EtcdStorage{}
+				if err := json.Unmarshal(raw, etcdstorage); err != nil {
+					t.Fatal(err)
+				}
+				if etcdstorage.APIVersion != tc.desiredAPIVersion || etcdstorage.Name != "test" ||
+					len(etcdstorage.Spec.CACertConfigMaps) != 1 || len(etcdstorage.Spec.ClientCertSecrets) != 1 {
+					t.Fatalf("unexpected converted etcdstorage: %s", raw)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+// ValidatePath is the path on which the EtcdStorage validating webhook is served.
+const ValidatePath = "/validate-etcdstorage"
+
+// ValidateFunc validates the EtcdStorage. The EtcdStorage is admitted if no errors are returned.
+type ValidateFunc func(etcdstorage *etcdstoragev1beta1.EtcdStorage) (field.ErrorList, error)
+
+// Handler returns the HTTP handler reviewing EtcdStorage admission requests using the provided validate function.
+// Admission requests for other operations than create and update are always allowed, as are updates that don't
+// change the EtcdStorage Spec.
+func Handler(validate ValidateFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		review := &admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(body, review); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "admission review contains no request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = admit(review.Request, validate)
+		review.Response.UID = review.Request.UID
+		review.Request = nil
+
+		resp, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to encode admission review: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	})
+}
+
+// admit validates the EtcdStorage from the admission request and returns the admission response.
+// Updates that don't change the EtcdStorage Spec, such as adding or removing finalizers and status updates, and
+// updates of EtcdStorages being deleted are always allowed, so EtcdStorages that became invalid can still be
+// cleaned up and deleted. Otherwise, the updated EtcdStorage is validated the same as created ones.
+func admit(request *admissionv1beta1.AdmissionRequest, validate ValidateFunc) *admissionv1beta1.AdmissionResponse {
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	etcdstorage, err := decodeAdmissionEtcdStorage(request.Object.Raw, request.Kind)
+	if err != nil {
+		return denied(http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("unable to decode etcdstorage: %v", err))
+	}
+	if request.Operation == admissionv1beta1.Update {
+		if etcdstorage.DeletionTimestamp != nil {
+			return &admissionv1beta1.AdmissionResponse{Allowed: true}
+		}
+		oldEtcdstorage, err := decodeAdmissionEtcdStorage(request.OldObject.Raw, request.Kind)
+		if err != nil {
+			return denied(http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("unable to decode old etcdstorage: %v", err))
+		}
+		if equality.Semantic.DeepEqual(oldEtcdstorage.Spec, etcdstorage.Spec) {
+			return &admissionv1beta1.AdmissionResponse{Allowed: true}
+		}
+	}
+
+	errs, err := validate(etcdstorage)
+	if err != nil {
+		glog.Errorf("unable to validate etcdstorage '%s': %v", etcdstorage.Name, err)
+		return denied(http.StatusInternalServerError, metav1.StatusReasonInternalError, fmt.Sprintf("unable to validate etcdstorage: %v", err))
+	}
+	if len(errs) != 0 {
+		return denied(http.StatusUnprocessableEntity, metav1.StatusReasonInvalid,
+			fmt.Sprintf("EtcdStorage.etcd.xmudrii.com \"%s\" is invalid: %v", etcdstorage.Name, errs.ToAggregate()))
+	}
+
+	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+}
+
+// decodeAdmissionEtcdStorage decodes the EtcdStorage from the admission request. EtcdStorages of older API versions
+// are converted to the version validated by the controller.
+func decodeAdmissionEtcdStorage(raw []byte, kind metav1.GroupVersionKind) (*etcdstoragev1beta1.EtcdStorage, error) {
+	etcdstorage := &etcdstoragev1beta1.EtcdStorage{}
+	in, err := decodeEtcdStorage(raw, schema.GroupVersion{Group: kind.Group, Version: kind.Version})
+	if err == nil {
+		err = conversionScheme.Convert(in, etcdstorage, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return etcdstorage, nil
+}
+
+// denied returns the admission response denying the request with the provided reason and message.
+func denied(code int32, reason metav1.StatusReason, message string) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Reason:  reason,
+			Message: message,
+		},
+	}
+}
+
+// Serve starts the HTTPS server serving the validating webhook on the ValidatePath path and the conversion
+// webhook on the ConvertPath path. The serving certificate is checked using the provided rotator before the server
+// is started, and periodically afterwards, so it's rotated without restarting the server. The server is stopped once
+// the stopCh is closed.
+func Serve(address string, rotator *CertificateRotator, validate ValidateFunc, stopCh <-chan struct{}) error {
+	if err := rotator.Check(); err != nil {
+		return err
+	}
+	go rotator.Run(stopCh)
+
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, Handler(validate))
+	mux.Handle(ConvertPath, ConversionHandler())
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			GetCertificate: rotator.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		glog.Infof("Serving webhooks on %s", address)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("unable to serve webhooks: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		if err := server.Close(); err != nil {
+			glog.Errorf("unable to stop webhook server: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	etcdstoragev1beta1 "github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
+)
+
+func TestHandler(t *testing.T) {
+	validate := func(etcdstorage *etcdstoragev1beta1.EtcdStorage) (field.ErrorList, error) {
+		if etcdstorage.Name == "invalid" {
+			return field.ErrorList{field.Invalid(field.NewPath("metadata", "name"), etcdstorage.Name, "test error")}, nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name            string
+		operation       admissionv1beta1.Operation
+		version         string
+		object          string
+		oldObject       string
+		expectedAllowed bool
+		expectedCode    int32
+	}{
+		{
+			name:            "valid etcdstorage",
+			operation:       admissionv1beta1.Create,
+			version:         "v1beta1",
+			object:          `{"metadata":{"name":"valid"}}`,
+			expectedAllowed: true,
+		},
+		{
+			name:            "invalid v1alpha1 etcdstorage",
+			operation:       admissionv1beta1.Create,
+			version:         "v1alpha1",
+			object:          `{"metadata":{"name":"invalid"}}`,
+			expectedAllowed: false,
+			expectedCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "invalid etcdstorage",
+			operation:       admissionv1beta1.Update,
+			version:         "v1beta1",
+			object:          `{"metadata":{"name":"invalid"},"spec":{"keyAlgorithm":"ECDSA-P256"}}`,
+			oldObject:       `{"metadata":{"name":"invalid"}}`,
+			expectedAllowed: false,
+			expectedCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "finalizer update of invalid etcdstorage",
+			operation:       admissionv1beta1.Update,
+			version:         "v1beta1",
+			object:          `{"metadata":{"name":"invalid","finalizers":["etcd.xmudrii.com/cleanup"]},"spec":{"keyAlgorithm":"ECDSA-P256"}}`,
+			oldObject:       `{"metadata":{"name":"invalid"},"spec":{"keyAlgorithm":"ECDSA-P256"}}`,
+			expectedAllowed: true,
+		},
+		{
+			name:            "update of deleted invalid v1alpha1 etcdstorage",
+			operation:       admissionv1beta1.Update,
+			version:         "v1alpha1",
+			object:          `{"metadata":{"name":"invalid","deletionTimestamp":"2018-01-01T00:00:00Z"},"spec":{"keyAlgorithm":"ECDSA-P256"}}`,
+			oldObject:       `{"metadata":{"name":"invalid","deletionTimestamp":"2018-01-01T00:00:00Z","finalizers":["etcd.xmudrii.com/cleanup"]}}`,
+			expectedAllowed: true,
+		},
+		{
+			name:            "malformed old etcdstorage",
+			operation:       admissionv1beta1.Update,
+			version:         "v1beta1",
+			object:          `{"metadata":{"name":"valid"}}`,
+			oldObject:       `{"metadata":"invalid"}`,
+			expectedAllowed: false,
+			expectedCode:    http.StatusBadRequest,
+		},
+		{
+			name:            "malformed etcdstorage",
+			operation:       admissionv1beta1.Create,
+			version:         "v1beta1",
+			object:          `{"metadata":"invalid"}`,
+			expectedAllowed: false,
+			expectedCode:    http.StatusBadRequest,
+		},
+		{
+			name:            "delete operation",
+			operation:       admissionv1beta1.Delete,
+			version:         "v1beta1",
+			object:          `{"metadata":{"name":"invalid"}}`,
+			expectedAllowed: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			review := &admissionv1beta1.AdmissionReview{
+				Request: &admissionv1beta1.AdmissionRequest{
+					UID:       "test-uid",
+					Kind:      metav1.GroupVersionKind{Group: "etcd.xmudrii.com", Version: tc.version, Kind: "EtcdStorage"},
+					Operation: tc.operation,
+					Object:    runtime.RawExtension{Raw: []byte(tc.object)},
+				},
+			}
+			if tc.oldObject != "" {
+				review.Request.OldObject = runtime.RawExtension{Raw: []byte(tc.oldObject)}
+			}
+			body, err := json.Marshal(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			Handler(validate).ServeHTTP(w, httptest.NewRequest("POST", ValidatePath, bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			resp := &admissionv1beta1.AdmissionReview{}
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Response == nil {
+				t.Fatal("expected admission response, but got none")
+			}
+			if resp.Response.UID != "test-uid" {
+				t.Fatalf("expected response uid 'test-uid', but got '%s'", resp.Response.UID)
+			}
+			if resp.Response.Allowed != tc.expectedAllowed {
+				t.Fatalf("expected allowed %t, but got %t", tc.expectedAllowed, resp.Response.Allowed)
+			}
+			if !tc.expectedAllowed && resp.Response.Result.Code != tc.expectedCode {
+				t.Fatalf("expected code %d, but got %d: %s", tc.expectedCode, resp.Response.Result.Code, resp.Response.Result.Message)
+			}
+		})
+	}
+}
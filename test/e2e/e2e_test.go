@@ -5,7 +5,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1alpha1"
+	"github.com/xmudrii/etcdproxy-controller/pkg/apis/etcd/v1beta1"
 	clientset "github.com/xmudrii/etcdproxy-controller/pkg/client/clientset/versioned"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -26,25 +26,25 @@ func TestDeployEtcdStorage(t *testing.T) {
 
 	tests := []struct {
 		name                   string
-		etcdStorage            *v1alpha1.EtcdStorage
+		etcdStorage            *v1beta1.EtcdStorage
 		expectedDeploymentName string
 		expectedReplicas       int32
 		expectedServiceName    string
 	}{
 		{
 			name: "test simple etcdstorage creation",
-			etcdStorage: &v1alpha1.EtcdStorage{
+			etcdStorage: &v1beta1.EtcdStorage{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "es-test-1",
 				},
-				Spec: v1alpha1.EtdcStorageSpec{
-					CACertConfigMaps: []v1alpha1.CABundleDestination{
+				Spec: v1beta1.EtcdStorageSpec{
+					CACertConfigMaps: []v1beta1.CABundleDestination{
 						{
 							Name:      "etcd-serving-ca",
 							Namespace: "k8s-sample-apiserver",
 						},
 					},
-					ClientCertSecrets: []v1alpha1.ClientCertificateDestination{
+					ClientCertSecrets: []v1beta1.ClientCertificateDestination{
 						{
 							Name:      "etcd-client-cert",
 							Namespace: "k8s-sample-apiserver",
@@ -63,14 +63,14 @@ func TestDeployEtcdStorage(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create an EtcdStorage instance.
-			es, err := etcdproxyClient.EtcdV1alpha1().EtcdStorages().Create(tc.etcdStorage)
+			es, err := etcdproxyClient.EtcdV1beta1().EtcdStorages().Create(tc.etcdStorage)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			// It takes short amount time for the Deployment and Service to be created, so we need to poll.
 			err = wait.Poll(500*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
-				es, err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
+				es, err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Get(es.Name, metav1.GetOptions{})
 				if err != nil {
 					return false, err
 				}
@@ -80,7 +80,7 @@ func TestDeployEtcdStorage(t *testing.T) {
 				return false, nil
 			})
 			if err != nil {
-				err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
+				err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
 				if err != nil {
 					t.Logf("etcdstorage cleanup failed: %v", err)
 				}
@@ -90,14 +90,14 @@ func TestDeployEtcdStorage(t *testing.T) {
 			// We currently have only one condition, so we're making sure that one is set.
 			for _, cond := range es.Status.Conditions {
 				if cond.Type != "Deployed" {
-					err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
+					err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
 					if err != nil {
 						t.Logf("etcdstorage cleanup failed: %v", err)
 					}
 					t.Fatalf("expected 'Deployed' condition, but got: %s", cond.Type)
 				}
-				if cond.Status != v1alpha1.ConditionTrue {
-					err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
+				if cond.Status != v1beta1.ConditionTrue {
+					err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
 					if err != nil {
 						t.Logf("etcdstorage cleanup failed: %v", err)
 					}
@@ -117,7 +117,7 @@ func TestDeployEtcdStorage(t *testing.T) {
 				return true, nil
 			})
 			if err != nil {
-				err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
+				err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
 				if err != nil {
 					t.Logf("etcdstorage cleanup failed: %v", err)
 				}
@@ -130,7 +130,7 @@ func TestDeployEtcdStorage(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = etcdproxyClient.EtcdV1alpha1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
+			err = etcdproxyClient.EtcdV1beta1().EtcdStorages().Delete(es.Name, &metav1.DeleteOptions{})
 			if err != nil {
 				t.Fatal(err)
 			}